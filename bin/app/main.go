@@ -9,32 +9,54 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"location-service/bin/config"
+	"location-service/bin/middlewares"
+	user "location-service/bin/modules/user"
 	userHandler "location-service/bin/modules/user/handlers"
+	userModels "location-service/bin/modules/user/models"
 	userRepoCommands "location-service/bin/modules/user/repositories/commands"
+	userPlaces "location-service/bin/modules/user/repositories/places"
 	userRepoQueries "location-service/bin/modules/user/repositories/queries"
+	userRouting "location-service/bin/modules/user/repositories/routing"
 	userUsecase "location-service/bin/modules/user/usecases"
 
+	driver "location-service/bin/modules/driver"
 	driverHandler "location-service/bin/modules/driver/handlers"
 	driverRepoCommands "location-service/bin/modules/driver/repositories/commands"
 	driverRepoQueries "location-service/bin/modules/driver/repositories/queries"
 	driverUsecase "location-service/bin/modules/driver/usecases"
 
+	rideHandler "location-service/bin/modules/ride/handlers"
+	rideRepoCommands "location-service/bin/modules/ride/repositories/commands"
+	rideRepoQueries "location-service/bin/modules/ride/repositories/queries"
+	rideUsecase "location-service/bin/modules/ride/usecases"
+
 	"location-service/bin/pkg/apm"
+	"location-service/bin/pkg/constants"
 	"location-service/bin/pkg/databases/mongodb"
+	"location-service/bin/pkg/hub"
 	kafkaConfluent "location-service/bin/pkg/kafka/confluent"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
 
 	"location-service/bin/pkg/validator"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	goredis "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
 
 	"go.elastic.co/apm/module/apmechov4"
 )
 
+// placeSuggestionLimit is the number of places returned by autocomplete and reverse geocode
+const placeSuggestionLimit = 5
+
 func main() {
 	apm.InitConnection()
 	redis.LoadConfig()
@@ -54,66 +76,398 @@ func main() {
 	e.Use(apmechov4.Middleware(apmechov4.WithTracer(apm.GetTracer())))
 
 	e.Use(middleware.CORSWithConfig(middleware.DefaultCORSConfig))
-	setHttp(e)
+	kafkaProducer, err := kafkaConfluent.NewProducer(kafkaConfluent.GetConfig().GetKafkaConfig(), log.GetLogger())
+	if err != nil {
+		panic(err)
+	}
 
-	listenerPort := fmt.Sprintf(":%s", config.GetConfig().AppPort)
-	e.Logger.Fatal(e.Start(listenerPort))
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	setHttp(workerCtx, &workers, kafkaProducer, e)
 
+	listenerPort := fmt.Sprintf(":%s", config.GetConfig().AppPort)
 	server := &http.Server{
-		Addr:         listenerPort,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
-		IdleTimeout:  5 * time.Second,
+		Addr:    listenerPort,
+		Handler: e,
+		// no ReadTimeout/WriteTimeout, they would cut the websocket and event-stream connections
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       5 * time.Second,
 	}
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-quit
-		log.GetLogger().Info("main", "Server message-service is shutting down...", "gracefull", "")
+		log.GetLogger().Info("main", "Server location-service is shutting down...", "gracefull", "")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// stop the workers first, it also ends the live tracking streams so the server can drain
+		stopWorker()
 		server.SetKeepAlivesEnabled(false)
 		if err := server.Shutdown(ctx); err != nil {
-			log.GetLogger().Info("main", fmt.Sprintf("Could not gracefully shutdown the server order-service: %v\n", err), "gracefull", "")
+			log.GetLogger().Info("main", fmt.Sprintf("Could not gracefully shutdown the server location-service: %v\n", err), "gracefull", "")
 		}
+		workers.Wait()
+		kafkaProducer.Close()
 		close(done)
 	}()
 
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.GetLogger().Info("main", fmt.Sprintf("Could not listen on %s: %v\n", config.GetConfig().AppPort, err), "gracefull", "")
+		return
 	}
 
 	<-done
 	log.GetLogger().Info("main", fmt.Sprintf("Server %s stopped", config.GetConfig().AppName), "gracefull", "")
 }
 
-func setHttp(e *echo.Echo) {
+func setHttp(ctx context.Context, workers *sync.WaitGroup, kafkaProducer kafkaConfluent.Producer, e *echo.Echo) {
 	redisClient := redis.GetClient()
 	e.GET("/v1/health-check", func(c echo.Context) error {
 		log.GetLogger().Info("main", "This service is running properly", "setConfluentEvents", "")
 		return utils.Response(nil, "This service is running properly", 200, c)
 	})
-	kafkaProducer, err := kafkaConfluent.NewProducer(kafkaConfluent.GetConfig().GetKafkaConfig(), log.GetLogger())
-	if err != nil {
-		panic(err)
-	}
-
 	userQueryMongodbRepo := userRepoQueries.NewQueryMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetSlaveConn(), mongodb.GetSlaveDBName(), log.GetLogger()))
 	userCommandMongodbRepo := userRepoCommands.NewCommandMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()))
 
-	userQueryUsecase := userUsecase.NewQueryUsecase(userQueryMongodbRepo, redisClient, kafkaProducer)
-	userCommandUsecase := userUsecase.NewCommandUsecase(userQueryMongodbRepo, userCommandMongodbRepo, config.GetConfig().GoogleApiKey, redisClient)
-
 	driverQueryMongodbRepo := driverRepoQueries.NewQueryMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetSlaveConn(), mongodb.GetSlaveDBName(), log.GetLogger()))
 	driverCommandMongodbRepo := driverRepoCommands.NewCommandMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()))
 
+	// dispatches are saved with optimistic locking on the version read, reading it from a secondary would only conflict
+	driverMasterQueryMongodbRepo := driverRepoQueries.NewQueryMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()))
+
+	rideQueryMongodbRepo := rideRepoQueries.NewQueryMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetSlaveConn(), mongodb.GetSlaveDBName(), log.GetLogger()))
+	rideCommandMongodbRepo := rideRepoCommands.NewCommandMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()))
+	// the ride state machine reads what it is about to update from the master, a lagging secondary would see an
+	// older status and fail the transition
+	rideMasterQueryMongodbRepo := rideRepoQueries.NewQueryMongodbRepository(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()))
+	rideQueryUsecase := rideUsecase.NewQueryUsecase(rideQueryMongodbRepo)
+	cancellationPolicy := setCancellationPolicy()
+	// the ride module cancels dispatches and releases drivers through the driver module
+	driverPool := driverUsecase.NewDriverPool(driverMasterQueryMongodbRepo, driverCommandMongodbRepo, redisClient)
+	rideCommandUsecase := rideUsecase.NewCommandUsecase(rideMasterQueryMongodbRepo, rideCommandMongodbRepo, redisClient, cancellationPolicy, driverPool)
+
+	surgePricing := userUsecase.NewSurgePricing(redisClient, time.Duration(config.GetConfig().SurgeWindow)*time.Second, config.GetConfig().SurgeMaxMultiplier, config.GetConfig().SurgeSmoothing)
+	setIndexes(ctx)
+	routeProvider := setRouteProvider(redisClient)
+	userQueryUsecase := userUsecase.NewQueryUsecase(userQueryMongodbRepo, userCommandMongodbRepo, redisClient, surgePricing, setPlaceProvider(ctx, userQueryMongodbRepo, redisClient),
+		setMatchingStrategy(routeProvider, userQueryMongodbRepo, redisClient), setDriverSearch(), rideCommandUsecase)
+	fareRules, err := userUsecase.LoadFareRules(config.GetConfig().FareRulesPath, userQueryMongodbRepo, ctx)
+	if err != nil {
+		panic(err)
+	}
+	cityAreas, err := userUsecase.ParseCityAreas(config.GetConfig().CityAreas)
+	if err != nil {
+		panic(err)
+	}
+	pricingEngine := userUsecase.NewPricingEngine(fareRules, cityAreas)
+	userCommandUsecase := userUsecase.NewCommandUsecase(userQueryMongodbRepo, userCommandMongodbRepo, routeProvider, redisClient, pricingEngine, surgePricing, rideCommandUsecase)
+
 	driverQueryUsecase := driverUsecase.NewQueryUsecase(driverQueryMongodbRepo, redisClient)
-	driverCommandUsecase := driverUsecase.NewCommandUsecase(driverQueryMongodbRepo, driverCommandMongodbRepo, redisClient)
+	driverCommandUsecase := driverUsecase.NewCommandUsecase(driverMasterQueryMongodbRepo, driverCommandMongodbRepo, redisClient, rideCommandUsecase)
+
+	trackingHub := hub.NewHub(redisClient, constants.DriverTrackingChannel+"*")
+	runWorker(workers, func() { trackingHub.Run(ctx) })
 
-	userHandler.InituserHttpHandler(e, userQueryUsecase, userCommandUsecase)
+	idempotency := middlewares.Idempotency(redisClient, time.Duration(config.GetConfig().IdempotencyTTL)*time.Second)
+	userHandler.InituserHttpHandler(e, userQueryUsecase, userCommandUsecase, trackingHub, idempotency)
 	driverHandler.InitDriverHttpHandler(e, driverQueryUsecase, driverCommandUsecase)
+	rideHandler.InitRideHttpHandler(e, rideQueryUsecase, rideCommandUsecase)
+
+	outboxRelay := outbox.NewRelay(mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()), kafkaProducer, redisClient, log.GetLogger())
+	runWorker(workers, func() { outboxRelay.Run(ctx) })
+
+	runWorker(workers, func() { sweepStaleDrivers(ctx, driverCommandUsecase) })
+	runWorker(workers, func() { dispatchScheduledRides(ctx, userQueryUsecase) })
+	runWorker(workers, func() { advanceDispatches(ctx, driverCommandUsecase) })
+	setConsumer(ctx, workers, kafkaProducer, "driver-location", driverHandler.NewDriverLocationEventHandler(driverCommandUsecase))
+	setConsumer(ctx, workers, kafkaProducer, "request-ride", userHandler.NewRequestRideEventHandler(userCommandUsecase))
+	setConsumer(ctx, workers, kafkaProducer, "ride-cancelled", userHandler.NewRideCancelledEventHandler(userCommandUsecase))
+}
+
+// setIndexes creates the indexes the queries of the modules rely on, the place index is created with its provider
+func setIndexes(ctx context.Context) {
+	db := mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger())
+	indexes := []mongodb.CreateIndex{
+		{
+			CollectionName: "scheduled-ride",
+			Keys:           bson.D{{Key: "status", Value: 1}, {Key: "dispatchAt", Value: 1}},
+		},
+		{
+			CollectionName: "commute-offer",
+			Keys:           bson.D{{Key: "path", Value: "2dsphere"}},
+		},
+		{
+			CollectionName: "ride",
+			Keys:           bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			CollectionName: "ride",
+			Keys:           bson.D{{Key: "driverId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			CollectionName: "dispatch",
+			Keys:           bson.D{{Key: "status", Value: 1}, {Key: "dueAt", Value: 1}},
+		},
+		{
+			CollectionName: "dispatch",
+			Keys:           bson.D{{Key: "rideId", Value: 1}},
+		},
+		{
+			CollectionName: "commute-offer",
+			Keys:           bson.D{{Key: "driverId", Value: 1}, {Key: "departFrom", Value: -1}},
+		},
+		{
+			CollectionName: outbox.CollectionName,
+			Keys:           bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			// only sent events have a sentAt, pending and parked ones are kept
+			CollectionName: outbox.CollectionName,
+			Keys:           bson.D{{Key: "sentAt", Value: 1}},
+			ExpireAfter:    outbox.SentRetention,
+		},
+	}
+	for _, index := range indexes {
+		if err := db.CreateIndex(index, ctx); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func setConsumer(ctx context.Context, workers *sync.WaitGroup, kafkaProducer kafkaConfluent.Producer, topic string, handler kafkaConfluent.ConsumerHandler) {
+	consumer, err := kafkaConfluent.NewConsumer(kafkaConfluent.GetConfig().GetKafkaConfig(), log.GetLogger())
+	if err != nil {
+		panic(err)
+	}
+	consumer.SetHandler(handler)
+	consumer.SetDeadLetter(kafkaProducer)
+	consumer.Subscribe(topic)
+
+	runWorker(workers, func() {
+		<-ctx.Done()
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := consumer.Close(closeCtx); err != nil {
+			log.GetLogger().Error("main", fmt.Sprintf("Could not close consumer %s: %v", topic, err), "gracefull", "")
+		}
+	})
+}
+
+// setRouteProvider chains the providers listed in ROUTE_PROVIDERS, the ones without configuration are skipped,
+// the chain is cached in redis unless ROUTE_CACHE_DISABLED is set
+func setRouteProvider(redisClient goredis.UniversalClient) user.RouteProvider {
+	names := config.GetConfig().RouteProviders
+	if names == "" {
+		names = "google,osrm,estimator"
+	}
+
+	var providers []user.RouteProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "google":
+			if config.GetConfig().GoogleApiKey == "" {
+				log.GetLogger().Info("main", "Route provider google skipped, GOOGLE_API_KEY is empty", "setRouteProvider", "")
+				continue
+			}
+			google, err := userRouting.NewGoogleProvider(config.GetConfig().GoogleApiKey)
+			if err != nil {
+				panic(err)
+			}
+			providers = append(providers, google)
+		case "osrm":
+			if config.GetConfig().OsrmUrl == "" {
+				log.GetLogger().Info("main", "Route provider osrm skipped, OSRM_URL is empty", "setRouteProvider", "")
+				continue
+			}
+			providers = append(providers, userRouting.NewOSRMProvider(config.GetConfig().OsrmUrl, config.GetConfig().OsrmProfile))
+		case "estimator":
+			providers = append(providers, userRouting.NewEstimatorProvider(nil))
+		default:
+			panic(fmt.Sprintf("unknown route provider %q", name))
+		}
+	}
+	chain := userRouting.NewFallbackChain(providers...)
+	if config.GetConfig().RouteCacheDisabled {
+		return chain
+	}
+	return userRouting.NewCachedProvider(chain, redisClient,
+		time.Duration(config.GetConfig().RouteCacheTTL)*time.Second,
+		time.Duration(config.GetConfig().RouteCacheBucket)*time.Second)
+}
+
+// setPlaceProvider chains the providers listed in PLACE_PROVIDERS behind a redis cache, the local catalogue
+// comes first by default so Google is only asked for places it does not know
+func setPlaceProvider(ctx context.Context, mq user.MongodbRepositoryQuery, redisClient goredis.UniversalClient) user.PlaceProvider {
+	names := config.GetConfig().PlaceProviders
+	if names == "" {
+		names = "poi,google"
+	}
+
+	var providers []user.PlaceProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "poi":
+			err := mongodb.NewMongoDBLogger(mongodb.GetMasterConn(), mongodb.GetMasterDBName(), log.GetLogger()).CreateIndex(mongodb.CreateIndex{
+				CollectionName: "place",
+				Keys:           bson.D{{Key: "location", Value: "2dsphere"}},
+			}, ctx)
+			if err != nil {
+				panic(err)
+			}
+			providers = append(providers, userPlaces.NewPOIProvider(mq, placeSuggestionLimit))
+		case "google":
+			if config.GetConfig().GoogleApiKey == "" {
+				log.GetLogger().Info("main", "Place provider google skipped, GOOGLE_API_KEY is empty", "setPlaceProvider", "")
+				continue
+			}
+			google, err := userPlaces.NewGoogleProvider(config.GetConfig().GoogleApiKey, placeSuggestionLimit)
+			if err != nil {
+				panic(err)
+			}
+			providers = append(providers, google)
+		default:
+			panic(fmt.Sprintf("unknown place provider %q", name))
+		}
+	}
+	return userPlaces.NewCachedProvider(userPlaces.NewFallbackChain(providers...), redisClient,
+		time.Duration(config.GetConfig().PlaceCacheTTL)*time.Second)
+}
+
+// setMatchingStrategy picks how drivers are ranked for a ride from MATCHING_STRATEGY, scored by default
+func setMatchingStrategy(routeProvider user.RouteProvider, mq user.MongodbRepositoryQuery, redisClient goredis.UniversalClient) user.MatchingStrategy {
+	switch strings.TrimSpace(config.GetConfig().MatchingStrategy) {
+	case "", userUsecase.MatchingScored:
+		return userUsecase.NewScoredMatching(routeProvider, mq, redisClient, userUsecase.DefaultScoredMatchingWeights)
+	case userUsecase.MatchingNearest:
+		return userUsecase.NewNearestMatching()
+	default:
+		panic(fmt.Sprintf("unknown matching strategy %q", config.GetConfig().MatchingStrategy))
+	}
+}
+
+// setDriverSearch reads the widening driver search from DRIVER_SEARCH_STEPS, DRIVER_SEARCH_MIN_DRIVERS and
+// DRIVER_SEARCH_CITY_LIMITS
+func setDriverSearch() *userUsecase.DriverSearch {
+	spec := config.GetConfig().DriverSearchSteps
+	if strings.TrimSpace(spec) == "" {
+		spec = userUsecase.DefaultDriverSearchSteps
+	}
+	steps, err := userUsecase.ParseDriverSearchSteps(spec)
+	if err != nil {
+		panic(err)
+	}
+	cityLimits, err := userUsecase.ParseDriverSearchCityLimits(config.GetConfig().DriverSearchCities)
+	if err != nil {
+		panic(err)
+	}
+	minDrivers := config.GetConfig().DriverSearchMin
+	if minDrivers <= 0 {
+		minDrivers = userUsecase.DefaultDriverSearchMinDrivers
+	}
+	return userUsecase.NewDriverSearch(steps, minDrivers, cityLimits)
+}
+
+// setCancellationPolicy overrides the default cancellation policy with the CANCELLATION_* values that are set, 0 turns
+// the free window or a fee off
+func setCancellationPolicy() rideUsecase.CancellationPolicy {
+	policy := rideUsecase.DefaultCancellationPolicy
+	if window := config.GetConfig().CancellationWindow; window != nil {
+		policy.FreeWindow = time.Duration(*window) * time.Second
+	}
+	if baseFee := config.GetConfig().CancellationBaseFee; baseFee != nil {
+		policy.BaseFee = *baseFee
+	}
+	if feePerKm := config.GetConfig().CancellationFeePerKm; feePerKm != nil {
+		policy.FeePerKm = *feePerKm
+	}
+	if maxFee := config.GetConfig().CancellationMaxFee; maxFee != nil {
+		policy.MaxFee = *maxFee
+	}
+	if policy.FreeWindow < 0 || policy.BaseFee < 0 || policy.FeePerKm < 0 || policy.MaxFee < 0 {
+		panic(fmt.Sprintf("cancellation policy can not be negative: %+v", policy))
+	}
+	return policy
+}
+
+func runWorker(workers *sync.WaitGroup, worker func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		worker()
+	}()
+}
+
+func sweepStaleDrivers(ctx context.Context, uc driver.UsecaseCommand) {
+	staleAfter := time.Duration(config.GetConfig().DriverStaleTimeout) * time.Second
+	if staleAfter <= 0 {
+		staleAfter = 5 * time.Minute
+	}
+	interval := time.Duration(config.GetConfig().DriverSweepInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result := uc.SweepStaleDrivers(staleAfter, ctx)
+			if result.Error != nil {
+				log.GetLogger().Error("main", "Failed sweep stale drivers", "sweepStaleDrivers", utils.ConvertString(result.Error))
+				continue
+			}
+			if swept, _ := result.Data.([]string); len(swept) > 0 {
+				log.GetLogger().Info("main", fmt.Sprintf("%d stale drivers set offline", len(swept)), "sweepStaleDrivers", utils.ConvertString(swept))
+			}
+		}
+	}
+}
+
+func dispatchScheduledRides(ctx context.Context, uc user.UsecaseQuery) {
+	interval := time.Duration(config.GetConfig().SchedulerInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result := uc.DispatchScheduledRides(ctx)
+			if result.Error != nil {
+				log.GetLogger().Error("main", "Failed dispatch scheduled rides", "dispatchScheduledRides", utils.ConvertString(result.Error))
+				continue
+			}
+			if rides, _ := result.Data.([]userModels.ScheduledRide); len(rides) > 0 {
+				log.GetLogger().Info("main", fmt.Sprintf("%d scheduled rides dispatch attempted", len(rides)), "dispatchScheduledRides", utils.ConvertString(rides))
+			}
+		}
+	}
+}
+
+// advanceDispatches offers new dispatches and re-offers expired waves, every second since offers live a few seconds
+func advanceDispatches(ctx context.Context, uc driver.UsecaseCommand) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result := uc.AdvanceDispatches(ctx)
+			if result.Error != nil {
+				log.GetLogger().Error("main", "Failed advance dispatches", "advanceDispatches", utils.ConvertString(result.Error))
+			}
+		}
+	}
 }
@@ -55,6 +55,36 @@ type envConfig struct {
 	ElasticMaxRetries    int
 	GoogleApiKey         string
 	SocketUrl            string
+	DriverStaleTimeout   int
+	DriverSweepInterval  int
+	FareRulesPath        string
+	CityAreas            string
+	SurgeWindow          int
+	SurgeMaxMultiplier   float64
+	SurgeSmoothing       float64
+	RouteProviders       string
+	OsrmUrl              string
+	OsrmProfile          string
+	RouteCacheDisabled   bool
+	RouteCacheTTL        int
+	RouteCacheBucket     int
+	PlaceProviders       string
+	PlaceCacheTTL        int
+	ScheduledRideLead    int
+	SchedulerInterval    int
+	PoolMaxDetour        int
+	MatchingStrategy     string
+	DriverSearchSteps    string
+	DriverSearchMin      int
+	DriverSearchCities   string
+	DispatchWaveSize     int
+	DispatchOfferTTL     int
+	// the cancellation values are nil when not set, 0 is a valid value
+	CancellationWindow   *int
+	CancellationBaseFee  *float64
+	CancellationFeePerKm *float64
+	CancellationMaxFee   *float64
+	IdempotencyTTL       int
 }
 
 func (e envConfig) LogstashPortInt() int {
@@ -79,6 +109,24 @@ func (e envConfig) DnsMariaDB() (string, string) {
 
 var envCfg envConfig
 
+// optionalInt is nil when the variable is not set or not a number, so an unset value can be told from 0
+func optionalInt(key string) *int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// optionalFloat is nil when the variable is not set or not a number, so an unset value can be told from 0
+func optionalFloat(key string) *float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
 func init() {
 	err := godotenv.Load()
 
@@ -90,6 +138,22 @@ func init() {
 	minioUseSsl, _ := strconv.ParseBool(os.Getenv("MINIO_USE_SSL"))              // default false
 	UseRedis, _ := strconv.ParseBool(os.Getenv("REDIS_CONFIG_CLUSTER"))          // default false
 	elasticMaxRetries, _ := strconv.Atoi(os.Getenv("ELASTICSEARCH_MAX_RETRIES")) // default false
+	driverStaleTimeout, _ := strconv.Atoi(os.Getenv("DRIVER_STALE_TIMEOUT"))     // default 0, seconds
+	driverSweepInterval, _ := strconv.Atoi(os.Getenv("DRIVER_SWEEP_INTERVAL"))   // default 0, seconds
+	surgeWindow, _ := strconv.Atoi(os.Getenv("SURGE_WINDOW"))                    // default 0, seconds
+	surgeMaxMultiplier, _ := strconv.ParseFloat(os.Getenv("SURGE_MAX_MULTIPLIER"), 64)
+	surgeSmoothing, _ := strconv.ParseFloat(os.Getenv("SURGE_SMOOTHING"), 64)
+	routeCacheDisabled, _ := strconv.ParseBool(os.Getenv("ROUTE_CACHE_DISABLED")) // default false
+	routeCacheTTL, _ := strconv.Atoi(os.Getenv("ROUTE_CACHE_TTL"))                // default 0, seconds
+	routeCacheBucket, _ := strconv.Atoi(os.Getenv("ROUTE_CACHE_BUCKET"))          // default 0, seconds
+	placeCacheTTL, _ := strconv.Atoi(os.Getenv("PLACE_CACHE_TTL"))                // default 0, seconds
+	scheduledRideLead, _ := strconv.Atoi(os.Getenv("SCHEDULED_RIDE_LEAD_TIME"))   // default 0, seconds
+	schedulerInterval, _ := strconv.Atoi(os.Getenv("SCHEDULER_INTERVAL"))         // default 0, seconds
+	poolMaxDetour, _ := strconv.Atoi(os.Getenv("POOL_MAX_DETOUR"))                // default 0, seconds
+	driverSearchMin, _ := strconv.Atoi(os.Getenv("DRIVER_SEARCH_MIN_DRIVERS"))    // default 0
+	dispatchWaveSize, _ := strconv.Atoi(os.Getenv("DISPATCH_WAVE_SIZE"))          // default 0
+	dispatchOfferTTL, _ := strconv.Atoi(os.Getenv("DISPATCH_OFFER_TTL"))          // default 0, seconds
+	idempotencyTTL, _ := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL"))               // default 0, seconds
 
 	envCfg = envConfig{
 		APMSecretToken:       os.Getenv("ELASTIC_APM_SECRET_TOKEN"),
@@ -139,6 +203,48 @@ func init() {
 
 		GoogleApiKey: os.Getenv("GOOGLE_API_KEY"),
 		SocketUrl:    os.Getenv("SOCKET_URL"),
+
+		DriverStaleTimeout:  driverStaleTimeout,
+		DriverSweepInterval: driverSweepInterval,
+
+		FareRulesPath: os.Getenv("FARE_RULES_PATH"),
+		CityAreas:     os.Getenv("CITY_AREAS"),
+
+		SurgeWindow:        surgeWindow,
+		SurgeMaxMultiplier: surgeMaxMultiplier,
+		SurgeSmoothing:     surgeSmoothing,
+
+		RouteProviders: os.Getenv("ROUTE_PROVIDERS"),
+		OsrmUrl:        os.Getenv("OSRM_URL"),
+		OsrmProfile:    os.Getenv("OSRM_PROFILE"),
+
+		RouteCacheDisabled: routeCacheDisabled,
+		RouteCacheTTL:      routeCacheTTL,
+		RouteCacheBucket:   routeCacheBucket,
+
+		PlaceProviders: os.Getenv("PLACE_PROVIDERS"),
+		PlaceCacheTTL:  placeCacheTTL,
+
+		ScheduledRideLead: scheduledRideLead,
+		SchedulerInterval: schedulerInterval,
+
+		PoolMaxDetour: poolMaxDetour,
+
+		MatchingStrategy: os.Getenv("MATCHING_STRATEGY"),
+
+		DriverSearchSteps:  os.Getenv("DRIVER_SEARCH_STEPS"),
+		DriverSearchMin:    driverSearchMin,
+		DriverSearchCities: os.Getenv("DRIVER_SEARCH_CITY_LIMITS"),
+
+		DispatchWaveSize: dispatchWaveSize,
+		DispatchOfferTTL: dispatchOfferTTL,
+
+		CancellationWindow:   optionalInt("CANCELLATION_FREE_WINDOW"), // seconds
+		CancellationBaseFee:  optionalFloat("CANCELLATION_BASE_FEE"),
+		CancellationFeePerKm: optionalFloat("CANCELLATION_FEE_PER_KM"),
+		CancellationMaxFee:   optionalFloat("CANCELLATION_MAX_FEE"),
+
+		IdempotencyTTL: idempotencyTTL,
 	}
 }
 
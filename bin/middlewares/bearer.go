@@ -24,24 +24,39 @@ func decodeKey(secret string) (string, error) {
 func VerifyBearer(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		tokenString := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		return verifyToken(tokenString, next, c)
+	}
+}
 
+// VerifySocketBearer accepts the token from the "token" query param as well,
+// browsers cannot set the Authorization header on a websocket or event-stream request
+func VerifySocketBearer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tokenString := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
 		if len(tokenString) == 0 {
-			return utils.Response(nil, "Invalid token!", http.StatusUnauthorized, c)
+			tokenString = c.QueryParam("token")
 		}
+		return verifyToken(tokenString, next, c)
+	}
+}
 
-		publicKey, err := decodeKey(config.GetConfig().PublicKey)
-		if err != nil {
-			return utils.Response(nil, utils.ConvertString(err), http.StatusUnauthorized, c)
-		}
-		parsedToken := <-token.Validate(c.Request().Context(), publicKey, tokenString)
-		if parsedToken.Error != nil {
-			return utils.Response(nil, utils.ConvertString(parsedToken.Error), http.StatusUnauthorized, c)
-		}
-		data, _ := json.Marshal(parsedToken.Data)
-		jsonData := []byte(data)
-		var claim token.Claim
-		json.Unmarshal(jsonData, &claim)
-		c.Set("userId", claim.Sub)
-		return next(c)
+func verifyToken(tokenString string, next echo.HandlerFunc, c echo.Context) error {
+	if len(tokenString) == 0 {
+		return utils.Response(nil, "Invalid token!", http.StatusUnauthorized, c)
+	}
+
+	publicKey, err := decodeKey(config.GetConfig().PublicKey)
+	if err != nil {
+		return utils.Response(nil, utils.ConvertString(err), http.StatusUnauthorized, c)
+	}
+	parsedToken := <-token.Validate(c.Request().Context(), publicKey, tokenString)
+	if parsedToken.Error != nil {
+		return utils.Response(nil, utils.ConvertString(parsedToken.Error), http.StatusUnauthorized, c)
 	}
+	data, _ := json.Marshal(parsedToken.Data)
+	jsonData := []byte(data)
+	var claim token.Claim
+	json.Unmarshal(jsonData, &claim)
+	c.Set("userId", claim.Sub)
+	return next(c)
 }
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"location-service/bin/pkg/constants"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from the first request sent with the key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	// DefaultIdempotencyTTL is how long a response is replayed when IDEMPOTENCY_TTL is not set
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL frees the key of a request that died before its response was stored
+	idempotencyLockTTL      = time.Minute
+	idempotencyInProgress   = "in-progress"
+	maxIdempotencyKeyLength = 255
+)
+
+type idempotentResponse struct {
+	Route       string `json:"route"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// responseRecorder keeps a copy of the body written to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency runs a request sent with an Idempotency-Key header once and replays its response to every retry with
+// the same key within ttl. Keys belong to the user, so it goes after VerifyBearer. A server error is not stored, the
+// retry runs again.
+func Idempotency(rc redis.UniversalClient, ttl time.Duration) echo.MiddlewareFunc {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := strings.TrimSpace(c.Request().Header.Get(HeaderIdempotencyKey))
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				errObj := httpError.NewBadRequest()
+				errObj.Message = fmt.Sprintf("%s is longer than %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength)
+				return utils.ResponseError(errObj, c)
+			}
+
+			// the response is stored even when the client gave up waiting, its retry replays it
+			ctx := context.WithoutCancel(c.Request().Context())
+			route := c.Request().Method + " " + c.Path()
+			redisKey := fmt.Sprintf(constants.IdempotencyKey, utils.ConvertString(c.Get("userId")), key)
+			locked, err := rc.SetNX(ctx, redisKey, idempotencyInProgress, idempotencyLockTTL).Result()
+			if err != nil {
+				// the request runs unprotected rather than not at all
+				log.GetLogger().Error("middleware", fmt.Sprintf("Failed lock idempotency key: %v", err), "Idempotency", utils.ConvertString(err))
+				return next(c)
+			}
+			if !locked {
+				return replayResponse(rc, redisKey, route, ctx, c)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			if err := next(c); err != nil || c.Response().Status >= http.StatusInternalServerError {
+				rc.Del(ctx, redisKey)
+				return err
+			}
+			stored, _ := json.Marshal(idempotentResponse{
+				Route:       route,
+				Status:      c.Response().Status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			})
+			if err := rc.Set(ctx, redisKey, stored, ttl).Err(); err != nil {
+				log.GetLogger().Error("middleware", fmt.Sprintf("Failed store idempotent response: %v", err), "Idempotency", utils.ConvertString(err))
+				rc.Del(ctx, redisKey)
+			}
+			return nil
+		}
+	}
+}
+
+func replayResponse(rc redis.UniversalClient, redisKey string, route string, ctx context.Context, c echo.Context) error {
+	stored, err := rc.Get(ctx, redisKey).Result()
+	if err != nil || stored == idempotencyInProgress {
+		// the first request is still running, or it just failed and freed the key
+		errObj := httpError.NewConflict()
+		errObj.Message = "Request with the same Idempotency-Key is still running, please try again"
+		return utils.ResponseError(errObj, c)
+	}
+	var response idempotentResponse
+	if err := json.Unmarshal([]byte(stored), &response); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed read idempotent response: %v", err)
+		return utils.ResponseError(errObj, c)
+	}
+	if response.Route != route {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = "Idempotency-Key was already used for another request"
+		return utils.ResponseError(errObj, c)
+	}
+
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	return c.Blob(response.Status, response.ContentType, response.Body)
+}
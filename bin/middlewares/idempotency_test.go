@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis keeps the keys the idempotency middleware reads and writes in memory
+type fakeRedis struct {
+	redis.UniversalClient
+	values map[string]string
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if _, ok := f.values[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	f.values[key] = value.(string)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	f.values[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	value, ok := f.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (f *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(f.values, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func serveIdempotent(e *echo.Echo, path string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func newIdempotentServer(status *int) (*echo.Echo, *int) {
+	calls := 0
+	e := echo.New()
+	setUser := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("userId", "rider1")
+			return next(c)
+		}
+	}
+	handler := func(c echo.Context) error {
+		calls++
+		return c.JSON(*status, map[string]int{"calls": calls})
+	}
+	idempotency := Idempotency(&fakeRedis{values: map[string]string{}}, time.Minute)
+	e.GET("/find-driver", handler, setUser, idempotency)
+	e.GET("/find-pool", handler, setUser, idempotency)
+	return e, &calls
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	status := http.StatusOK
+	e, calls := newIdempotentServer(&status)
+
+	first := serveIdempotent(e, "/find-driver", "key1")
+	second := serveIdempotent(e, "/find-driver", "key1")
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+
+	serveIdempotent(e, "/find-driver", "")
+	assert.Equal(t, 2, *calls)
+	assert.Equal(t, http.StatusBadRequest, serveIdempotent(e, "/find-pool", "key1").Code)
+}
+
+func TestIdempotencyRetriesServerError(t *testing.T) {
+	status := http.StatusInternalServerError
+	e, calls := newIdempotentServer(&status)
+
+	serveIdempotent(e, "/find-driver", "key1")
+	status = http.StatusOK
+	retry := serveIdempotent(e, "/find-driver", "key1")
+
+	assert.Equal(t, 2, *calls)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Empty(t, retry.Header().Get(HeaderIdempotentReplayed))
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"location-service/bin/config"
+	driver "location-service/bin/modules/driver"
+	"location-service/bin/modules/driver/models"
+	httpError "location-service/bin/pkg/http-error"
+	kafkaPkgConfluent "location-service/bin/pkg/kafka/confluent"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+
+	k "gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type driverLocationEventHandler struct {
+	driverUseCaseCommand driver.UsecaseCommand
+}
+
+// NewDriverLocationEventHandler handles the driver-location topic produced by the gateways
+func NewDriverLocationEventHandler(uc driver.UsecaseCommand) kafkaPkgConfluent.ConsumerHandler {
+	return &driverLocationEventHandler{
+		driverUseCaseCommand: uc,
+	}
+}
+
+func (h driverLocationEventHandler) HandleMessage(message *k.Message) error {
+	var event models.DriverLocationEvent
+	if err := json.Unmarshal(message.Value, &event); err != nil {
+		return fmt.Errorf("%w: driver-location payload: %v", kafkaPkgConfluent.ErrInvalidMessage, err)
+	}
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("%w: driver-location validation error: %v", kafkaPkgConfluent.ErrInvalidMessage, err)
+	}
+
+	// a position older than the stale window would put back a driver the sweeper already set offline
+	staleAfter := time.Duration(config.GetConfig().DriverStaleTimeout) * time.Second
+	if !event.Timestamp.IsZero() && staleAfter > 0 && time.Since(event.Timestamp) > staleAfter {
+		log.GetLogger().Info("event_handler", "Stale driver-location dropped", "HandleMessage", string(message.Value))
+		return nil
+	}
+
+	result := h.driverUseCaseCommand.UpdateLocation(event.DriverID, models.LocationRequest{
+		Longitude: event.Longitude,
+		Latitude:  event.Latitude,
+	}, context.Background())
+	switch err := result.Error.(type) {
+	case nil:
+		return nil
+	case httpError.InternalServerErrorData:
+		return fmt.Errorf("update driver location: %s", err.Message)
+	default:
+		// the driver is unknown or not working, same as the http endpoint rejecting the request
+		log.GetLogger().Info("event_handler", "Driver-location rejected", "HandleMessage", utils.ConvertString(err))
+		return nil
+	}
+}
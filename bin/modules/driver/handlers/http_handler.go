@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"location-service/bin/middlewares"
 	driver "location-service/bin/modules/driver"
 	"location-service/bin/modules/driver/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
 	"location-service/bin/pkg/utils"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
 )
 
 type driverHttpHandler struct {
@@ -22,6 +28,15 @@ func InitDriverHttpHandler(e *echo.Echo, uq driver.UsecaseQuery, uc driver.Useca
 	}
 	route := e.Group("/driver")
 	route.POST("/v1/activate-beacon", handler.ActivateBeacon, middlewares.VerifyBearer)
+	route.POST("/v1/location", handler.UpdateLocation, middlewares.VerifyBearer)
+	route.GET("/v1/ws", handler.StreamLocation, middlewares.VerifySocketBearer)
+	route.PUT("/v1/pool-trip", handler.OpenPoolTrip, middlewares.VerifyBearer)
+	route.DELETE("/v1/pool-trip", handler.ClosePoolTrip, middlewares.VerifyBearer)
+	route.GET("/v1/commute-offers", handler.GetCommuteOffers, middlewares.VerifyBearer)
+	route.POST("/v1/commute-offers", handler.CreateCommuteOffer, middlewares.VerifyBearer)
+	route.DELETE("/v1/commute-offers/:id", handler.CloseCommuteOffer, middlewares.VerifyBearer)
+	route.POST("/v1/offers/:id/accept", handler.AcceptOffer, middlewares.VerifyBearer)
+	route.POST("/v1/offers/:id/reject", handler.RejectOffer, middlewares.VerifyBearer)
 
 }
 
@@ -44,3 +59,176 @@ func (u driverHttpHandler) ActivateBeacon(c echo.Context) error {
 
 	return utils.Response(result.Data, "update beacon", 200, c)
 }
+
+func (u driverHttpHandler) UpdateLocation(c echo.Context) error {
+	var request models.LocationRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.UpdateLocation(userId, request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "update location", 200, c)
+}
+
+func (u driverHttpHandler) OpenPoolTrip(c echo.Context) error {
+	var request models.PoolTripRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.OpenPoolTrip(userId, request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "open pool trip", 200, c)
+}
+
+func (u driverHttpHandler) ClosePoolTrip(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.ClosePoolTrip(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "close pool trip", 200, c)
+}
+
+func (u driverHttpHandler) GetCommuteOffers(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUsecaseQuery.GetCommuteOffers(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get commute offers", 200, c)
+}
+
+func (u driverHttpHandler) CreateCommuteOffer(c echo.Context) error {
+	var request models.CommuteOfferRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.CreateCommuteOffer(userId, request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "create commute offer", 200, c)
+}
+
+func (u driverHttpHandler) CloseCommuteOffer(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.CloseCommuteOffer(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "close commute offer", 200, c)
+}
+
+func (u driverHttpHandler) AcceptOffer(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.AcceptOffer(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "accept offer", 200, c)
+}
+
+func (u driverHttpHandler) RejectOffer(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.driverUseCaseCommand.RejectOffer(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "reject offer", 200, c)
+}
+
+// StreamLocation keeps a websocket open for the driver app, every message is a location update
+func (u driverHttpHandler) StreamLocation(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	ctx := c.Request().Context()
+
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		for {
+			var message string
+			if err := websocket.Message.Receive(ws, &message); err != nil {
+				if err != io.EOF {
+					log.GetLogger().Error("http_handler", fmt.Sprintf("Failed receive driver location: %v", err), "StreamLocation", utils.ConvertString(err))
+				}
+				return
+			}
+
+			var request models.LocationRequest
+			if err := json.Unmarshal([]byte(message), &request); err != nil {
+				socketReply(ws, utils.Result{Error: httpError.BadRequest(fmt.Sprintf("Invalid location message: %v", err))})
+				continue
+			}
+			if err := request.Validate(); err != nil {
+				socketReply(ws, utils.Result{Error: httpError.BadRequest(fmt.Sprintf("Request validation error: %v", err.Error()))})
+				continue
+			}
+
+			socketReply(ws, u.driverUseCaseCommand.UpdateLocation(userId, request, ctx))
+		}
+	}}.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
+
+func socketReply(ws *websocket.Conn, result utils.Result) {
+	reply := utils.BaseWrapperModel{
+		Success: true,
+		Data:    result.Data,
+		Message: "update location",
+		Code:    200,
+	}
+	if result.Error != nil {
+		errObj := utils.ErrorStatusCode(result.Error)
+		reply = utils.BaseWrapperModel{
+			Success: false,
+			Data:    errObj.Data,
+			Message: errObj.Message,
+			Code:    errObj.Code,
+		}
+	}
+	websocket.JSON.Send(ws, reply)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CommuteOfferOpen   = "open"
+	CommuteOfferClosed = "closed"
+
+	// MaxCommuteOfferAhead is how far in the future a commute can be offered
+	MaxCommuteOfferAhead = 7 * 24 * time.Hour
+)
+
+// GeoJSONLineString is a mongo geo line, every coordinate is longitude then latitude
+type GeoJSONLineString struct {
+	Type        string      `json:"type" bson:"type"`
+	Coordinates [][]float64 `json:"coordinates" bson:"coordinates"`
+}
+
+func NewGeoJSONLineString(points []LocationRequest) GeoJSONLineString {
+	coordinates := make([][]float64, 0, len(points))
+	for _, point := range points {
+		coordinates = append(coordinates, []float64{point.Longitude, point.Latitude})
+	}
+	return GeoJSONLineString{
+		Type:        "LineString",
+		Coordinates: coordinates,
+	}
+}
+
+// CommuteOfferRequest is a trip the driver plans anyway, Route is the path from start to end in driving order
+type CommuteOfferRequest struct {
+	Route       []LocationRequest `json:"route" validate:"required,min=2,max=200,dive"`
+	DepartFrom  time.Time         `json:"departFrom" validate:"required"`
+	DepartUntil time.Time         `json:"departUntil" validate:"required,gtfield=DepartFrom"`
+	Seats       int               `json:"seats" validate:"required,min=1,max=6"`
+}
+
+func (r *CommuteOfferRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// CommuteOffer is a published commute, Path has a 2dsphere index for the rider search
+type CommuteOffer struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DriverId    string             `json:"driverId" bson:"driverId"`
+	Path        GeoJSONLineString  `json:"path" bson:"path"`
+	DepartFrom  time.Time          `json:"departFrom" bson:"departFrom"`
+	DepartUntil time.Time          `json:"departUntil" bson:"departUntil"`
+	Seats       int                `json:"seats" bson:"seats"`
+	Status      string             `json:"status" bson:"status"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DispatchSearching is a dispatch created by the rider search, its first wave is offered by the dispatch worker
+	DispatchSearching = "searching"
+	DispatchOffered   = "offered"
+	DispatchAssigned  = "assigned"
+	// DispatchExhausted is a dispatch every candidate rejected or let expire
+	DispatchExhausted = "exhausted"
+	// DispatchCancelled is a dispatch whose ride was cancelled, set by the ride module
+	DispatchCancelled = "cancelled"
+
+	OfferPending  = "pending"
+	OfferAccepted = "accepted"
+	OfferRejected = "rejected"
+	OfferExpired  = "expired"
+	// OfferWithdrawn is a pending offer of the wave another driver accepted first
+	OfferWithdrawn = "withdrawn"
+)
+
+var (
+	ErrOfferNotFound = errors.New("offer not found")
+	ErrOfferClosed   = errors.New("offer is no longer open")
+)
+
+// DispatchOffer is the ride offered to one driver, Wave is the dispatch wave it was sent in
+type DispatchOffer struct {
+	DriverId    string     `json:"driverId" bson:"driverId"`
+	Wave        int        `json:"wave" bson:"wave"`
+	Status      string     `json:"status" bson:"status"`
+	OfferedAt   time.Time  `json:"offeredAt" bson:"offeredAt"`
+	ExpiresAt   time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+}
+
+// Dispatch offers a ride to the ranked Candidates WaveSize at a time until one accepts. It is created by the user
+// module and saved with optimistic locking on Version. DueAt is when the worker has to move it on: the first wave
+// of a searching dispatch, or the expiry of the current wave.
+type Dispatch struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId     string             `json:"userId" bson:"userId"`
+	RideId     string             `json:"rideId,omitempty" bson:"rideId,omitempty"`
+	Request    string             `json:"-" bson:"request"`
+	Candidates []string           `json:"candidates" bson:"candidates"`
+	Next       int                `json:"next" bson:"next"`
+	WaveSize   int                `json:"waveSize" bson:"waveSize"`
+	OfferTTL   time.Duration      `json:"offerTtl" bson:"offerTtl"`
+	Wave       int                `json:"wave" bson:"wave"`
+	Offers     []DispatchOffer    `json:"offers" bson:"offers"`
+	Status     string             `json:"status" bson:"status"`
+	DriverId   string             `json:"driverId,omitempty" bson:"driverId,omitempty"`
+	DueAt      time.Time          `json:"dueAt" bson:"dueAt"`
+	Version    int                `json:"version" bson:"version"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+	AssignedAt *time.Time         `json:"assignedAt,omitempty" bson:"assignedAt,omitempty"`
+}
+
+// RideOfferEvent is the ride-offer event, keyed by driver
+type RideOfferEvent struct {
+	DispatchId string          `json:"dispatchId"`
+	UserId     string          `json:"userId"`
+	DriverId   string          `json:"driverId"`
+	ExpiresAt  time.Time       `json:"expiresAt"`
+	Request    json.RawMessage `json:"request"`
+}
+
+// RideAssignedEvent is the ride-assigned event, keyed by rider. DriverId is empty when no candidate took the ride.
+type RideAssignedEvent struct {
+	DispatchId string          `json:"dispatchId"`
+	UserId     string          `json:"userId"`
+	DriverId   string          `json:"driverId"`
+	Status     string          `json:"status"`
+	AssignedAt *time.Time      `json:"assignedAt,omitempty"`
+	Request    json.RawMessage `json:"request"`
+}
+
+// Advance moves a due dispatch on: a searching dispatch offers its first wave, an offered one expires the pending
+// offers of the wave and offers the next. It returns the drivers of the new wave.
+func (d *Dispatch) Advance(now time.Time) []string {
+	switch d.Status {
+	case DispatchSearching:
+		return d.offerNextWave(now)
+	case DispatchOffered:
+		if now.Before(d.DueAt) {
+			return nil
+		}
+		for i := range d.Offers {
+			if d.Offers[i].Status == OfferPending {
+				d.respond(i, OfferExpired, now)
+			}
+		}
+		return d.offerNextWave(now)
+	}
+	return nil
+}
+
+// Accept assigns the ride to the driver of an open offer and withdraws the other offers of the wave
+func (d *Dispatch) Accept(driverId string, now time.Time) error {
+	i, err := d.openOffer(driverId, now)
+	if err != nil {
+		return err
+	}
+	d.respond(i, OfferAccepted, now)
+	for j := range d.Offers {
+		if d.Offers[j].Status == OfferPending {
+			d.respond(j, OfferWithdrawn, now)
+		}
+	}
+	d.Status = DispatchAssigned
+	d.DriverId = driverId
+	d.AssignedAt = &now
+	d.UpdatedAt = now
+	return nil
+}
+
+// Reject declines an open offer, the next wave is offered once nobody of the wave is left to answer.
+// It returns the drivers of the new wave.
+func (d *Dispatch) Reject(driverId string, now time.Time) ([]string, error) {
+	i, err := d.openOffer(driverId, now)
+	if err != nil {
+		return nil, err
+	}
+	d.respond(i, OfferRejected, now)
+	for _, offer := range d.Offers {
+		if offer.Status == OfferPending {
+			d.UpdatedAt = now
+			return nil, nil
+		}
+	}
+	return d.offerNextWave(now), nil
+}
+
+func (d *Dispatch) openOffer(driverId string, now time.Time) (int, error) {
+	for i := len(d.Offers) - 1; i >= 0; i-- {
+		offer := d.Offers[i]
+		if offer.DriverId != driverId {
+			continue
+		}
+		if d.Status != DispatchOffered || offer.Status != OfferPending || !now.Before(offer.ExpiresAt) {
+			return i, ErrOfferClosed
+		}
+		return i, nil
+	}
+	return -1, ErrOfferNotFound
+}
+
+func (d *Dispatch) respond(i int, status string, now time.Time) {
+	d.Offers[i].Status = status
+	d.Offers[i].RespondedAt = &now
+}
+
+func (d *Dispatch) offerNextWave(now time.Time) []string {
+	d.UpdatedAt = now
+	if d.Next >= len(d.Candidates) {
+		d.Status = DispatchExhausted
+		return nil
+	}
+	waveSize := d.WaveSize
+	if waveSize <= 0 {
+		waveSize = 1
+	}
+	end := d.Next + waveSize
+	if end > len(d.Candidates) {
+		end = len(d.Candidates)
+	}
+	wave := d.Candidates[d.Next:end]
+	d.Next = end
+	d.Wave++
+	d.Status = DispatchOffered
+	d.DueAt = now.Add(d.OfferTTL)
+	for _, driverId := range wave {
+		d.Offers = append(d.Offers, DispatchOffer{
+			DriverId:  driverId,
+			Wave:      d.Wave,
+			Status:    OfferPending,
+			OfferedAt: now,
+			ExpiresAt: d.DueAt,
+		})
+	}
+	return wave
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDispatch(waveSize int) Dispatch {
+	return Dispatch{
+		UserId:     "rider1",
+		Candidates: []string{"driver1", "driver2", "driver3"},
+		WaveSize:   waveSize,
+		OfferTTL:   15 * time.Second,
+		Status:     DispatchSearching,
+	}
+}
+
+func TestDispatchOffersOneDriverAtATime(t *testing.T) {
+	now := time.Now()
+	dispatch := newTestDispatch(1)
+
+	assert.Equal(t, []string{"driver1"}, dispatch.Advance(now))
+	assert.Equal(t, DispatchOffered, dispatch.Status)
+	assert.Equal(t, now.Add(15*time.Second), dispatch.DueAt)
+
+	// not due yet
+	assert.Nil(t, dispatch.Advance(now.Add(5*time.Second)))
+
+	wave, err := dispatch.Reject("driver1", now.Add(5*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"driver2"}, wave)
+
+	assert.Equal(t, []string{"driver3"}, dispatch.Advance(now.Add(30*time.Second)))
+	assert.Equal(t, OfferExpired, dispatch.Offers[1].Status)
+
+	assert.NoError(t, dispatch.Accept("driver3", now.Add(31*time.Second)))
+	assert.Equal(t, DispatchAssigned, dispatch.Status)
+	assert.Equal(t, "driver3", dispatch.DriverId)
+	assert.Equal(t, 3, dispatch.Wave)
+}
+
+func TestDispatchWaveAcceptWithdrawsOthers(t *testing.T) {
+	now := time.Now()
+	dispatch := newTestDispatch(2)
+	assert.Equal(t, []string{"driver1", "driver2"}, dispatch.Advance(now))
+
+	assert.NoError(t, dispatch.Accept("driver2", now.Add(time.Second)))
+	assert.Equal(t, OfferWithdrawn, dispatch.Offers[0].Status)
+	assert.Equal(t, OfferAccepted, dispatch.Offers[1].Status)
+
+	assert.ErrorIs(t, dispatch.Accept("driver1", now.Add(2*time.Second)), ErrOfferClosed)
+	assert.ErrorIs(t, dispatch.Accept("driver3", now.Add(2*time.Second)), ErrOfferNotFound)
+}
+
+func TestDispatchExhausted(t *testing.T) {
+	now := time.Now()
+	dispatch := newTestDispatch(2)
+	dispatch.Advance(now)
+
+	_, err := dispatch.Reject("driver1", now)
+	assert.NoError(t, err)
+	// driver2 has not answered yet, the wave is still open
+	assert.Equal(t, DispatchOffered, dispatch.Status)
+
+	assert.Equal(t, []string{"driver3"}, dispatch.Advance(now.Add(15*time.Second)))
+	assert.ErrorIs(t, dispatch.Accept("driver2", now.Add(16*time.Second)), ErrOfferClosed)
+
+	wave, err := dispatch.Reject("driver3", now.Add(16*time.Second))
+	assert.NoError(t, err)
+	assert.Empty(t, wave)
+	assert.Equal(t, DispatchExhausted, dispatch.Status)
+}
@@ -16,7 +16,27 @@ type User struct {
 type BeaconRequest struct {
 	Longitude float64 `json:"longitude" validate:"required"`
 	Latitude  float64 `json:"latitude" validate:"required"`
-	Status    string  `json:"status" validate:"required"`
+	Status    string  `json:"status" validate:"required,oneof=offline available on-trip break"`
+}
+
+type LocationRequest struct {
+	Longitude float64 `json:"longitude" validate:"required,longitude"`
+	Latitude  float64 `json:"latitude" validate:"required,latitude"`
+}
+
+type DriverLocation struct {
+	DriverID  string    `json:"driverId"`
+	Status    string    `json:"status"`
+	Longitude float64   `json:"longitude"`
+	Latitude  float64   `json:"latitude"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type DriverLocationEvent struct {
+	DriverID  string    `json:"driverId" validate:"required"`
+	Longitude float64   `json:"longitude" validate:"required,longitude"`
+	Latitude  float64   `json:"latitude" validate:"required,latitude"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type WorkLog struct {
@@ -35,3 +55,58 @@ func (r *BeaconRequest) Validate() error {
 	validate := validator.New()
 	return validate.Struct(r)
 }
+
+func (r *DriverLocationEvent) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+func (r *LocationRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+const (
+	PoolStopPickup  = "pickup"
+	PoolStopDropoff = "dropoff"
+)
+
+// PoolStop is a pickup or a dropoff still ahead of a driver on a trip
+type PoolStop struct {
+	UserId   string          `json:"userId" validate:"required"`
+	Kind     string          `json:"kind" validate:"required,oneof=pickup dropoff"`
+	Location LocationRequest `json:"location" validate:"required"`
+}
+
+// PoolTripRequest opens the current trip of the driver to pooling, Stops are the remaining stops in driving order.
+// A rider with a dropoff and no pickup in Stops is on board.
+type PoolTripRequest struct {
+	Capacity int        `json:"capacity" validate:"required,min=1,max=6"`
+	Stops    []PoolStop `json:"stops" validate:"max=12,dive"`
+}
+
+type PoolTrip struct {
+	DriverId  string     `json:"driverId"`
+	Capacity  int        `json:"capacity"`
+	Stops     []PoolStop `json:"stops"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func (r *PoolTripRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// OnBoard counts the riders in the car before the first stop
+func (r PoolTripRequest) OnBoard() int {
+	onBoard := 0
+	pickedUp := map[string]bool{}
+	for _, stop := range r.Stops {
+		if stop.Kind == PoolStopPickup {
+			pickedUp[stop.UserId] = true
+		} else if !pickedUp[stop.UserId] {
+			onBoard++
+		}
+	}
+	return onBoard
+}
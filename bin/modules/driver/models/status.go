@@ -0,0 +1,53 @@
+package models
+
+const (
+	StatusOffline   = "offline"
+	StatusAvailable = "available"
+	StatusOnTrip    = "on-trip"
+	StatusBreak     = "break"
+
+	// statusLegacyWork is the status written by beacons before the state machine existed
+	statusLegacyWork = "work"
+)
+
+var statusTransitions = map[string][]string{
+	StatusOffline:   {StatusAvailable},
+	StatusAvailable: {StatusOffline, StatusOnTrip, StatusBreak},
+	StatusOnTrip:    {StatusAvailable},
+	StatusBreak:     {StatusAvailable, StatusOffline},
+}
+
+// NormalizeStatus maps stored statuses to the current state set, an empty status means offline
+func NormalizeStatus(status string) string {
+	switch status {
+	case "":
+		return StatusOffline
+	case statusLegacyWork:
+		return StatusAvailable
+	}
+	return status
+}
+
+// CanTransition reports whether a driver in status from may move to status to
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[NormalizeStatus(from)] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveStatus reports whether the status counts as working time in the work-log
+func IsActiveStatus(status string) bool {
+	status = NormalizeStatus(status)
+	return status == StatusAvailable || status == StatusOnTrip
+}
+
+// CurrentStatus returns the status of the last activity in the work-log
+func (w WorkLog) CurrentStatus() string {
+	if len(w.Log) == 0 {
+		return StatusOffline
+	}
+	return NormalizeStatus(w.Log[len(w.Log)-1].Status)
+}
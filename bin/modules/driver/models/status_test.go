@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(StatusOffline, StatusAvailable))
+	assert.True(t, CanTransition(StatusAvailable, StatusOnTrip))
+	assert.True(t, CanTransition(StatusOnTrip, StatusAvailable))
+	assert.True(t, CanTransition(StatusBreak, StatusOffline))
+	assert.True(t, CanTransition("work", StatusBreak))
+
+	assert.False(t, CanTransition(StatusOffline, StatusOnTrip))
+	assert.False(t, CanTransition(StatusOnTrip, StatusOffline))
+	assert.False(t, CanTransition(StatusBreak, StatusOnTrip))
+	assert.False(t, CanTransition(StatusAvailable, "work"))
+}
+
+func TestWorkLogCurrentStatus(t *testing.T) {
+	assert.Equal(t, StatusOffline, WorkLog{}.CurrentStatus())
+
+	workLog := WorkLog{Log: []LogActivity{
+		{WorkTime: time.Now(), Status: StatusAvailable},
+		{WorkTime: time.Now(), Status: StatusBreak},
+	}}
+	assert.Equal(t, StatusBreak, workLog.CurrentStatus())
+
+	legacy := WorkLog{Log: []LogActivity{{WorkTime: time.Now(), Status: "work"}}}
+	assert.Equal(t, StatusAvailable, legacy.CurrentStatus())
+}
@@ -2,10 +2,12 @@ package commands
 
 import (
 	"context"
+	"time"
 
 	user "location-service/bin/modules/driver"
 	"location-service/bin/modules/driver/models"
 	"location-service/bin/pkg/databases/mongodb"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -47,6 +49,7 @@ func (c commandMongodbRepository) UpsertBeacon(data models.WorkLog, ctx context.
 			output <- utils.Result{
 				Error: err,
 			}
+			return
 		}
 
 		output <- utils.Result{
@@ -57,3 +60,199 @@ func (c commandMongodbRepository) UpsertBeacon(data models.WorkLog, ctx context.
 
 	return output
 }
+
+func (c commandMongodbRepository) InsertCommuteOffer(offer models.CommuteOffer, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		offer.ID = primitive.NewObjectID()
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: "commute-offer",
+			Document:       offer,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: offer,
+		}
+
+	}()
+
+	return output
+}
+
+// CloseCommuteOffer returns whether an open offer of the driver was closed
+func (c commandMongodbRepository) CloseCommuteOffer(driverId string, offerId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		id, err := primitive.ObjectIDFromHex(offerId)
+		if err != nil {
+			output <- utils.Result{
+				Data: false,
+			}
+			return
+		}
+
+		var matched int64
+		err = c.mongoDb.UpdateOne(mongodb.UpdateOne{
+			Result:         &matched,
+			CollectionName: "commute-offer",
+			Filter: bson.M{
+				"_id":      id,
+				"driverId": driverId,
+				"status":   models.CommuteOfferOpen,
+			},
+			Document: bson.M{
+				"status":    models.CommuteOfferClosed,
+				"updatedAt": time.Now(),
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
+
+// UpdateDispatch saves the dispatch if nobody saved it since it was read at version, Data is false otherwise
+func (c commandMongodbRepository) UpdateDispatch(dispatch models.Dispatch, version int, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var matched int64
+		dispatch.Version = version + 1
+		err := c.mongoDb.UpdateOne(mongodb.UpdateOne{
+			Result:         &matched,
+			CollectionName: "dispatch",
+			Filter: bson.M{
+				"_id":     dispatch.ID,
+				"version": version,
+			},
+			Document: dispatch,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
+
+// CancelRideDispatch stops the driver search of the ride if it is still searching or offering, Data is whether it was.
+// The version bump makes the dispatch worker or a driver answer holding the previous version lose their save.
+func (c commandMongodbRepository) CancelRideDispatch(rideId string, now time.Time, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var matched int64
+		err := c.mongoDb.ModifyOne(mongodb.ModifyOne{
+			Result:         &matched,
+			CollectionName: "dispatch",
+			Filter: bson.M{
+				"rideId": rideId,
+				"status": bson.M{"$in": []string{models.DispatchSearching, models.DispatchOffered}},
+			},
+			Update: bson.M{
+				"$set": bson.M{"status": models.DispatchCancelled, "updatedAt": now},
+				"$inc": bson.M{"version": 1},
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: outbox.CollectionName,
+			Document:       event,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: event,
+		}
+
+	}()
+
+	return output
+}
+
+// IncrementDriverStats adds to the offer counters the matching strategy reads the acceptance rate from
+func (c commandMongodbRepository) IncrementDriverStats(driverId string, offersReceived int, offersAccepted int, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.IncrementOne(mongodb.IncrementOne{
+			CollectionName: "driver-stats",
+			Filter: bson.M{
+				"driverId": driverId,
+			},
+			Fields: bson.M{
+				"offersReceived": offersReceived,
+				"offersAccepted": offersAccepted,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: driverId,
+		}
+
+	}()
+
+	return output
+}
@@ -2,8 +2,10 @@ package queries
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	driver "location-service/bin/modules/driver"
 	"location-service/bin/modules/driver/models"
@@ -39,6 +41,7 @@ func (q queryMongodbRepository) FindDriver(userId string, ctx context.Context) <
 			output <- utils.Result{
 				Error: err,
 			}
+			return
 		}
 
 		output <- utils.Result{
@@ -69,11 +72,13 @@ func (q queryMongodbRepository) FindWorkLog(driverId string, date string, ctx co
 			output <- utils.Result{
 				Error: err,
 			}
+			return
 		}
 		if workLog.DriverID == "" {
 			output <- utils.Result{
 				Error: "notfound",
 			}
+			return
 		}
 		output <- utils.Result{
 			Data: workLog,
@@ -83,3 +88,143 @@ func (q queryMongodbRepository) FindWorkLog(driverId string, date string, ctx co
 
 	return output
 }
+
+func (q queryMongodbRepository) FindCommuteOffers(driverId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+
+		var offers []models.CommuteOffer
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &offers,
+			CollectionName: "commute-offer",
+			Filter: bson.M{
+				"driverId": driverId,
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "departFrom",
+				By:        mongodb.SortDescending,
+			},
+			Page: 1,
+			Size: 50,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: offers,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindDispatch(dispatchId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var dispatch models.Dispatch
+		id, err := primitive.ObjectIDFromHex(dispatchId)
+		if err != nil {
+			output <- utils.Result{
+				Data: dispatch,
+			}
+			return
+		}
+
+		err = q.mongoDb.FindOne(mongodb.FindOne{
+			Result:         &dispatch,
+			CollectionName: "dispatch",
+			Filter: bson.M{
+				"_id": id,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: dispatch,
+		}
+
+	}()
+
+	return output
+}
+
+// FindRideDispatch returns the dispatch of the ride, empty when the driver search never started
+func (q queryMongodbRepository) FindRideDispatch(rideId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var dispatch models.Dispatch
+		err := q.mongoDb.FindOne(mongodb.FindOne{
+			Result:         &dispatch,
+			CollectionName: "dispatch",
+			Filter: bson.M{
+				"rideId": rideId,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: dispatch,
+		}
+
+	}()
+
+	return output
+}
+
+// FindDueDispatches returns the dispatches waiting for a first wave or with an expired wave, the oldest first
+func (q queryMongodbRepository) FindDueDispatches(now time.Time, limit int64, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var dispatches []models.Dispatch
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &dispatches,
+			CollectionName: "dispatch",
+			Filter: bson.M{
+				"status": bson.M{"$in": []string{models.DispatchSearching, models.DispatchOffered}},
+				"dueAt":  bson.M{"$lte": now},
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "dueAt",
+				By:        mongodb.SortAscending,
+			},
+			Page: 1,
+			Size: limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: dispatches,
+		}
+
+	}()
+
+	return output
+}
@@ -2,30 +2,58 @@ package usecases
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"location-service/bin/config"
 
 	driver "location-service/bin/modules/driver"
 	"location-service/bin/modules/driver/models"
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/constants"
 	httpError "location-service/bin/pkg/http-error"
 	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// poolTripTTL drops a pool trip the driver app stopped refreshing, the app saves it again on every stop
+	poolTripTTL = 15 * time.Minute
+	// tripDriverTTL keeps the assigned driver of a rider for the trip tracking, longer than any city trip
+	tripDriverTTL = 4 * time.Hour
+	// dispatchBatch is how many due dispatches are moved on per worker tick
+	dispatchBatch = 100
+)
+
+// removeStaleDriver drops the driver (ARGV[1]) from the last-seen set only while its last ping is still at or before
+// the stale cutoff (ARGV[2]), a driver that pinged since the sweep read the set is kept
+var removeStaleDriver = redis.NewScript(`
+local lastSeen = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if lastSeen and tonumber(lastSeen) <= tonumber(ARGV[2]) then
+	return redis.call("ZREM", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
 type commandUsecase struct {
 	driverRepositoryQuery   driver.MongodbRepositoryQuery
 	driverRepositoryCommand driver.MongodbRepositoryCommand
 	redisClient             redis.UniversalClient
+	rides                   ride.UsecaseCommand
 }
 
-func NewCommandUsecase(mq driver.MongodbRepositoryQuery, mc driver.MongodbRepositoryCommand, rc redis.UniversalClient) driver.UsecaseCommand {
+func NewCommandUsecase(mq driver.MongodbRepositoryQuery, mc driver.MongodbRepositoryCommand, rc redis.UniversalClient, rides ride.UsecaseCommand) driver.UsecaseCommand {
 	return &commandUsecase{
 		driverRepositoryQuery:   mq,
 		driverRepositoryCommand: mc,
 		redisClient:             rc,
+		rides:                   rides,
 	}
 }
 
@@ -38,51 +66,700 @@ func (c *commandUsecase) ActivateBeacon(driverId string, payload models.BeaconRe
 		return result
 	}
 	now := time.Now()
-	formattedDate := now.Format("2006-01-02")
 	driver, _ := driverInfo.Data.(models.User)
-	var workLogData models.WorkLog
-
-	workLog := <-c.driverRepositoryQuery.FindWorkLog(driver.Id, formattedDate, ctx)
-	if workLog.Error == nil && workLog.Data != nil {
-		workLogData = workLog.Data.(models.WorkLog)
-	} else {
-		workLogData = models.WorkLog{
-			DriverID: driver.Id,
-			WorkDate: formattedDate,
-		}
-	}
-	if len(workLogData.Log) > 0 {
-		lastLog := workLogData.Log[len(workLogData.Log)-1]
 
-		if lastLog.Status == payload.Status || now.Sub(lastLog.WorkTime) < time.Minute {
-			fmt.Println("Log tidak diperbarui karena status sama")
-		} else {
-			workLogData.Log = append(workLogData.Log, models.LogActivity{
-				WorkTime: now,
-				Active:   payload.Status == "work",
-				Status:   payload.Status,
-			})
+	workLogData := c.findWorkLog(driver.Id, now, ctx)
+	currentStatus := c.currentStatus(driver.Id, now, ctx)
+	if currentStatus != payload.Status {
+		if !models.CanTransition(currentStatus, payload.Status) {
+			errObj := httpError.BadRequest(fmt.Sprintf("Cannot change status from %s to %s", currentStatus, payload.Status))
+			result.Error = errObj
+			return result
 		}
-	} else {
 		workLogData.Log = append(workLogData.Log, models.LogActivity{
 			WorkTime: now,
-			Active:   payload.Status == "work",
+			Active:   models.IsActiveStatus(payload.Status),
 			Status:   payload.Status,
 		})
+		beacon := <-c.driverRepositoryCommand.UpsertBeacon(workLogData, ctx)
+		if beacon.Error != nil {
+			errObj := httpError.NewInternalServerError()
+			errObj.Message = fmt.Sprintf("Failed update worklog: %v", beacon.Error)
+			result.Error = errObj
+			log.GetLogger().Error("command_usecase", errObj.Message, "UpsertBeacon", utils.ConvertString(beacon.Error))
+			return result
+		}
+		c.saveStatus(driver.Id, payload.Status, ctx)
+		// matching favours drivers who have been waiting the longest
+		var errIdle error
+		if payload.Status == models.StatusAvailable {
+			errIdle = c.redisClient.ZAdd(ctx, constants.DriverAvailableSinceKey, redis.Z{Score: float64(now.Unix()), Member: driver.Id}).Err()
+		} else {
+			errIdle = c.redisClient.ZRem(ctx, constants.DriverAvailableSinceKey, driver.Id).Err()
+		}
+		if errIdle != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed update available since: %v", errIdle), "ActivateBeacon", utils.ConvertString(errIdle))
+		}
 	}
-	beacon := <-c.driverRepositoryCommand.UpsertBeacon(workLogData, ctx)
-	if beacon.Error != nil {
+
+	var err error
+	if models.IsActiveStatus(payload.Status) {
+		err = c.trackDriver(driver.Id, payload.Status, payload.Longitude, payload.Latitude, now, ctx)
+	} else {
+		err = c.untrackDriver(driver.Id, ctx)
+	}
+	if err != nil {
 		errObj := httpError.NewInternalServerError()
-		errObj.Message = fmt.Sprintf("Failed update worklog: %v", beacon.Error)
+		errObj.Message = fmt.Sprintf("Failed update driver location: %v", err)
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "UpsertBeacon", utils.ConvertString(beacon.Error))
+		log.GetLogger().Error("command_usecase", errObj.Message, "ActivateBeacon", utils.ConvertString(err))
 		return result
 	}
+
 	urlSocket := fmt.Sprintf("%s?driver=%s", config.GetConfig().SocketUrl, driver.Id)
-	if payload.Status != "work" {
+	if !models.IsActiveStatus(payload.Status) {
 		urlSocket = "selamat istirahat"
 	}
 
 	result.Data = urlSocket
 	return result
 }
+
+func (c *commandUsecase) UpdateLocation(driverId string, payload models.LocationRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	driverInfo := <-c.driverRepositoryQuery.FindDriver(driverId, ctx)
+	if driverInfo.Error != nil {
+		errObj := httpError.BadRequest("Profile Driver not completed")
+		result.Error = errObj
+		return result
+	}
+	driver, _ := driverInfo.Data.(models.User)
+	if driver.Id == "" {
+		errObj := httpError.BadRequest("Profile Driver not completed")
+		result.Error = errObj
+		return result
+	}
+
+	now := time.Now()
+	status := c.currentStatus(driver.Id, now, ctx)
+	if !models.IsActiveStatus(status) {
+		errObj := httpError.BadRequest("Driver is not working, please activate beacon first")
+		result.Error = errObj
+		return result
+	}
+
+	if err := c.trackDriver(driver.Id, status, payload.Longitude, payload.Latitude, now, ctx); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed update driver location: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "UpdateLocation", utils.ConvertString(err))
+		return result
+	}
+
+	driverLocation := models.DriverLocation{
+		DriverID:  driver.Id,
+		Status:    status,
+		Longitude: payload.Longitude,
+		Latitude:  payload.Latitude,
+		LastSeen:  now,
+	}
+	message, _ := json.Marshal(driverLocation)
+	if err := c.redisClient.Publish(ctx, constants.DriverTrackingChannel+driver.Id, message).Err(); err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed publish driver location: %v", err), "UpdateLocation", utils.ConvertString(err))
+	}
+
+	result.Data = driverLocation
+	return result
+}
+
+func (c *commandUsecase) SweepStaleDrivers(staleAfter time.Duration, ctx context.Context) utils.Result {
+	var result utils.Result
+	now := time.Now()
+	cutoff := now.Add(-staleAfter).Unix()
+	staleDrivers, err := c.redisClient.ZRangeByScore(ctx, constants.DriverLastSeenKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get stale drivers: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "SweepStaleDrivers", utils.ConvertString(err))
+		return result
+	}
+
+	swept := make([]string, 0, len(staleDrivers))
+	for _, driverId := range staleDrivers {
+		// only the instance that actually removes the member writes the offline log,
+		// so running the sweeper on every replica does not duplicate work-log entries
+		removed, err := removeStaleDriver.Run(ctx, c.redisClient, []string{constants.DriverLastSeenKey}, driverId, cutoff).Int64()
+		if err != nil || removed == 0 {
+			continue
+		}
+		if err := c.untrackDriver(driverId, ctx); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed remove driver %s from geo index: %v", driverId, err), "SweepStaleDrivers", utils.ConvertString(err))
+		}
+
+		// a stale driver is forced offline whatever the current status, the transition rules only guard driver requests
+		if c.currentStatus(driverId, now, ctx) != models.StatusOffline {
+			workLogData := c.findWorkLog(driverId, now, ctx)
+			workLogData.Log = append(workLogData.Log, models.LogActivity{
+				WorkTime: now,
+				Active:   false,
+				Status:   models.StatusOffline,
+			})
+			if beacon := <-c.driverRepositoryCommand.UpsertBeacon(workLogData, ctx); beacon.Error != nil {
+				log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed update worklog driver %s: %v", driverId, beacon.Error), "SweepStaleDrivers", utils.ConvertString(beacon.Error))
+			}
+			c.saveStatus(driverId, models.StatusOffline, ctx)
+		}
+		swept = append(swept, driverId)
+	}
+
+	result.Data = swept
+	return result
+}
+
+// OpenPoolTrip lets riders be matched into the current trip of the driver, saving again replaces the stops
+func (c *commandUsecase) OpenPoolTrip(driverId string, payload models.PoolTripRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	if status := c.currentStatus(driverId, time.Now(), ctx); status != models.StatusOnTrip {
+		errObj := httpError.BadRequest("Driver is not on a trip")
+		result.Error = errObj
+		return result
+	}
+	if payload.OnBoard() > payload.Capacity {
+		errObj := httpError.BadRequest(fmt.Sprintf("%d riders on board but only %d seats", payload.OnBoard(), payload.Capacity))
+		result.Error = errObj
+		return result
+	}
+
+	poolTrip := models.PoolTrip{
+		DriverId:  driverId,
+		Capacity:  payload.Capacity,
+		Stops:     payload.Stops,
+		UpdatedAt: time.Now(),
+	}
+	poolTripJSON, _ := json.Marshal(poolTrip)
+	if err := c.redisClient.Set(ctx, fmt.Sprintf(constants.PoolTripKey, driverId), poolTripJSON, poolTripTTL).Err(); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed save pool trip: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "OpenPoolTrip", utils.ConvertString(err))
+		return result
+	}
+
+	result.Data = poolTrip
+	return result
+}
+
+func (c *commandUsecase) ClosePoolTrip(driverId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	if err := c.redisClient.Del(ctx, fmt.Sprintf(constants.PoolTripKey, driverId)).Err(); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed close pool trip: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ClosePoolTrip", utils.ConvertString(err))
+		return result
+	}
+
+	result.Data = driverId
+	return result
+}
+
+// CreateCommuteOffer publishes a trip the driver plans anyway so riders going the same way can find it
+func (c *commandUsecase) CreateCommuteOffer(driverId string, payload models.CommuteOfferRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	driverInfo := <-c.driverRepositoryQuery.FindDriver(driverId, ctx)
+	if driverInfo.Error != nil {
+		errObj := httpError.BadRequest("Profile Driver not completed")
+		result.Error = errObj
+		return result
+	}
+	driver, _ := driverInfo.Data.(models.User)
+	if driver.Id == "" {
+		errObj := httpError.BadRequest("Profile Driver not completed")
+		result.Error = errObj
+		return result
+	}
+
+	now := time.Now()
+	if !payload.DepartUntil.After(now) {
+		errObj := httpError.BadRequest("Departure window is already over")
+		result.Error = errObj
+		return result
+	}
+	if payload.DepartFrom.After(now.Add(models.MaxCommuteOfferAhead)) {
+		errObj := httpError.BadRequest(fmt.Sprintf("Departure must be within %d days", int(models.MaxCommuteOfferAhead.Hours()/24)))
+		result.Error = errObj
+		return result
+	}
+
+	insertRes := <-c.driverRepositoryCommand.InsertCommuteOffer(models.CommuteOffer{
+		DriverId:    driver.Id,
+		Path:        models.NewGeoJSONLineString(payload.Route),
+		DepartFrom:  payload.DepartFrom,
+		DepartUntil: payload.DepartUntil,
+		Seats:       payload.Seats,
+		Status:      models.CommuteOfferOpen,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, ctx)
+	if insertRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed save commute offer: %v", insertRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CreateCommuteOffer", utils.ConvertString(insertRes.Error))
+		return result
+	}
+
+	result.Data = insertRes.Data
+	return result
+}
+
+func (c *commandUsecase) CloseCommuteOffer(driverId string, offerId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	closeRes := <-c.driverRepositoryCommand.CloseCommuteOffer(driverId, offerId, ctx)
+	if closeRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed close commute offer: %v", closeRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CloseCommuteOffer", utils.ConvertString(closeRes.Error))
+		return result
+	}
+	if closed, _ := closeRes.Data.(bool); !closed {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Open commute offer not found"
+		result.Error = errObj
+		return result
+	}
+
+	result.Data = offerId
+	return result
+}
+
+func (c *commandUsecase) findWorkLog(driverId string, now time.Time, ctx context.Context) models.WorkLog {
+	formattedDate := now.Format("2006-01-02")
+	workLog := <-c.driverRepositoryQuery.FindWorkLog(driverId, formattedDate, ctx)
+	if workLog.Error == nil && workLog.Data != nil {
+		return workLog.Data.(models.WorkLog)
+	}
+	return models.WorkLog{
+		DriverID: driverId,
+		WorkDate: formattedDate,
+	}
+}
+
+// currentStatus is the status the driver last set. The work-log starts empty every day, the status is kept in redis so
+// a driver working past midnight is still working, a driver without it falls back to the work-log of the day.
+func (c *commandUsecase) currentStatus(driverId string, now time.Time, ctx context.Context) string {
+	status, err := c.redisClient.Get(ctx, fmt.Sprintf(constants.DriverStatusKey, driverId)).Result()
+	if err == nil {
+		return models.NormalizeStatus(status)
+	}
+	if err != redis.Nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed get status of driver %s", driverId), "currentStatus", utils.ConvertString(err))
+	}
+	return c.findWorkLog(driverId, now, ctx).CurrentStatus()
+}
+
+// saveStatus keeps the status the driver is now in, the work-log of the day is the record a failure leaves
+func (c *commandUsecase) saveStatus(driverId string, status string, ctx context.Context) {
+	if err := c.redisClient.Set(ctx, fmt.Sprintf(constants.DriverStatusKey, driverId), status, 0).Err(); err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed save status of driver %s", driverId), "saveStatus", utils.ConvertString(err))
+	}
+}
+
+// trackDriver stores the driver position in the geo set matching its status, only available drivers are matchable.
+// A driver holding a ride is on a trip whatever its status.
+func (c *commandUsecase) trackDriver(driverId string, status string, longitude float64, latitude float64, now time.Time, ctx context.Context) error {
+	geoKey, staleKey := constants.DriverLocationKey, constants.DriverOnTripLocationKey
+	if status == models.StatusOnTrip || c.holdsRide(driverId, ctx) {
+		geoKey, staleKey = constants.DriverOnTripLocationKey, constants.DriverLocationKey
+	}
+	_, err := c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.GeoAdd(ctx, geoKey, &redis.GeoLocation{
+			Name:      driverId,
+			Longitude: longitude,
+			Latitude:  latitude,
+		})
+		pipe.ZRem(ctx, staleKey, driverId)
+		if status != models.StatusOnTrip {
+			// the trip is over, nobody can be pooled into it anymore
+			pipe.Del(ctx, fmt.Sprintf(constants.PoolTripKey, driverId))
+		}
+		pipe.ZAdd(ctx, constants.DriverLastSeenKey, redis.Z{
+			Score:  float64(now.Unix()),
+			Member: driverId,
+		})
+		return nil
+	})
+	return err
+}
+
+// holdsRide reports whether the driver accepted a ride that has not ended yet
+func (c *commandUsecase) holdsRide(driverId string, ctx context.Context) bool {
+	held, err := c.redisClient.Exists(ctx, fmt.Sprintf(constants.DriverRideKey, driverId)).Result()
+	if err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed get ride of driver %s", driverId), "holdsRide", utils.ConvertString(err))
+	}
+	return held > 0
+}
+
+// claimDriver reserves the ride of the dispatch for the driver before the acceptance is saved, a driver who is on a
+// trip or already holds a ride cannot accept another one. It returns whether the ride key was set.
+func (c *commandUsecase) claimDriver(driverId string, dispatch models.Dispatch, now time.Time, ctx context.Context) (bool, interface{}) {
+	errObj := httpError.NewConflict()
+	errObj.Message = "You already have a ride, please finish it before accepting another"
+	if c.currentStatus(driverId, now, ctx) == models.StatusOnTrip {
+		return false, errObj
+	}
+	if dispatch.RideId == "" {
+		if c.holdsRide(driverId, ctx) {
+			return false, errObj
+		}
+		return false, nil
+	}
+	claimed, err := c.redisClient.SetNX(ctx, fmt.Sprintf(constants.DriverRideKey, driverId), dispatch.RideId, tripDriverTTL).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed claim ride: %v", err)
+		log.GetLogger().Error("command_usecase", errObj.Message, "claimDriver", utils.ConvertString(err))
+		return false, errObj
+	}
+	if !claimed {
+		return false, errObj
+	}
+	return true, nil
+}
+
+// unclaimDriver gives the ride claimed for the driver back when its acceptance could not be saved
+func (c *commandUsecase) unclaimDriver(driverId string, dispatch models.Dispatch, ctx context.Context) {
+	rideKey := fmt.Sprintf(constants.DriverRideKey, driverId)
+	rideId, err := c.redisClient.Get(ctx, rideKey).Result()
+	if err == nil && rideId == dispatch.RideId {
+		err = c.redisClient.Del(ctx, rideKey).Err()
+	}
+	if err != nil && err != redis.Nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed unclaim ride of driver %s", driverId), "unclaimDriver", utils.ConvertString(err))
+	}
+}
+
+// holdDriver takes the driver assigned to the ride of the dispatch out of matching until the ride module releases it,
+// the ride itself was claimed on accept. It returns where the driver accepted from.
+func (c *commandUsecase) holdDriver(dispatch models.Dispatch, ctx context.Context) *redis.GeoPos {
+	if dispatch.RideId == "" {
+		return nil
+	}
+	var position *redis.GeoPos
+	positions, err := c.redisClient.GeoPos(ctx, constants.DriverLocationKey, dispatch.DriverId).Result()
+	if err == nil && len(positions) == 1 {
+		position = positions[0]
+	}
+	_, err = c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if position != nil {
+			pipe.GeoAdd(ctx, constants.DriverOnTripLocationKey, &redis.GeoLocation{
+				Name:      dispatch.DriverId,
+				Longitude: position.Longitude,
+				Latitude:  position.Latitude,
+			})
+		}
+		pipe.ZRem(ctx, constants.DriverLocationKey, dispatch.DriverId)
+		pipe.ZRem(ctx, constants.DriverAvailableSinceKey, dispatch.DriverId)
+		return nil
+	})
+	if err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed hold driver %s", dispatch.DriverId), "holdDriver", utils.ConvertString(err))
+	}
+	return position
+}
+
+// releaseHold puts the driver held for the ride of the dispatch back in matching at the position it accepted from, the
+// ride was cancelled before it was matched
+func (c *commandUsecase) releaseHold(dispatch models.Dispatch, position *redis.GeoPos, ctx context.Context) {
+	_, err := c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, constants.DriverOnTripLocationKey, dispatch.DriverId)
+		if position != nil {
+			pipe.GeoAdd(ctx, constants.DriverLocationKey, &redis.GeoLocation{
+				Name:      dispatch.DriverId,
+				Longitude: position.Longitude,
+				Latitude:  position.Latitude,
+			})
+			pipe.ZAdd(ctx, constants.DriverAvailableSinceKey, redis.Z{Score: float64(time.Now().Unix()), Member: dispatch.DriverId})
+		}
+		return nil
+	})
+	if err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed release driver %s", dispatch.DriverId), "releaseHold", utils.ConvertString(err))
+	}
+}
+
+func (c *commandUsecase) untrackDriver(driverId string, ctx context.Context) error {
+	_, err := c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, constants.DriverLocationKey, driverId)
+		pipe.ZRem(ctx, constants.DriverOnTripLocationKey, driverId)
+		pipe.ZRem(ctx, constants.DriverLastSeenKey, driverId)
+		pipe.ZRem(ctx, constants.DriverAvailableSinceKey, driverId)
+		pipe.Del(ctx, fmt.Sprintf(constants.PoolTripKey, driverId))
+		return nil
+	})
+	return err
+}
+
+// AcceptOffer assigns the ride of the dispatch to the driver if its offer is still open and the driver is free
+func (c *commandUsecase) AcceptOffer(driverId string, dispatchId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	dispatch, errObj := c.findDispatch(dispatchId, ctx)
+	if errObj != nil {
+		result.Error = errObj
+		return result
+	}
+	now := time.Now()
+	before := append([]models.DispatchOffer(nil), dispatch.Offers...)
+	if err := dispatch.Accept(driverId, now); err != nil {
+		result.Error = offerError(err)
+		return result
+	}
+	// the ride is claimed before the dispatch is saved, of two offers accepted at once only one can win the driver
+	claimed, errObj := c.claimDriver(driverId, dispatch, now, ctx)
+	if errObj != nil {
+		result.Error = errObj
+		return result
+	}
+	if errObj := c.saveDispatch(dispatch, before, nil, ctx); errObj != nil {
+		if claimed {
+			c.unclaimDriver(driverId, dispatch, ctx)
+		}
+		result.Error = errObj
+		return result
+	}
+
+	result.Data = dispatch
+	return result
+}
+
+// RejectOffer declines the offer of the driver, the ride goes to the next wave once the current one has answered
+func (c *commandUsecase) RejectOffer(driverId string, dispatchId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	dispatch, errObj := c.findDispatch(dispatchId, ctx)
+	if errObj != nil {
+		result.Error = errObj
+		return result
+	}
+	before := append([]models.DispatchOffer(nil), dispatch.Offers...)
+	wave, err := dispatch.Reject(driverId, time.Now())
+	if err != nil {
+		result.Error = offerError(err)
+		return result
+	}
+	if errObj := c.saveDispatch(dispatch, before, wave, ctx); errObj != nil {
+		result.Error = errObj
+		return result
+	}
+
+	result.Data = dispatch
+	return result
+}
+
+// AdvanceDispatches offers the first wave of new dispatches and re-offers the expired ones, result.Data is the
+// dispatches moved on by this instance
+func (c *commandUsecase) AdvanceDispatches(ctx context.Context) utils.Result {
+	var result utils.Result
+	now := time.Now()
+	dueRes := <-c.driverRepositoryQuery.FindDueDispatches(now, dispatchBatch, ctx)
+	if dueRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get due dispatches: %v", dueRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "AdvanceDispatches", utils.ConvertString(dueRes.Error))
+		return result
+	}
+
+	dispatches, _ := dueRes.Data.([]models.Dispatch)
+	advanced := make([]models.Dispatch, 0, len(dispatches))
+	for _, dispatch := range dispatches {
+		before := append([]models.DispatchOffer(nil), dispatch.Offers...)
+		wave := dispatch.Advance(now)
+		// a conflict means another instance or a driver answer got there first
+		if errObj := c.saveDispatch(dispatch, before, wave, ctx); errObj != nil {
+			continue
+		}
+		advanced = append(advanced, dispatch)
+	}
+
+	result.Data = advanced
+	return result
+}
+
+func (c *commandUsecase) findDispatch(dispatchId string, ctx context.Context) (models.Dispatch, interface{}) {
+	dispatchRes := <-c.driverRepositoryQuery.FindDispatch(dispatchId, ctx)
+	if dispatchRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get dispatch: %v", dispatchRes.Error)
+		log.GetLogger().Error("command_usecase", errObj.Message, "findDispatch", utils.ConvertString(dispatchRes.Error))
+		return models.Dispatch{}, errObj
+	}
+	dispatch, _ := dispatchRes.Data.(models.Dispatch)
+	if dispatch.ID.IsZero() {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Offer not found"
+		return models.Dispatch{}, errObj
+	}
+	return dispatch, nil
+}
+
+// saveDispatch stores the dispatch read with the offers before, then publishes the new wave or the outcome and counts
+// the answered offers in the driver stats
+func (c *commandUsecase) saveDispatch(dispatch models.Dispatch, before []models.DispatchOffer, wave []string, ctx context.Context) interface{} {
+	updateRes := <-c.driverRepositoryCommand.UpdateDispatch(dispatch, dispatch.Version, ctx)
+	if updateRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed save dispatch: %v", updateRes.Error)
+		log.GetLogger().Error("command_usecase", errObj.Message, "saveDispatch", utils.ConvertString(updateRes.Error))
+		return errObj
+	}
+	if updated, _ := updateRes.Data.(bool); !updated {
+		errObj := httpError.NewConflict()
+		errObj.Message = "Offer was just updated, please try again"
+		return errObj
+	}
+
+	// the dispatch is saved, a failure below is logged and does not undo it
+	for _, offer := range answeredOffers(before, dispatch.Offers) {
+		accepted := 0
+		if offer.Status == models.OfferAccepted {
+			accepted = 1
+		}
+		if statsRes := <-c.driverRepositoryCommand.IncrementDriverStats(offer.DriverId, 1, accepted, ctx); statsRes.Error != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed update stats of driver %s", offer.DriverId), "saveDispatch", utils.ConvertString(statsRes.Error))
+		}
+	}
+
+	var request json.RawMessage
+	if dispatch.Request != "" {
+		request = json.RawMessage(dispatch.Request)
+	}
+	var events []outbox.Event
+	for _, driverId := range wave {
+		payload, _ := json.Marshal(models.RideOfferEvent{
+			DispatchId: dispatch.ID.Hex(),
+			UserId:     dispatch.UserId,
+			DriverId:   driverId,
+			ExpiresAt:  dispatch.DueAt,
+			Request:    request,
+		})
+		events = append(events, outbox.NewEvent("ride-offer", driverId, payload))
+	}
+	switch dispatch.Status {
+	case models.DispatchAssigned:
+		driverPosition := c.holdDriver(dispatch, ctx)
+		// the ride is matched before the rider hears of the driver, a ride cancelled meanwhile gives the driver back
+		if !c.moveDispatchRide(dispatch, wave, driverPosition, ctx) {
+			c.releaseHold(dispatch, driverPosition, ctx)
+			errObj := httpError.NewConflict()
+			errObj.Message = "The ride was cancelled, it is no longer offered"
+			return errObj
+		}
+		if err := c.redisClient.Set(ctx, fmt.Sprintf(constants.TripDriverKey, dispatch.UserId), dispatch.DriverId, tripDriverTTL).Err(); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed set driver of rider %s", dispatch.UserId), "saveDispatch", utils.ConvertString(err))
+		}
+		payload, _ := json.Marshal(models.RideAssignedEvent{
+			DispatchId: dispatch.ID.Hex(),
+			UserId:     dispatch.UserId,
+			DriverId:   dispatch.DriverId,
+			Status:     dispatch.Status,
+			AssignedAt: dispatch.AssignedAt,
+			Request:    request,
+		})
+		events = append(events, outbox.NewEvent("ride-assigned", dispatch.UserId, payload))
+	case models.DispatchExhausted:
+		payload, _ := json.Marshal(models.RideAssignedEvent{
+			DispatchId: dispatch.ID.Hex(),
+			UserId:     dispatch.UserId,
+			Status:     dispatch.Status,
+			Request:    request,
+		})
+		events = append(events, outbox.NewEvent("ride-unassigned", dispatch.UserId, payload))
+	}
+	for _, event := range events {
+		if outboxRes := <-c.driverRepositoryCommand.InsertOutbox(event, ctx); outboxRes.Error != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed publish %s of dispatch %s", event.Topic, dispatch.ID.Hex()), "saveDispatch", utils.ConvertString(outboxRes.Error))
+		}
+	}
+	if dispatch.Status == models.DispatchAssigned || dispatch.Status == models.DispatchExhausted {
+		c.endRiderSearch(dispatch, ctx)
+	}
+	if dispatch.Status != models.DispatchAssigned {
+		c.moveDispatchRide(dispatch, wave, nil, ctx)
+	}
+	return nil
+}
+
+// endRiderSearch lets the rider search again once its dispatch is over
+func (c *commandUsecase) endRiderSearch(dispatch models.Dispatch, ctx context.Context) {
+	searchKey := fmt.Sprintf(constants.RiderSearchKey, dispatch.UserId)
+	dispatchId, err := c.redisClient.Get(ctx, searchKey).Result()
+	if err == nil && dispatchId == dispatch.ID.Hex() {
+		err = c.redisClient.Del(ctx, searchKey).Err()
+	}
+	if err != nil && err != redis.Nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed end search of rider %s", dispatch.UserId), "endRiderSearch", utils.ConvertString(err))
+	}
+}
+
+// moveDispatchRide follows the dispatch in the ride lifecycle: offered with the first wave, matched from the driver
+// position on acceptance and back to searching when every driver declined. It returns false when the ride had already
+// left the status the dispatch moves it from, cancelled in the meantime.
+func (c *commandUsecase) moveDispatchRide(dispatch models.Dispatch, wave []string, driverPosition *redis.GeoPos, ctx context.Context) bool {
+	if dispatch.RideId == "" {
+		return true
+	}
+	var transition rideModels.Transition
+	switch {
+	case len(wave) > 0 && dispatch.Wave == 1:
+		transition = rideModels.Transition{Status: rideModels.StatusOffered, From: rideModels.StatusSearching, Actor: rideModels.ActorSystem, DispatchId: dispatch.ID.Hex()}
+	case dispatch.Status == models.DispatchAssigned:
+		transition = rideModels.Transition{Status: rideModels.StatusMatched, From: rideModels.StatusOffered, Actor: rideModels.ActorDriver, ActorId: dispatch.DriverId, DriverId: dispatch.DriverId}
+		if driverPosition != nil {
+			transition.DriverLocation = &rideModels.Location{Longitude: driverPosition.Longitude, Latitude: driverPosition.Latitude}
+		}
+	case dispatch.Status == models.DispatchExhausted:
+		transition = rideModels.Transition{Status: rideModels.StatusSearching, From: rideModels.StatusOffered, Actor: rideModels.ActorSystem, Reason: "no driver accepted"}
+	default:
+		return true
+	}
+	result := c.rides.Transition(dispatch.RideId, transition, ctx)
+	if result.Error == nil {
+		return true
+	}
+	log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed move ride %s to %s", dispatch.RideId, transition.Status), "moveDispatchRide", utils.ConvertString(result.Error))
+	_, conflict := result.Error.(httpError.ConflictData)
+	return !conflict
+}
+
+// answeredOffers returns the offers a driver accepted, rejected or let expire since before, withdrawn offers were
+// never answered
+func answeredOffers(before []models.DispatchOffer, after []models.DispatchOffer) []models.DispatchOffer {
+	var answered []models.DispatchOffer
+	for i, offer := range after {
+		if i >= len(before) || before[i].Status != models.OfferPending {
+			continue
+		}
+		switch offer.Status {
+		case models.OfferAccepted, models.OfferRejected, models.OfferExpired:
+			answered = append(answered, offer)
+		}
+	}
+	return answered
+}
+
+func offerError(err error) interface{} {
+	if errors.Is(err, models.ErrOfferNotFound) {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Offer not found"
+		return errObj
+	}
+	errObj := httpError.NewConflict()
+	errObj.Message = "Offer is no longer open"
+	return errObj
+}
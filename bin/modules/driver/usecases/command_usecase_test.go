@@ -0,0 +1,461 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/driver/models"
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockMongodbRepositoryQuery struct {
+	mock.Mock
+}
+
+func (m *MockMongodbRepositoryQuery) FindWorkLog(driverId string, date string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(driverId, date, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindDriver(userId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(userId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindCommuteOffers(driverId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(driverId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindDispatch(dispatchId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(dispatchId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindDueDispatches(now time.Time, limit int64, ctx context.Context) <-chan utils.Result {
+	args := m.Called(now, limit, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindRideDispatch(rideId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(rideId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+type MockMongodbRepositoryCommand struct {
+	mock.Mock
+}
+
+func (m *MockMongodbRepositoryCommand) NewObjectID(ctx context.Context) string {
+	return m.Called(ctx).String(0)
+}
+
+func (m *MockMongodbRepositoryCommand) UpsertBeacon(data models.WorkLog, ctx context.Context) <-chan utils.Result {
+	args := m.Called(data, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) InsertCommuteOffer(offer models.CommuteOffer, ctx context.Context) <-chan utils.Result {
+	args := m.Called(offer, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) CloseCommuteOffer(driverId string, offerId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(driverId, offerId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) UpdateDispatch(dispatch models.Dispatch, version int, ctx context.Context) <-chan utils.Result {
+	args := m.Called(dispatch, version, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) CancelRideDispatch(rideId string, now time.Time, ctx context.Context) <-chan utils.Result {
+	args := m.Called(rideId, now, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	args := m.Called(event, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) IncrementDriverStats(driverId string, offersReceived int, offersAccepted int, ctx context.Context) <-chan utils.Result {
+	args := m.Called(driverId, offersReceived, offersAccepted, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+type MockRedisClient struct {
+	mock.Mock
+	redis.UniversalClient
+}
+
+func (m *MockRedisClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	args := m.Called(ctx, key)
+	return args.Get(0).(*redis.StringCmd)
+}
+
+func (m *MockRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	args := m.Called(ctx, key, value, expiration)
+	return args.Get(0).(*redis.StatusCmd)
+}
+
+func (m *MockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	args := m.Called(ctx, key, value, expiration)
+	return args.Get(0).(*redis.BoolCmd)
+}
+
+func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	args := m.Called(ctx, keys)
+	return args.Get(0).(*redis.IntCmd)
+}
+
+func (m *MockRedisClient) GeoPos(ctx context.Context, key string, members ...string) *redis.GeoPosCmd {
+	args := m.Called(ctx, key, members)
+	return args.Get(0).(*redis.GeoPosCmd)
+}
+
+func (m *MockRedisClient) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	args := m.Called(ctx, key, opt)
+	return args.Get(0).(*redis.StringSliceCmd)
+}
+
+func (m *MockRedisClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	called := m.Called(ctx, sha1, keys, args)
+	return called.Get(0).(*redis.Cmd)
+}
+
+func (m *MockRedisClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	args := m.Called(ctx, keys)
+	return args.Get(0).(*redis.IntCmd)
+}
+
+func (m *MockRedisClient) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	args := m.Called(ctx, channel, message)
+	return args.Get(0).(*redis.IntCmd)
+}
+
+func (m *MockRedisClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	args := m.Called(ctx)
+	return nil, args.Error(0)
+}
+
+type MockRideUsecase struct {
+	mock.Mock
+	ride.UsecaseCommand
+}
+
+func (m *MockRideUsecase) Transition(rideId string, payload rideModels.Transition, ctx context.Context) utils.Result {
+	args := m.Called(rideId, payload, ctx)
+	return args.Get(0).(utils.Result)
+}
+
+func offeredDispatch(candidates []string, offered string) models.Dispatch {
+	now := time.Now()
+	return models.Dispatch{
+		ID:         primitive.NewObjectID(),
+		UserId:     "rider1",
+		RideId:     "ride1",
+		Candidates: candidates,
+		Next:       1,
+		WaveSize:   1,
+		OfferTTL:   15 * time.Second,
+		Wave:       1,
+		Offers: []models.DispatchOffer{
+			{DriverId: offered, Wave: 1, Status: models.OfferPending, OfferedAt: now, ExpiresAt: now.Add(15 * time.Second)},
+		},
+		Status:  models.DispatchOffered,
+		DueAt:   now.Add(15 * time.Second),
+		Version: 3,
+	}
+}
+
+func newTestUsecase() (*MockMongodbRepositoryQuery, *MockMongodbRepositoryCommand, *MockRedisClient, *MockRideUsecase, *commandUsecase) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockRedis := new(MockRedisClient)
+	mockRides := new(MockRideUsecase)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, mockRedis, mockRides).(*commandUsecase)
+	return mockQuery, mockCommand, mockRedis, mockRides, usecase
+}
+
+func TestAcceptOffer_Assigned(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, mockRides, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1"}, "driver1")
+	position := &redis.GeoPos{Longitude: 106.8, Latitude: -6.2}
+
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult("", redis.Nil))
+	mockQuery.On("FindWorkLog", "driver1", mock.Anything, ctx).Return(utils.Result{Data: models.WorkLog{Log: []models.LogActivity{{Status: models.StatusAvailable}}}})
+	mockRedis.On("SetNX", ctx, "DRIVER:RIDE:driver1", "ride1", tripDriverTTL).Return(redis.NewBoolResult(true, nil))
+	mockCommand.On("UpdateDispatch", mock.MatchedBy(func(d models.Dispatch) bool {
+		return d.Status == models.DispatchAssigned && d.DriverId == "driver1"
+	}), 3, ctx).Return(utils.Result{Data: true})
+	mockCommand.On("IncrementDriverStats", "driver1", 1, 1, ctx).Return(utils.Result{})
+	mockRedis.On("GeoPos", ctx, "drivers-locations", []string{"driver1"}).Return(redis.NewGeoPosCmdResult([]*redis.GeoPos{position}, nil))
+	mockRedis.On("Pipelined", ctx).Return(nil)
+	mockRedis.On("Set", ctx, "USER:DRIVER:rider1", "driver1", tripDriverTTL).Return(redis.NewStatusResult("OK", nil))
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool { return e.Topic == "ride-assigned" }), ctx).Return(utils.Result{})
+	mockRedis.On("Get", ctx, "USER:SEARCH:rider1").Return(redis.NewStringResult(dispatch.ID.Hex(), nil))
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:rider1"}).Return(redis.NewIntResult(1, nil))
+	mockRides.On("Transition", "ride1", mock.MatchedBy(func(tr rideModels.Transition) bool {
+		return tr.Status == rideModels.StatusMatched && tr.DriverId == "driver1" && tr.DriverLocation != nil && tr.DriverLocation.Latitude == -6.2
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.AcceptOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, models.DispatchAssigned, result.Data.(models.Dispatch).Status)
+	mockCommand.AssertExpectations(t)
+	mockRedis.AssertExpectations(t)
+	mockRides.AssertExpectations(t)
+}
+
+func TestAcceptOffer_DriverHoldsRide(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, _, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1"}, "driver1")
+
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult("", redis.Nil))
+	mockQuery.On("FindWorkLog", "driver1", mock.Anything, ctx).Return(utils.Result{Data: models.WorkLog{Log: []models.LogActivity{{Status: models.StatusAvailable}}}})
+	mockRedis.On("SetNX", ctx, "DRIVER:RIDE:driver1", "ride1", tripDriverTTL).Return(redis.NewBoolResult(false, nil))
+
+	result := usecase.AcceptOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockCommand.AssertNotCalled(t, "UpdateDispatch", mock.Anything, mock.Anything, mock.Anything)
+	// the ride the driver holds is not released
+	mockRedis.AssertNotCalled(t, "Del", mock.Anything, mock.Anything)
+}
+
+func TestAcceptOffer_OnTrip(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, _, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1"}, "driver1")
+
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult(models.StatusOnTrip, nil))
+
+	result := usecase.AcceptOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockRedis.AssertNotCalled(t, "SetNX", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "UpdateDispatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAcceptOffer_SaveConflictUnclaims(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, mockRides, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1"}, "driver1")
+
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult("", redis.Nil))
+	mockQuery.On("FindWorkLog", "driver1", mock.Anything, ctx).Return(utils.Result{})
+	mockRedis.On("SetNX", ctx, "DRIVER:RIDE:driver1", "ride1", tripDriverTTL).Return(redis.NewBoolResult(true, nil))
+	mockCommand.On("UpdateDispatch", mock.Anything, 3, ctx).Return(utils.Result{Data: false})
+	mockRedis.On("Get", ctx, "DRIVER:RIDE:driver1").Return(redis.NewStringResult("ride1", nil))
+	mockRedis.On("Del", ctx, []string{"DRIVER:RIDE:driver1"}).Return(redis.NewIntResult(1, nil))
+
+	result := usecase.AcceptOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockRedis.AssertExpectations(t)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+	mockRides.AssertNotCalled(t, "Transition", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAcceptOffer_RideCancelledReleasesDriver(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, mockRides, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1"}, "driver1")
+	position := &redis.GeoPos{Longitude: 106.8, Latitude: -6.2}
+
+	conflict := httpError.NewConflict()
+	conflict.Message = "Ride is cancelled now"
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult("", redis.Nil))
+	mockQuery.On("FindWorkLog", "driver1", mock.Anything, ctx).Return(utils.Result{})
+	mockRedis.On("SetNX", ctx, "DRIVER:RIDE:driver1", "ride1", tripDriverTTL).Return(redis.NewBoolResult(true, nil))
+	mockCommand.On("UpdateDispatch", mock.Anything, 3, ctx).Return(utils.Result{Data: true})
+	mockCommand.On("IncrementDriverStats", "driver1", 1, 1, ctx).Return(utils.Result{})
+	mockRedis.On("GeoPos", ctx, "drivers-locations", []string{"driver1"}).Return(redis.NewGeoPosCmdResult([]*redis.GeoPos{position}, nil))
+	mockRedis.On("Pipelined", ctx).Return(nil)
+	mockRides.On("Transition", "ride1", mock.MatchedBy(func(tr rideModels.Transition) bool {
+		return tr.Status == rideModels.StatusMatched && tr.From == rideModels.StatusOffered
+	}), ctx).Return(utils.Result{Error: conflict})
+	mockRedis.On("Get", ctx, "DRIVER:RIDE:driver1").Return(redis.NewStringResult("ride1", nil))
+	mockRedis.On("Del", ctx, []string{"DRIVER:RIDE:driver1"}).Return(redis.NewIntResult(1, nil))
+
+	result := usecase.AcceptOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	// held then released, the claim is given back and the rider never hears of the driver
+	mockRedis.AssertNumberOfCalls(t, "Pipelined", 2)
+	mockRedis.AssertExpectations(t)
+	mockRedis.AssertNotCalled(t, "Set", ctx, "USER:DRIVER:rider1", mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+}
+
+func TestRejectOffer_NextWave(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, mockRides, usecase := newTestUsecase()
+	ctx := context.Background()
+	dispatch := offeredDispatch([]string{"driver1", "driver2"}, "driver1")
+
+	mockQuery.On("FindDispatch", dispatch.ID.Hex(), ctx).Return(utils.Result{Data: dispatch})
+	mockCommand.On("UpdateDispatch", mock.MatchedBy(func(d models.Dispatch) bool {
+		return d.Status == models.DispatchOffered && d.Wave == 2
+	}), 3, ctx).Return(utils.Result{Data: true})
+	mockCommand.On("IncrementDriverStats", "driver1", 1, 0, ctx).Return(utils.Result{})
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool {
+		return e.Topic == "ride-offer" && e.Key == "driver2"
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.RejectOffer("driver1", dispatch.ID.Hex(), ctx)
+
+	assert.Nil(t, result.Error)
+	mockCommand.AssertExpectations(t)
+	// only the first wave moves the ride to offered, the rider search goes on
+	mockRides.AssertNotCalled(t, "Transition", mock.Anything, mock.Anything, mock.Anything)
+	mockRedis.AssertNotCalled(t, "Del", mock.Anything, mock.Anything)
+}
+
+func TestAdvanceDispatches(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, mockRides, usecase := newTestUsecase()
+	ctx := context.Background()
+	searching := models.Dispatch{
+		ID:         primitive.NewObjectID(),
+		UserId:     "rider1",
+		RideId:     "ride1",
+		Candidates: []string{"driver1"},
+		WaveSize:   1,
+		OfferTTL:   15 * time.Second,
+		Status:     models.DispatchSearching,
+		Version:    1,
+	}
+	expired := offeredDispatch([]string{"driver2"}, "driver2")
+	expired.ID = primitive.NewObjectID()
+	expired.UserId = "rider2"
+	expired.RideId = "ride2"
+	expired.DueAt = time.Now().Add(-time.Second)
+	taken := offeredDispatch([]string{"driver3"}, "driver3")
+	taken.DueAt = time.Now().Add(-time.Second)
+	taken.Version = 7
+
+	mockQuery.On("FindDueDispatches", mock.Anything, int64(dispatchBatch), ctx).Return(utils.Result{Data: []models.Dispatch{searching, expired, taken}})
+	mockCommand.On("UpdateDispatch", mock.MatchedBy(func(d models.Dispatch) bool { return d.ID == searching.ID }), 1, ctx).Return(utils.Result{Data: true})
+	mockCommand.On("UpdateDispatch", mock.MatchedBy(func(d models.Dispatch) bool { return d.ID == expired.ID }), 3, ctx).Return(utils.Result{Data: true})
+	// another instance moved it on first
+	mockCommand.On("UpdateDispatch", mock.MatchedBy(func(d models.Dispatch) bool { return d.ID == taken.ID }), 7, ctx).Return(utils.Result{Data: false})
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool {
+		return e.Topic == "ride-offer" && e.Key == "driver1"
+	}), ctx).Return(utils.Result{})
+	mockRides.On("Transition", "ride1", mock.MatchedBy(func(tr rideModels.Transition) bool {
+		return tr.Status == rideModels.StatusOffered
+	}), ctx).Return(utils.Result{})
+	mockCommand.On("IncrementDriverStats", "driver2", 1, 0, ctx).Return(utils.Result{})
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool {
+		return e.Topic == "ride-unassigned" && e.Key == "rider2"
+	}), ctx).Return(utils.Result{})
+	mockRedis.On("Get", ctx, "USER:SEARCH:rider2").Return(redis.NewStringResult(expired.ID.Hex(), nil))
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:rider2"}).Return(redis.NewIntResult(1, nil))
+	mockRides.On("Transition", "ride2", mock.MatchedBy(func(tr rideModels.Transition) bool {
+		return tr.Status == rideModels.StatusSearching
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.AdvanceDispatches(ctx)
+
+	assert.Nil(t, result.Error)
+	advanced := result.Data.([]models.Dispatch)
+	assert.Len(t, advanced, 2)
+	assert.Equal(t, models.DispatchOffered, advanced[0].Status)
+	assert.Equal(t, models.DispatchExhausted, advanced[1].Status)
+	mockCommand.AssertExpectations(t)
+	mockRedis.AssertExpectations(t)
+	mockRides.AssertExpectations(t)
+	mockCommand.AssertNotCalled(t, "IncrementDriverStats", "driver3", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSweepStaleDrivers_KeepsDriverPingedMeanwhile(t *testing.T) {
+	mockQuery, mockCommand, mockRedis, _, usecase := newTestUsecase()
+	ctx := context.Background()
+
+	mockRedis.On("ZRangeByScore", ctx, "drivers-last-seen", mock.Anything).Return(redis.NewStringSliceResult([]string{"driver1", "driver2"}, nil))
+	mockRedis.On("EvalSha", ctx, mock.Anything, []string{"drivers-last-seen"}, mock.MatchedBy(func(args []interface{}) bool {
+		return args[0] == "driver1"
+	})).Return(redis.NewCmdResult(int64(1), nil))
+	// driver2 pinged after the range read, the script finds a fresh score and keeps it
+	mockRedis.On("EvalSha", ctx, mock.Anything, []string{"drivers-last-seen"}, mock.MatchedBy(func(args []interface{}) bool {
+		return args[0] == "driver2"
+	})).Return(redis.NewCmdResult(int64(0), nil))
+	mockRedis.On("Pipelined", ctx).Return(nil).Once()
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult("", redis.Nil))
+	mockQuery.On("FindWorkLog", "driver1", mock.Anything, ctx).Return(utils.Result{Data: models.WorkLog{DriverID: "driver1", Log: []models.LogActivity{{Status: models.StatusAvailable}}}})
+	mockRedis.On("Set", ctx, "DRIVER:STATUS:driver1", models.StatusOffline, time.Duration(0)).Return(redis.NewStatusResult("OK", nil))
+	mockCommand.On("UpsertBeacon", mock.MatchedBy(func(w models.WorkLog) bool {
+		return w.DriverID == "driver1" && w.CurrentStatus() == models.StatusOffline
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.SweepStaleDrivers(time.Minute, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, []string{"driver1"}, result.Data)
+	mockRedis.AssertExpectations(t)
+	mockCommand.AssertExpectations(t)
+	mockQuery.AssertNotCalled(t, "FindWorkLog", "driver2", mock.Anything, ctx)
+}
+
+func TestUpdateLocation_WorkingPastMidnight(t *testing.T) {
+	mockQuery, _, mockRedis, _, usecase := newTestUsecase()
+	ctx := context.Background()
+
+	mockQuery.On("FindDriver", "driver1", ctx).Return(utils.Result{Data: models.User{Id: "driver1"}})
+	// the work-log of the new day is still empty, the status set yesterday is kept
+	mockRedis.On("Get", ctx, "DRIVER:STATUS:driver1").Return(redis.NewStringResult(models.StatusAvailable, nil))
+	mockRedis.On("Exists", ctx, []string{"DRIVER:RIDE:driver1"}).Return(redis.NewIntResult(0, nil))
+	mockRedis.On("Pipelined", ctx).Return(nil)
+	mockRedis.On("Publish", ctx, "driver-tracking:driver1", mock.Anything).Return(redis.NewIntResult(1, nil))
+
+	result := usecase.UpdateLocation("driver1", models.LocationRequest{Longitude: 106.8, Latitude: -6.2}, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, models.StatusAvailable, result.Data.(models.DriverLocation).Status)
+	mockQuery.AssertNotCalled(t, "FindWorkLog", mock.Anything, mock.Anything, mock.Anything)
+}
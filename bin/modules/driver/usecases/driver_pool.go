@@ -0,0 +1,94 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	driver "location-service/bin/modules/driver"
+	"location-service/bin/modules/driver/models"
+	"location-service/bin/modules/ride"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// driverPool is what the ride module may do to the dispatches and the drivers, the driver module keeps their storage
+type driverPool struct {
+	driverRepositoryQuery   driver.MongodbRepositoryQuery
+	driverRepositoryCommand driver.MongodbRepositoryCommand
+	redisClient             redis.UniversalClient
+}
+
+func NewDriverPool(mq driver.MongodbRepositoryQuery, mc driver.MongodbRepositoryCommand, rc redis.UniversalClient) ride.DriverPool {
+	return &driverPool{
+		driverRepositoryQuery:   mq,
+		driverRepositoryCommand: mc,
+		redisClient:             rc,
+	}
+}
+
+// CancelRideDispatch stops the driver search of the ride. When a driver accepted before it could be stopped, Data is
+// that driver, its match never reached the ride.
+func (p *driverPool) CancelRideDispatch(rideId string, ctx context.Context) utils.Result {
+	cancelRes := <-p.driverRepositoryCommand.CancelRideDispatch(rideId, time.Now(), ctx)
+	if cancelRes.Error != nil {
+		return cancelRes
+	}
+	if cancelled, _ := cancelRes.Data.(bool); cancelled {
+		return utils.Result{Data: ""}
+	}
+	dispatchRes := <-p.driverRepositoryQuery.FindRideDispatch(rideId, ctx)
+	if dispatchRes.Error != nil {
+		return dispatchRes
+	}
+	if dispatch, _ := dispatchRes.Data.(models.Dispatch); dispatch.Status == models.DispatchAssigned {
+		return utils.Result{Data: dispatch.DriverId}
+	}
+	return utils.Result{Data: ""}
+}
+
+// DriverPosition is the last position of the driver, on a trip or available, nil when it is not tracked anymore
+func (p *driverPool) DriverPosition(driverId string, ctx context.Context) *redis.GeoPos {
+	for _, key := range []string{constants.DriverOnTripLocationKey, constants.DriverLocationKey} {
+		positions, err := p.redisClient.GeoPos(ctx, key, driverId).Result()
+		if err == nil && len(positions) == 1 && positions[0] != nil {
+			return positions[0]
+		}
+	}
+	return nil
+}
+
+// ReleaseDriver ends the hold put on the driver when it accepted the ride and puts the driver back in the geo set of
+// available drivers at its last position. A driver already holding another ride is left alone.
+func (p *driverPool) ReleaseDriver(driverId string, rideId string, userId string, ctx context.Context) {
+	rideKey := fmt.Sprintf(constants.DriverRideKey, driverId)
+	heldRide, err := p.redisClient.Get(ctx, rideKey).Result()
+	if err != nil && err != redis.Nil {
+		log.GetLogger().Error("driver_pool", fmt.Sprintf("Failed get ride of driver %s", driverId), "ReleaseDriver", utils.ConvertString(err))
+		return
+	}
+	if heldRide != "" && heldRide != rideId {
+		return
+	}
+	position := p.DriverPosition(driverId, ctx)
+	_, err = p.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, rideKey)
+		pipe.Del(ctx, fmt.Sprintf(constants.TripDriverKey, userId))
+		if position != nil {
+			pipe.GeoAdd(ctx, constants.DriverLocationKey, &redis.GeoLocation{
+				Name:      driverId,
+				Longitude: position.Longitude,
+				Latitude:  position.Latitude,
+			})
+			pipe.ZRem(ctx, constants.DriverOnTripLocationKey, driverId)
+			pipe.ZAdd(ctx, constants.DriverAvailableSinceKey, redis.Z{Score: float64(time.Now().Unix()), Member: driverId})
+		}
+		return nil
+	})
+	if err != nil {
+		log.GetLogger().Error("driver_pool", fmt.Sprintf("Failed release driver %s", driverId), "ReleaseDriver", utils.ConvertString(err))
+	}
+}
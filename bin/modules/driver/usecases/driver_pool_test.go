@@ -0,0 +1,85 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"location-service/bin/modules/driver/models"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCancelRideDispatch_Stopped(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	pool := NewDriverPool(mockQuery, mockCommand, new(MockRedisClient))
+	ctx := context.Background()
+
+	mockCommand.On("CancelRideDispatch", "ride1", mock.Anything, ctx).Return(utils.Result{Data: true})
+
+	result := pool.CancelRideDispatch("ride1", ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "", result.Data)
+	mockQuery.AssertNotCalled(t, "FindRideDispatch", mock.Anything, mock.Anything)
+}
+
+func TestCancelRideDispatch_AcceptedMeanwhile(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	pool := NewDriverPool(mockQuery, mockCommand, new(MockRedisClient))
+	ctx := context.Background()
+
+	mockCommand.On("CancelRideDispatch", "ride1", mock.Anything, ctx).Return(utils.Result{Data: false})
+	mockQuery.On("FindRideDispatch", "ride1", ctx).Return(utils.Result{Data: models.Dispatch{RideId: "ride1", Status: models.DispatchAssigned, DriverId: "driver1"}})
+
+	result := pool.CancelRideDispatch("ride1", ctx)
+
+	// the driver accepted before the search could be stopped
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "driver1", result.Data)
+}
+
+func TestCancelRideDispatch_Error(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	pool := NewDriverPool(mockQuery, mockCommand, new(MockRedisClient))
+	ctx := context.Background()
+
+	mockCommand.On("CancelRideDispatch", "ride1", mock.Anything, ctx).Return(utils.Result{Error: errors.New("db down")})
+
+	result := pool.CancelRideDispatch("ride1", ctx)
+
+	assert.NotNil(t, result.Error)
+}
+
+func TestReleaseDriver(t *testing.T) {
+	mockRedis := new(MockRedisClient)
+	pool := NewDriverPool(new(MockMongodbRepositoryQuery), new(MockMongodbRepositoryCommand), mockRedis)
+	ctx := context.Background()
+
+	mockRedis.On("Get", ctx, "DRIVER:RIDE:driver1").Return(redis.NewStringResult("ride1", nil))
+	mockRedis.On("GeoPos", ctx, "drivers-on-trip-locations", []string{"driver1"}).Return(redis.NewGeoPosCmdResult([]*redis.GeoPos{{Longitude: 106.8, Latitude: -6.2}}, nil))
+	mockRedis.On("Pipelined", ctx).Return(nil)
+
+	pool.ReleaseDriver("driver1", "ride1", "rider1", ctx)
+
+	mockRedis.AssertExpectations(t)
+}
+
+func TestReleaseDriver_HoldingAnotherRide(t *testing.T) {
+	mockRedis := new(MockRedisClient)
+	pool := NewDriverPool(new(MockMongodbRepositoryQuery), new(MockMongodbRepositoryCommand), mockRedis)
+	ctx := context.Background()
+
+	mockRedis.On("Get", ctx, "DRIVER:RIDE:driver1").Return(redis.NewStringResult("ride2", nil))
+
+	pool.ReleaseDriver("driver1", "ride1", "rider1", ctx)
+
+	// the driver already took the next ride
+	mockRedis.AssertNotCalled(t, "Pipelined", mock.Anything)
+}
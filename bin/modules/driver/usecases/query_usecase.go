@@ -1,7 +1,14 @@
 package usecases
 
 import (
+	"context"
+	"fmt"
+
 	driver "location-service/bin/modules/driver"
+	"location-service/bin/modules/driver/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -17,3 +24,22 @@ func NewQueryUsecase(mq driver.MongodbRepositoryQuery, rh redis.UniversalClient)
 		redisClient:           rh,
 	}
 }
+
+func (q *queryUsecase) GetCommuteOffers(driverId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	offersRes := <-q.driverRepositoryQuery.FindCommuteOffers(driverId, ctx)
+	if offersRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get commute offers: %v", offersRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetCommuteOffers", utils.ConvertString(offersRes.Error))
+		return result
+	}
+	offers, _ := offersRes.Data.([]models.CommuteOffer)
+	if offers == nil {
+		offers = []models.CommuteOffer{}
+	}
+
+	result.Data = offers
+	return result
+}
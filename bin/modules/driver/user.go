@@ -2,29 +2,51 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"location-service/bin/modules/driver/models"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
 	//"go.mongodb.org/mongo-driver/bson"
 )
 
 type UsecaseQuery interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
+	GetCommuteOffers(userId string, ctx context.Context) utils.Result
 }
 
 type UsecaseCommand interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	ActivateBeacon(userId string, payload models.BeaconRequest, ctx context.Context) utils.Result
+	UpdateLocation(userId string, payload models.LocationRequest, ctx context.Context) utils.Result
+	SweepStaleDrivers(staleAfter time.Duration, ctx context.Context) utils.Result
+	OpenPoolTrip(userId string, payload models.PoolTripRequest, ctx context.Context) utils.Result
+	ClosePoolTrip(userId string, ctx context.Context) utils.Result
+	CreateCommuteOffer(userId string, payload models.CommuteOfferRequest, ctx context.Context) utils.Result
+	CloseCommuteOffer(userId string, offerId string, ctx context.Context) utils.Result
+	AcceptOffer(userId string, dispatchId string, ctx context.Context) utils.Result
+	RejectOffer(userId string, dispatchId string, ctx context.Context) utils.Result
+	AdvanceDispatches(ctx context.Context) utils.Result
 }
 
 type MongodbRepositoryQuery interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	FindWorkLog(driverId string, date string, ctx context.Context) <-chan utils.Result
 	FindDriver(userId string, ctx context.Context) <-chan utils.Result
+	FindCommuteOffers(driverId string, ctx context.Context) <-chan utils.Result
+	FindDispatch(dispatchId string, ctx context.Context) <-chan utils.Result
+	FindDueDispatches(now time.Time, limit int64, ctx context.Context) <-chan utils.Result
+	FindRideDispatch(rideId string, ctx context.Context) <-chan utils.Result
 }
 
 type MongodbRepositoryCommand interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	NewObjectID(ctx context.Context) string
 	UpsertBeacon(data models.WorkLog, ctx context.Context) <-chan utils.Result
+	InsertCommuteOffer(offer models.CommuteOffer, ctx context.Context) <-chan utils.Result
+	CloseCommuteOffer(driverId string, offerId string, ctx context.Context) <-chan utils.Result
+	UpdateDispatch(dispatch models.Dispatch, version int, ctx context.Context) <-chan utils.Result
+	CancelRideDispatch(rideId string, now time.Time, ctx context.Context) <-chan utils.Result
+	InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result
+	IncrementDriverStats(driverId string, offersReceived int, offersAccepted int, ctx context.Context) <-chan utils.Result
 }
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+	"location-service/bin/middlewares"
+	ride "location-service/bin/modules/ride"
+	"location-service/bin/modules/ride/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type rideHttpHandler struct {
+	rideUsecaseQuery   ride.UsecaseQuery
+	rideUseCaseCommand ride.UsecaseCommand
+}
+
+func InitRideHttpHandler(e *echo.Echo, uq ride.UsecaseQuery, uc ride.UsecaseCommand) {
+
+	handler := &rideHttpHandler{
+		rideUsecaseQuery:   uq,
+		rideUseCaseCommand: uc,
+	}
+	users := e.Group("/users")
+	users.GET("/v1/rides", handler.GetUserRides, middlewares.VerifyBearer)
+	users.GET("/v1/rides/:id", handler.GetUserRide, middlewares.VerifyBearer)
+	users.POST("/v1/rides/:id/cancel", handler.CancelUserRide, middlewares.VerifyBearer)
+
+	driver := e.Group("/driver")
+	driver.GET("/v1/rides", handler.GetDriverRides, middlewares.VerifyBearer)
+	driver.GET("/v1/rides/:id", handler.GetDriverRide, middlewares.VerifyBearer)
+	driver.PUT("/v1/rides/:id/status", handler.UpdateDriverStatus, middlewares.VerifyBearer)
+	driver.POST("/v1/rides/:id/cancel", handler.CancelDriverRide, middlewares.VerifyBearer)
+
+	e.GET("/admin/v1/rides/:id", handler.GetRide, middlewares.VerifyBasicAuth)
+}
+
+func (u rideHttpHandler) GetUserRides(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUsecaseQuery.GetUserRides(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get rides", 200, c)
+}
+
+func (u rideHttpHandler) GetUserRide(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUsecaseQuery.GetUserRide(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get ride", 200, c)
+}
+
+func (u rideHttpHandler) GetDriverRides(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUsecaseQuery.GetDriverRides(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get rides", 200, c)
+}
+
+func (u rideHttpHandler) GetDriverRide(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUsecaseQuery.GetDriverRide(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get ride", 200, c)
+}
+
+func (u rideHttpHandler) UpdateDriverStatus(c echo.Context) error {
+	var request models.DriverStatusRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUseCaseCommand.UpdateDriverStatus(userId, c.Param("id"), request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "update ride status", 200, c)
+}
+
+func (u rideHttpHandler) CancelUserRide(c echo.Context) error {
+	var request models.CancelRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUseCaseCommand.CancelUserRide(userId, c.Param("id"), request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "cancel ride", 200, c)
+}
+
+func (u rideHttpHandler) CancelDriverRide(c echo.Context) error {
+	var request models.CancelRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.rideUseCaseCommand.CancelDriverRide(userId, c.Param("id"), request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "cancel ride", 200, c)
+}
+
+// GetRide shows any ride with its timeline, for support
+func (u rideHttpHandler) GetRide(c echo.Context) error {
+	result := u.rideUsecaseQuery.GetRide(c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "get ride", 200, c)
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StatusQuoted         = "quoted"
+	StatusSearching      = "searching"
+	StatusOffered        = "offered"
+	StatusMatched        = "matched"
+	StatusDriverArriving = "driver-arriving"
+	StatusInProgress     = "in-progress"
+	StatusCompleted      = "completed"
+	StatusCancelled      = "cancelled"
+
+	ActorRider  = "rider"
+	ActorDriver = "driver"
+	ActorSystem = "system"
+)
+
+var ErrStatusChanged = errors.New("ride status changed")
+
+// an offered ride goes back to searching when every driver of the dispatch declined
+var rideTransitions = map[string][]string{
+	StatusQuoted:         {StatusSearching, StatusCancelled},
+	StatusSearching:      {StatusOffered, StatusCancelled},
+	StatusOffered:        {StatusMatched, StatusSearching, StatusCancelled},
+	StatusMatched:        {StatusDriverArriving, StatusCancelled},
+	StatusDriverArriving: {StatusInProgress, StatusCancelled},
+	StatusInProgress:     {StatusCompleted},
+}
+
+// CanTransition reports whether a ride in status from may move to status to
+func CanTransition(from, to string) bool {
+	for _, next := range rideTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type Location struct {
+	Longitude float64 `json:"longitude" bson:"longitude"`
+	Latitude  float64 `json:"latitude" bson:"latitude"`
+	Address   string  `json:"address" bson:"address"`
+}
+
+// RideEvent is a status the ride went through, who moved it there and when
+type RideEvent struct {
+	Status  string    `json:"status" bson:"status"`
+	Actor   string    `json:"actor" bson:"actor"`
+	ActorId string    `json:"actorId,omitempty" bson:"actorId,omitempty"`
+	Reason  string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	At      time.Time `json:"at" bson:"at"`
+}
+
+// Ride is a ride request from its quote to its end, Timeline keeps every status it went through. MatchedAt and
+// MatchLocation, where the driver was when it accepted, price a late cancellation.
+type Ride struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId          string             `json:"userId" bson:"userId"`
+	DriverId        string             `json:"driverId,omitempty" bson:"driverId,omitempty"`
+	DispatchId      string             `json:"dispatchId,omitempty" bson:"dispatchId,omitempty"`
+	Status          string             `json:"status" bson:"status"`
+	ServiceType     string             `json:"serviceType" bson:"serviceType"`
+	Pickup          Location           `json:"pickup" bson:"pickup"`
+	Stops           []Location         `json:"stops,omitempty" bson:"stops,omitempty"`
+	Destination     Location           `json:"destination" bson:"destination"`
+	Fare            float64            `json:"fare" bson:"fare"`
+	PickupAt        *time.Time         `json:"pickupAt,omitempty" bson:"pickupAt,omitempty"`
+	MatchedAt       *time.Time         `json:"matchedAt,omitempty" bson:"matchedAt,omitempty"`
+	MatchLocation   *Location          `json:"matchLocation,omitempty" bson:"matchLocation,omitempty"`
+	CancellationFee float64            `json:"cancellationFee,omitempty" bson:"cancellationFee,omitempty"`
+	Timeline        []RideEvent        `json:"timeline" bson:"timeline"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Transition moves a ride to Status. From, when set, only lets the transition happen from that status.
+// DriverId and DispatchId are recorded on the ride when set, DriverLocation is where the driver matched from.
+type Transition struct {
+	Status         string
+	From           string
+	Actor          string
+	ActorId        string
+	DriverId       string
+	DispatchId     string
+	Reason         string
+	DriverLocation *Location
+}
+
+// Apply validates the transition against the state machine and records it in the timeline
+func (r *Ride) Apply(transition Transition, now time.Time) error {
+	if transition.From != "" && transition.From != r.Status {
+		return ErrStatusChanged
+	}
+	if !CanTransition(r.Status, transition.Status) {
+		return fmt.Errorf("cannot move ride from %s to %s", r.Status, transition.Status)
+	}
+	r.Status = transition.Status
+	if transition.DriverId != "" {
+		r.DriverId = transition.DriverId
+	}
+	if transition.DispatchId != "" {
+		r.DispatchId = transition.DispatchId
+	}
+	if transition.Status == StatusMatched {
+		r.MatchedAt = &now
+		r.MatchLocation = transition.DriverLocation
+	}
+	r.Timeline = append(r.Timeline, RideEvent{
+		Status:  transition.Status,
+		Actor:   transition.Actor,
+		ActorId: transition.ActorId,
+		Reason:  transition.Reason,
+		At:      now,
+	})
+	r.UpdatedAt = now
+	return nil
+}
+
+// DriverStatusRequest is the progress a driver reports on its ride
+type DriverStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=driver-arriving in-progress completed"`
+}
+
+func (r *DriverStatusRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// CancelRequest is why the rider or the driver cancels the ride
+type CancelRequest struct {
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+func (r *CancelRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// RideCancelledEvent is the ride-cancelled event, keyed by rider. DriverId is the driver released by the cancellation,
+// Fee is charged to the rider wallet by the user module.
+type RideCancelledEvent struct {
+	RideId      string    `json:"rideId"`
+	UserId      string    `json:"userId"`
+	DriverId    string    `json:"driverId,omitempty"`
+	DispatchId  string    `json:"dispatchId,omitempty"`
+	CancelledBy string    `json:"cancelledBy"`
+	Reason      string    `json:"reason,omitempty"`
+	Fee         float64   `json:"fee"`
+	CancelledAt time.Time `json:"cancelledAt"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(StatusQuoted, StatusSearching))
+	assert.True(t, CanTransition(StatusOffered, StatusSearching))
+	assert.True(t, CanTransition(StatusDriverArriving, StatusInProgress))
+	assert.True(t, CanTransition(StatusMatched, StatusCancelled))
+
+	assert.False(t, CanTransition(StatusQuoted, StatusMatched))
+	assert.False(t, CanTransition(StatusInProgress, StatusCancelled))
+	assert.False(t, CanTransition(StatusCompleted, StatusCancelled))
+	assert.False(t, CanTransition(StatusCancelled, StatusSearching))
+}
+
+func TestRideApply(t *testing.T) {
+	now := time.Now()
+	ride := Ride{Status: StatusOffered}
+
+	err := ride.Apply(Transition{Status: StatusMatched, Actor: ActorDriver, ActorId: "driver1", DriverId: "driver1"}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatusMatched, ride.Status)
+	assert.Equal(t, "driver1", ride.DriverId)
+	assert.Equal(t, []RideEvent{{Status: StatusMatched, Actor: ActorDriver, ActorId: "driver1", At: now}}, ride.Timeline)
+	assert.Equal(t, now, ride.UpdatedAt)
+
+	assert.Error(t, ride.Apply(Transition{Status: StatusCompleted, Actor: ActorDriver}, now))
+	assert.ErrorIs(t, ride.Apply(Transition{Status: StatusCancelled, From: StatusQuoted, Actor: ActorSystem}, now), ErrStatusChanged)
+	assert.Len(t, ride.Timeline, 1)
+}
+
+func TestRideApplyMatchedRecordsDriverLocation(t *testing.T) {
+	now := time.Now()
+	ride := Ride{Status: StatusOffered}
+	location := &Location{Longitude: 106.8272, Latitude: -6.1754}
+
+	assert.NoError(t, ride.Apply(Transition{Status: StatusMatched, Actor: ActorDriver, DriverId: "driver1", DriverLocation: location}, now))
+	assert.Equal(t, &now, ride.MatchedAt)
+	assert.Equal(t, location, ride.MatchLocation)
+}
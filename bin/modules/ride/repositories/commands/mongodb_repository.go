@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"context"
+
+	ride "location-service/bin/modules/ride"
+	"location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/databases/mongodb"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type commandMongodbRepository struct {
+	mongoDb mongodb.MongoDBLogger
+}
+
+func NewCommandMongodbRepository(mongodb mongodb.MongoDBLogger) ride.MongodbRepositoryCommand {
+	return &commandMongodbRepository{
+		mongoDb: mongodb,
+	}
+}
+
+func (c commandMongodbRepository) InsertRide(ride models.Ride, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		ride.ID = primitive.NewObjectID()
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: "ride",
+			Document:       ride,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: ride,
+		}
+
+	}()
+
+	return output
+}
+
+// UpdateRide saves the ride only while it still has fromStatus, Data is whether the ride was updated.
+// Two transitions from the same status cannot both win.
+func (c commandMongodbRepository) UpdateRide(ride models.Ride, fromStatus string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var matched int64
+		err := c.mongoDb.UpdateOne(mongodb.UpdateOne{
+			Result:         &matched,
+			CollectionName: "ride",
+			Filter: bson.M{
+				"_id":    ride.ID,
+				"status": fromStatus,
+			},
+			Document: ride,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: outbox.CollectionName,
+			Document:       event,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: event,
+		}
+
+	}()
+
+	return output
+}
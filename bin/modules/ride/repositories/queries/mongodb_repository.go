@@ -0,0 +1,105 @@
+package queries
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	ride "location-service/bin/modules/ride"
+	"location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/databases/mongodb"
+	"location-service/bin/pkg/utils"
+)
+
+// rideHistorySize is how many rides the history endpoints return, the latest first
+const rideHistorySize = 50
+
+type queryMongodbRepository struct {
+	mongoDb mongodb.MongoDBLogger
+}
+
+func NewQueryMongodbRepository(mongodb mongodb.MongoDBLogger) ride.MongodbRepositoryQuery {
+	return &queryMongodbRepository{
+		mongoDb: mongodb,
+	}
+}
+
+// FindRide returns an empty ride when rideId is not a ride
+func (q queryMongodbRepository) FindRide(rideId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var ride models.Ride
+		id, err := primitive.ObjectIDFromHex(rideId)
+		if err != nil {
+			output <- utils.Result{
+				Data: ride,
+			}
+			return
+		}
+
+		err = q.mongoDb.FindOne(mongodb.FindOne{
+			Result:         &ride,
+			CollectionName: "ride",
+			Filter: bson.M{
+				"_id": id,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: ride,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindRidesByUser(userId string, ctx context.Context) <-chan utils.Result {
+	return q.findRides(bson.M{"userId": userId}, ctx)
+}
+
+func (q queryMongodbRepository) FindRidesByDriver(driverId string, ctx context.Context) <-chan utils.Result {
+	return q.findRides(bson.M{"driverId": driverId}, ctx)
+}
+
+func (q queryMongodbRepository) findRides(filter bson.M, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var rides []models.Ride
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &rides,
+			CollectionName: "ride",
+			Filter:         filter,
+			Sort: &mongodb.Sort{
+				FieldName: "createdAt",
+				By:        mongodb.SortDescending,
+			},
+			Page: 1,
+			Size: rideHistorySize,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: rides,
+		}
+
+	}()
+
+	return output
+}
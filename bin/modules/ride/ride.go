@@ -0,0 +1,55 @@
+package ride
+
+import (
+	"context"
+
+	"location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type UsecaseQuery interface {
+	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
+	GetUserRides(userId string, ctx context.Context) utils.Result
+	GetUserRide(userId string, rideId string, ctx context.Context) utils.Result
+	GetDriverRides(driverId string, ctx context.Context) utils.Result
+	GetDriverRide(driverId string, rideId string, ctx context.Context) utils.Result
+	GetRide(rideId string, ctx context.Context) utils.Result
+}
+
+type UsecaseCommand interface {
+	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
+	CreateRide(ride models.Ride, ctx context.Context) utils.Result
+	Transition(rideId string, payload models.Transition, ctx context.Context) utils.Result
+	UpdateDriverStatus(driverId string, rideId string, payload models.DriverStatusRequest, ctx context.Context) utils.Result
+	CancelUserRide(userId string, rideId string, payload models.CancelRequest, ctx context.Context) utils.Result
+	CancelDriverRide(driverId string, rideId string, payload models.CancelRequest, ctx context.Context) utils.Result
+}
+
+type MongodbRepositoryQuery interface {
+	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
+	FindRide(rideId string, ctx context.Context) <-chan utils.Result
+	FindRidesByUser(userId string, ctx context.Context) <-chan utils.Result
+	FindRidesByDriver(driverId string, ctx context.Context) <-chan utils.Result
+}
+
+type MongodbRepositoryCommand interface {
+	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
+	InsertRide(ride models.Ride, ctx context.Context) <-chan utils.Result
+	UpdateRide(ride models.Ride, fromStatus string, ctx context.Context) <-chan utils.Result
+	InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result
+}
+
+// DriverPool is the part of the driver module the ride lifecycle needs, the dispatch of a ride and the hold on its
+// driver belong to the driver module
+type DriverPool interface {
+	// CancelRideDispatch stops the driver search of the ride, Data is the driver who accepted it before it could be
+	// stopped, empty otherwise
+	CancelRideDispatch(rideId string, ctx context.Context) utils.Result
+	// DriverPosition is the last position of the driver, on a trip or available, nil when it is not tracked anymore
+	DriverPosition(driverId string, ctx context.Context) *redis.GeoPos
+	// ReleaseDriver ends the hold on the driver of the ride of the rider and puts the driver back in matching
+	ReleaseDriver(driverId string, rideId string, userId string, ctx context.Context)
+}
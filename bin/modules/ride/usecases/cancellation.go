@@ -0,0 +1,48 @@
+package usecases
+
+import (
+	"math"
+	"time"
+
+	"location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CancellationPolicy prices a rider cancellation once a driver is on the way: free within FreeWindow of the match,
+// then BaseFee plus FeePerKm for every km the driver got closer to the pickup since the match, capped at MaxFee
+type CancellationPolicy struct {
+	FreeWindow time.Duration
+	BaseFee    float64
+	FeePerKm   float64
+	MaxFee     float64
+}
+
+// DefaultCancellationPolicy lets the rider change their mind for two minutes after the match
+var DefaultCancellationPolicy = CancellationPolicy{
+	FreeWindow: 2 * time.Minute,
+	BaseFee:    5000,
+	FeePerKm:   1000,
+	MaxFee:     20000,
+}
+
+// Fee is what the rider owes for cancelling the ride at now, a ride nobody was matched to is free
+func (p CancellationPolicy) Fee(ride models.Ride, driverKm float64, now time.Time) float64 {
+	if ride.MatchedAt == nil || now.Sub(*ride.MatchedAt) < p.FreeWindow {
+		return 0
+	}
+	fee := p.BaseFee + p.FeePerKm*math.Max(driverKm, 0)
+	return math.Round(math.Min(fee, p.MaxFee))
+}
+
+// progressKm is how much closer to the pickup the driver is than where it matched, 0 when either position is
+// unknown or the driver got no closer. A detour or a lap around the block does not count.
+func progressKm(ride models.Ride, position *redis.GeoPos) float64 {
+	if ride.MatchLocation == nil || position == nil {
+		return 0
+	}
+	atMatch := utils.HaversineKm(ride.MatchLocation.Latitude, ride.MatchLocation.Longitude, ride.Pickup.Latitude, ride.Pickup.Longitude)
+	now := utils.HaversineKm(position.Latitude, position.Longitude, ride.Pickup.Latitude, ride.Pickup.Longitude)
+	return math.Max(atMatch-now, 0)
+}
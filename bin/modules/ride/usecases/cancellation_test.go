@@ -0,0 +1,48 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+
+	"location-service/bin/modules/ride/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancellationFee(t *testing.T) {
+	policy := CancellationPolicy{FreeWindow: 2 * time.Minute, BaseFee: 5000, FeePerKm: 1000, MaxFee: 8000}
+	now := time.Now()
+	matchedAt := now.Add(-5 * time.Minute)
+
+	assert.Equal(t, 0.0, policy.Fee(models.Ride{Status: models.StatusSearching}, 0, now))
+	assert.Equal(t, 0.0, policy.Fee(models.Ride{MatchedAt: &matchedAt}, 1, matchedAt.Add(time.Minute)))
+	assert.Equal(t, 5000.0, policy.Fee(models.Ride{MatchedAt: &matchedAt}, 0, now))
+	assert.Equal(t, 6500.0, policy.Fee(models.Ride{MatchedAt: &matchedAt}, 1.5, now))
+	assert.Equal(t, 8000.0, policy.Fee(models.Ride{MatchedAt: &matchedAt}, 10, now))
+}
+
+func TestCancellationFee_ZeroValues(t *testing.T) {
+	now := time.Now()
+	matchedAt := now.Add(-5 * time.Second)
+
+	// no free window charges right after the match, no fee never charges
+	noWindow := CancellationPolicy{BaseFee: 5000, FeePerKm: 1000, MaxFee: 8000}
+	assert.Equal(t, 5000.0, noWindow.Fee(models.Ride{MatchedAt: &matchedAt}, 0, now))
+	free := CancellationPolicy{FreeWindow: time.Second}
+	assert.Equal(t, 0.0, free.Fee(models.Ride{MatchedAt: &matchedAt}, 10, now))
+}
+
+func TestProgressKm(t *testing.T) {
+	ride := models.Ride{
+		Pickup:        models.Location{Longitude: 106.8272, Latitude: -6.1554},
+		MatchLocation: &models.Location{Longitude: 106.8272, Latitude: -6.1754},
+	}
+
+	assert.Equal(t, 0.0, progressKm(models.Ride{Pickup: ride.Pickup}, &redis.GeoPos{Longitude: 106.8272, Latitude: -6.1754}))
+	assert.Equal(t, 0.0, progressKm(ride, nil))
+	assert.InDelta(t, 1.11, progressKm(ride, &redis.GeoPos{Longitude: 106.8272, Latitude: -6.1654}), 0.01)
+	// driving away from the pickup, or around it at the same distance, is no progress
+	assert.Equal(t, 0.0, progressKm(ride, &redis.GeoPos{Longitude: 106.8272, Latitude: -6.1854}))
+	assert.InDelta(t, 0.0, progressKm(ride, &redis.GeoPos{Longitude: 106.8272, Latitude: -6.1354}), 0.01)
+}
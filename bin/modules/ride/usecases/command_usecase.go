@@ -0,0 +1,230 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	ride "location-service/bin/modules/ride"
+	"location-service/bin/modules/ride/models"
+	"location-service/bin/pkg/constants"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type commandUsecase struct {
+	rideRepositoryQuery   ride.MongodbRepositoryQuery
+	rideRepositoryCommand ride.MongodbRepositoryCommand
+	redisClient           redis.UniversalClient
+	cancellationPolicy    CancellationPolicy
+	drivers               ride.DriverPool
+}
+
+func NewCommandUsecase(mq ride.MongodbRepositoryQuery, mc ride.MongodbRepositoryCommand, rc redis.UniversalClient, cp CancellationPolicy, dp ride.DriverPool) ride.UsecaseCommand {
+	return &commandUsecase{
+		rideRepositoryQuery:   mq,
+		rideRepositoryCommand: mc,
+		redisClient:           rc,
+		cancellationPolicy:    cp,
+		drivers:               dp,
+	}
+}
+
+// CreateRide saves a quoted ride, result.Data is the ride with its id
+func (c *commandUsecase) CreateRide(ride models.Ride, ctx context.Context) utils.Result {
+	var result utils.Result
+	now := time.Now()
+	ride.Status = models.StatusQuoted
+	ride.Timeline = []models.RideEvent{{
+		Status:  models.StatusQuoted,
+		Actor:   models.ActorRider,
+		ActorId: ride.UserId,
+		At:      now,
+	}}
+	ride.CreatedAt = now
+	ride.UpdatedAt = now
+	insertRes := <-c.rideRepositoryCommand.InsertRide(ride, ctx)
+	if insertRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed create ride: %v", insertRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CreateRide", utils.ConvertString(insertRes.Error))
+		return result
+	}
+
+	result.Data = insertRes.Data
+	return result
+}
+
+// Transition moves the ride through the state machine, a transition the state machine does not allow or that lost
+// the race to another one is a conflict
+func (c *commandUsecase) Transition(rideId string, payload models.Transition, ctx context.Context) utils.Result {
+	var result utils.Result
+	rideRes := <-c.rideRepositoryQuery.FindRide(rideId, ctx)
+	if rideRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get ride: %v", rideRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "Transition", utils.ConvertString(rideRes.Error))
+		return result
+	}
+	ride, _ := rideRes.Data.(models.Ride)
+	// a driver only moves its own ride, or the ride it is being assigned
+	driverId := ride.DriverId
+	if payload.DriverId != "" {
+		driverId = payload.DriverId
+	}
+	if ride.ID.IsZero() || (payload.Actor == models.ActorDriver && driverId != payload.ActorId) {
+		return rideNotFound()
+	}
+
+	fromStatus := ride.Status
+	if err := ride.Apply(payload, time.Now()); err != nil {
+		errObj := httpError.NewConflict()
+		errObj.Message = err.Error()
+		if errors.Is(err, models.ErrStatusChanged) {
+			errObj.Message = fmt.Sprintf("Ride is %s now", ride.Status)
+		}
+		result.Error = errObj
+		return result
+	}
+	if errObj := c.updateRide(ride, fromStatus, ctx); errObj != nil {
+		result.Error = errObj
+		return result
+	}
+
+	result.Data = ride
+	return result
+}
+
+// UpdateDriverStatus records the progress the assigned driver reports on the ride, the driver is back in matching
+// once the ride is completed
+func (c *commandUsecase) UpdateDriverStatus(driverId string, rideId string, payload models.DriverStatusRequest, ctx context.Context) utils.Result {
+	result := c.Transition(rideId, models.Transition{
+		Status:  payload.Status,
+		Actor:   models.ActorDriver,
+		ActorId: driverId,
+	}, ctx)
+	if result.Error == nil && payload.Status == models.StatusCompleted {
+		ride := result.Data.(models.Ride)
+		c.drivers.ReleaseDriver(driverId, ride.ID.Hex(), ride.UserId, ctx)
+	}
+	return result
+}
+
+// CancelUserRide cancels the ride of the rider at any point before the pickup, a late cancellation of a matched ride
+// is charged to the rider wallet
+func (c *commandUsecase) CancelUserRide(userId string, rideId string, payload models.CancelRequest, ctx context.Context) utils.Result {
+	return c.cancelRide(models.ActorRider, userId, rideId, payload.Reason, ctx)
+}
+
+// CancelDriverRide gives up the ride the driver accepted, before the pickup and without a fee
+func (c *commandUsecase) CancelDriverRide(driverId string, rideId string, payload models.CancelRequest, ctx context.Context) utils.Result {
+	return c.cancelRide(models.ActorDriver, driverId, rideId, payload.Reason, ctx)
+}
+
+// cancelRide cancels the ride then stops its driver search, puts its driver back in matching and publishes
+// ride-cancelled, the user module charges the fee it carries to the rider wallet
+func (c *commandUsecase) cancelRide(actor string, actorId string, rideId string, reason string, ctx context.Context) utils.Result {
+	var result utils.Result
+	rideRes := <-c.rideRepositoryQuery.FindRide(rideId, ctx)
+	if rideRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get ride: %v", rideRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "cancelRide", utils.ConvertString(rideRes.Error))
+		return result
+	}
+	ride, _ := rideRes.Data.(models.Ride)
+	owner := ride.UserId
+	if actor == models.ActorDriver {
+		owner = ride.DriverId
+	}
+	if ride.ID.IsZero() || owner != actorId {
+		return rideNotFound()
+	}
+
+	now := time.Now()
+	fromStatus := ride.Status
+	driverId := ride.DriverId
+	var driverPosition *redis.GeoPos
+	if driverId != "" {
+		driverPosition = c.drivers.DriverPosition(driverId, ctx)
+	}
+	if actor == models.ActorRider {
+		ride.CancellationFee = c.cancellationPolicy.Fee(ride, progressKm(ride, driverPosition), now)
+	}
+	if err := ride.Apply(models.Transition{
+		Status:  models.StatusCancelled,
+		Actor:   actor,
+		ActorId: actorId,
+		Reason:  reason,
+	}, now); err != nil {
+		errObj := httpError.NewConflict()
+		errObj.Message = fmt.Sprintf("Ride is %s, it cannot be cancelled anymore", fromStatus)
+		result.Error = errObj
+		return result
+	}
+	if errObj := c.updateRide(ride, fromStatus, ctx); errObj != nil {
+		result.Error = errObj
+		return result
+	}
+
+	// the ride is cancelled, a failure below is logged and does not undo it
+	cancelRes := c.drivers.CancelRideDispatch(rideId, ctx)
+	if cancelRes.Error != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed cancel dispatch of ride %s", rideId), "cancelRide", utils.ConvertString(cancelRes.Error))
+	}
+	if accepted, _ := cancelRes.Data.(string); accepted != "" && fromStatus == models.StatusOffered {
+		// a driver accepted while the ride was being cancelled, its match never reached the ride
+		driverId = accepted
+	}
+	if fromStatus == models.StatusSearching || fromStatus == models.StatusOffered {
+		// the rider can search again
+		if err := c.redisClient.Del(ctx, fmt.Sprintf(constants.RiderSearchKey, ride.UserId)).Err(); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed end search of rider %s", ride.UserId), "cancelRide", utils.ConvertString(err))
+		}
+	}
+	if driverId != "" {
+		c.drivers.ReleaseDriver(driverId, rideId, ride.UserId, ctx)
+	}
+	payload, _ := json.Marshal(models.RideCancelledEvent{
+		RideId:      rideId,
+		UserId:      ride.UserId,
+		DriverId:    driverId,
+		DispatchId:  ride.DispatchId,
+		CancelledBy: actor,
+		Reason:      reason,
+		Fee:         ride.CancellationFee,
+		CancelledAt: now,
+	})
+	if outboxRes := <-c.rideRepositoryCommand.InsertOutbox(outbox.NewEvent("ride-cancelled", ride.UserId, payload), ctx); outboxRes.Error != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Failed publish ride-cancelled of ride %s", rideId), "cancelRide", utils.ConvertString(outboxRes.Error))
+	}
+
+	result.Data = ride
+	return result
+}
+
+// updateRide saves the ride only while it is still in fromStatus, another transition that got there first is a conflict
+func (c *commandUsecase) updateRide(ride models.Ride, fromStatus string, ctx context.Context) interface{} {
+	updateRes := <-c.rideRepositoryCommand.UpdateRide(ride, fromStatus, ctx)
+	if updateRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed update ride: %v", updateRes.Error)
+		log.GetLogger().Error("command_usecase", errObj.Message, "updateRide", utils.ConvertString(updateRes.Error))
+		return errObj
+	}
+	if updated, _ := updateRes.Data.(bool); !updated {
+		errObj := httpError.NewConflict()
+		errObj.Message = "Ride was just updated, please try again"
+		return errObj
+	}
+	return nil
+}
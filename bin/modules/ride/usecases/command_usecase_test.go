@@ -0,0 +1,231 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+
+	"location-service/bin/modules/ride/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockMongodbRepositoryQuery struct {
+	mock.Mock
+}
+
+func (m *MockMongodbRepositoryQuery) FindRide(rideId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(rideId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindRidesByUser(userId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(userId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindRidesByDriver(driverId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(driverId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+type MockMongodbRepositoryCommand struct {
+	mock.Mock
+}
+
+func (m *MockMongodbRepositoryCommand) InsertRide(ride models.Ride, ctx context.Context) <-chan utils.Result {
+	args := m.Called(ride, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) UpdateRide(ride models.Ride, fromStatus string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(ride, fromStatus, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	args := m.Called(event, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+type MockRedisClient struct {
+	mock.Mock
+	redis.UniversalClient
+}
+
+func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	args := m.Called(ctx, keys)
+	return args.Get(0).(*redis.IntCmd)
+}
+
+type MockDriverPool struct {
+	mock.Mock
+}
+
+func (m *MockDriverPool) CancelRideDispatch(rideId string, ctx context.Context) utils.Result {
+	args := m.Called(rideId, ctx)
+	return args.Get(0).(utils.Result)
+}
+
+func (m *MockDriverPool) DriverPosition(driverId string, ctx context.Context) *redis.GeoPos {
+	args := m.Called(driverId, ctx)
+	position, _ := args.Get(0).(*redis.GeoPos)
+	return position
+}
+
+func (m *MockDriverPool) ReleaseDriver(driverId string, rideId string, userId string, ctx context.Context) {
+	m.Called(driverId, rideId, userId, ctx)
+}
+
+func TestTransition_Matched(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, DefaultCancellationPolicy, nil)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), UserId: "rider1", Status: models.StatusOffered}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+	mockCommand.On("UpdateRide", mock.MatchedBy(func(r models.Ride) bool {
+		return r.Status == models.StatusMatched && r.DriverId == "driver1" && len(r.Timeline) == 1
+	}), models.StatusOffered, ctx).Return(utils.Result{Data: true})
+
+	result := usecase.Transition(ride.ID.Hex(), models.Transition{
+		Status:   models.StatusMatched,
+		Actor:    models.ActorDriver,
+		ActorId:  "driver1",
+		DriverId: "driver1",
+	}, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, models.StatusMatched, result.Data.(models.Ride).Status)
+	mockCommand.AssertExpectations(t)
+}
+
+func TestUpdateDriverStatus_NotTheDriver(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, DefaultCancellationPolicy, nil)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), DriverId: "driver1", Status: models.StatusMatched}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+
+	result := usecase.UpdateDriverStatus("driver2", ride.ID.Hex(), models.DriverStatusRequest{Status: models.StatusDriverArriving}, ctx)
+
+	assert.IsType(t, httpError.NotFoundData{}, result.Error)
+	mockCommand.AssertNotCalled(t, "UpdateRide", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateDriverStatus_InvalidTransition(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, DefaultCancellationPolicy, nil)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), DriverId: "driver1", Status: models.StatusMatched}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+
+	result := usecase.UpdateDriverStatus("driver1", ride.ID.Hex(), models.DriverStatusRequest{Status: models.StatusCompleted}, ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+}
+
+func TestCancelUserRide_Searching(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockRedis := new(MockRedisClient)
+	mockDrivers := new(MockDriverPool)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, mockRedis, DefaultCancellationPolicy, mockDrivers)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), UserId: "rider1", Status: models.StatusSearching}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+	mockCommand.On("UpdateRide", mock.MatchedBy(func(r models.Ride) bool {
+		return r.Status == models.StatusCancelled && r.CancellationFee == 0 && r.Timeline[0].Reason == "changed my mind"
+	}), models.StatusSearching, ctx).Return(utils.Result{Data: true})
+	mockDrivers.On("CancelRideDispatch", ride.ID.Hex(), ctx).Return(utils.Result{})
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:rider1"}).Return(redis.NewIntResult(1, nil))
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool {
+		return e.Topic == "ride-cancelled" && e.Key == "rider1"
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.CancelUserRide("rider1", ride.ID.Hex(), models.CancelRequest{Reason: "changed my mind"}, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, models.StatusCancelled, result.Data.(models.Ride).Status)
+	mockCommand.AssertExpectations(t)
+	mockRedis.AssertExpectations(t)
+	mockDrivers.AssertNotCalled(t, "ReleaseDriver", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelUserRide_AcceptedWhileCancelling(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockRedis := new(MockRedisClient)
+	mockDrivers := new(MockDriverPool)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, mockRedis, DefaultCancellationPolicy, mockDrivers)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), UserId: "rider1", Status: models.StatusOffered}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+	mockCommand.On("UpdateRide", mock.Anything, models.StatusOffered, ctx).Return(utils.Result{Data: true})
+	mockDrivers.On("CancelRideDispatch", ride.ID.Hex(), ctx).Return(utils.Result{Data: "driver1"})
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:rider1"}).Return(redis.NewIntResult(1, nil))
+	mockDrivers.On("ReleaseDriver", "driver1", ride.ID.Hex(), "rider1", ctx).Return()
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(e outbox.Event) bool {
+		return e.Topic == "ride-cancelled"
+	}), ctx).Return(utils.Result{})
+
+	result := usecase.CancelUserRide("rider1", ride.ID.Hex(), models.CancelRequest{}, ctx)
+
+	// the driver accepted before the dispatch could be stopped, it is given back to matching
+	assert.Nil(t, result.Error)
+	mockDrivers.AssertExpectations(t)
+}
+
+func TestCancelUserRide_InProgress(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, DefaultCancellationPolicy, nil)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), UserId: "rider1", Status: models.StatusInProgress}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+
+	result := usecase.CancelUserRide("rider1", ride.ID.Hex(), models.CancelRequest{}, ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockCommand.AssertNotCalled(t, "UpdateRide", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelDriverRide_NotTheDriver(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, DefaultCancellationPolicy, nil)
+	ctx := context.Background()
+	ride := models.Ride{ID: primitive.NewObjectID(), UserId: "rider1", DriverId: "driver1", Status: models.StatusMatched}
+
+	mockQuery.On("FindRide", ride.ID.Hex(), ctx).Return(utils.Result{Data: ride})
+
+	result := usecase.CancelDriverRide("driver2", ride.ID.Hex(), models.CancelRequest{}, ctx)
+
+	assert.IsType(t, httpError.NotFoundData{}, result.Error)
+	mockCommand.AssertNotCalled(t, "UpdateRide", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,94 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+
+	ride "location-service/bin/modules/ride"
+	"location-service/bin/modules/ride/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+)
+
+type queryUsecase struct {
+	rideRepositoryQuery ride.MongodbRepositoryQuery
+}
+
+func NewQueryUsecase(mq ride.MongodbRepositoryQuery) ride.UsecaseQuery {
+	return &queryUsecase{
+		rideRepositoryQuery: mq,
+	}
+}
+
+func (q *queryUsecase) GetUserRides(userId string, ctx context.Context) utils.Result {
+	return q.getRides(<-q.rideRepositoryQuery.FindRidesByUser(userId, ctx), "GetUserRides")
+}
+
+func (q *queryUsecase) GetDriverRides(driverId string, ctx context.Context) utils.Result {
+	return q.getRides(<-q.rideRepositoryQuery.FindRidesByDriver(driverId, ctx), "GetDriverRides")
+}
+
+// GetUserRide answers not found for the rides of other riders
+func (q *queryUsecase) GetUserRide(userId string, rideId string, ctx context.Context) utils.Result {
+	result := q.GetRide(rideId, ctx)
+	if ride, ok := result.Data.(models.Ride); ok && ride.UserId != userId {
+		return rideNotFound()
+	}
+	return result
+}
+
+// GetDriverRide answers not found for the rides of other drivers
+func (q *queryUsecase) GetDriverRide(driverId string, rideId string, ctx context.Context) utils.Result {
+	result := q.GetRide(rideId, ctx)
+	if ride, ok := result.Data.(models.Ride); ok && ride.DriverId != driverId {
+		return rideNotFound()
+	}
+	return result
+}
+
+// GetRide returns any ride with its timeline, for support
+func (q *queryUsecase) GetRide(rideId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	rideRes := <-q.rideRepositoryQuery.FindRide(rideId, ctx)
+	if rideRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get ride: %v", rideRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetRide", utils.ConvertString(rideRes.Error))
+		return result
+	}
+	ride, _ := rideRes.Data.(models.Ride)
+	if ride.ID.IsZero() {
+		return rideNotFound()
+	}
+
+	result.Data = ride
+	return result
+}
+
+func (q *queryUsecase) getRides(ridesRes utils.Result, scope string) utils.Result {
+	var result utils.Result
+	if ridesRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Failed get rides: %v", ridesRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, scope, utils.ConvertString(ridesRes.Error))
+		return result
+	}
+	rides, _ := ridesRes.Data.([]models.Ride)
+	if rides == nil {
+		rides = []models.Ride{}
+	}
+
+	result.Data = rides
+	return result
+}
+
+func rideNotFound() utils.Result {
+	var result utils.Result
+	errObj := httpError.NewNotFound()
+	errObj.Message = "Ride not found"
+	result.Error = errObj
+	return result
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	kafkaPkgConfluent "location-service/bin/pkg/kafka/confluent"
+
+	k "gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type requestRideEventHandler struct {
+	userUseCaseCommand user.UsecaseCommand
+}
+
+// NewRequestRideEventHandler counts every request-ride, whoever produced it, in the surge demand
+func NewRequestRideEventHandler(uc user.UsecaseCommand) kafkaPkgConfluent.ConsumerHandler {
+	return &requestRideEventHandler{
+		userUseCaseCommand: uc,
+	}
+}
+
+func (h requestRideEventHandler) HandleMessage(message *k.Message) error {
+	var event models.RequestRide
+	if err := json.Unmarshal(message.Value, &event); err != nil {
+		return fmt.Errorf("%w: request-ride payload: %v", kafkaPkgConfluent.ErrInvalidMessage, err)
+	}
+	if event.UserId == "" {
+		return fmt.Errorf("%w: request-ride without userId", kafkaPkgConfluent.ErrInvalidMessage)
+	}
+
+	// demand is keyed by rider, the request-ride of our own FindDriver does not count twice
+	result := h.userUseCaseCommand.RecordRideDemand(event, context.Background())
+	if result.Error != nil {
+		return fmt.Errorf("record ride demand: %v", result.Error)
+	}
+	return nil
+}
+
+type rideCancelledEventHandler struct {
+	userUseCaseCommand user.UsecaseCommand
+}
+
+// NewRideCancelledEventHandler charges the fee of a late cancellation to the rider wallet
+func NewRideCancelledEventHandler(uc user.UsecaseCommand) kafkaPkgConfluent.ConsumerHandler {
+	return &rideCancelledEventHandler{
+		userUseCaseCommand: uc,
+	}
+}
+
+func (h rideCancelledEventHandler) HandleMessage(message *k.Message) error {
+	var event models.RideCancelled
+	if err := json.Unmarshal(message.Value, &event); err != nil {
+		return fmt.Errorf("%w: ride-cancelled payload: %v", kafkaPkgConfluent.ErrInvalidMessage, err)
+	}
+	if event.Fee <= 0 {
+		return nil
+	}
+	if event.UserId == "" || event.RideId == "" {
+		return fmt.Errorf("%w: ride-cancelled without userId or rideId", kafkaPkgConfluent.ErrInvalidMessage)
+	}
+
+	result := h.userUseCaseCommand.ChargeCancellationFee(event, context.Background())
+	if result.Error != nil {
+		return fmt.Errorf("charge cancellation fee: %v", result.Error)
+	}
+	return nil
+}
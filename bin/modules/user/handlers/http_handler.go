@@ -1,31 +1,63 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"location-service/bin/middlewares"
 	"location-service/bin/modules/user"
 	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
 	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/hub"
+	"location-service/bin/pkg/log"
 	"location-service/bin/pkg/utils"
+	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
 )
 
 type userHttpHandler struct {
 	userUsecaseQuery   user.UsecaseQuery
 	userUseCaseCommand user.UsecaseCommand
+	trackingHub        *hub.Hub
 }
 
-func InituserHttpHandler(e *echo.Echo, uq user.UsecaseQuery, uc user.UsecaseCommand) {
+// InituserHttpHandler registers the rider routes, idempotency guards the ones a retry or a double tap would repeat
+func InituserHttpHandler(e *echo.Echo, uq user.UsecaseQuery, uc user.UsecaseCommand, th *hub.Hub, idempotency echo.MiddlewareFunc) {
 
 	handler := &userHttpHandler{
 		userUsecaseQuery:   uq,
 		userUseCaseCommand: uc,
+		trackingHub:        th,
 	}
 	route := e.Group("/users")
 	route.GET("/profile", handler.Getuser, middlewares.VerifyBearer)
-	route.POST("/v1/post-location", handler.PostLocation, middlewares.VerifyBearer)
-	route.GET("/v1/find-driver", handler.FindDriver, middlewares.VerifyBearer)
+	route.POST("/v1/post-location", handler.PostLocation, middlewares.VerifyBearer, idempotency)
+	route.GET("/v1/find-driver", handler.FindDriver, middlewares.VerifyBearer, idempotency)
+	route.GET("/v1/find-pool", handler.FindPool, middlewares.VerifyBearer, idempotency)
+	route.GET("/v1/commute-offers", handler.SearchCommuteOffers, middlewares.VerifyBearer)
+	route.GET("/v1/trip/ws", handler.TrackDriver, middlewares.VerifySocketBearer)
+	route.GET("/v1/trip/stream", handler.StreamTrip, middlewares.VerifySocketBearer)
+
+	admin := e.Group("/admin/v1/surge", middlewares.VerifyBasicAuth)
+	admin.GET("/:zone", handler.GetSurge)
+	admin.PUT("/:zone", handler.OverrideSurge)
+	admin.DELETE("/:zone", handler.ClearSurgeOverride)
+	e.GET("/admin/v1/route-cache/stats", handler.GetRouteCacheStats, middlewares.VerifyBasicAuth)
+
+	route.GET("/v1/places/autocomplete", handler.AutocompletePlaces, middlewares.VerifyBearer)
+	route.GET("/v1/places/reverse", handler.ReverseGeocode, middlewares.VerifyBearer)
+
+	route.GET("/v1/saved-places", handler.GetSavedPlaces, middlewares.VerifyBearer)
+	route.POST("/v1/saved-places", handler.CreateSavedPlace, middlewares.VerifyBearer, idempotency)
+	route.PUT("/v1/saved-places/:id", handler.UpdateSavedPlace, middlewares.VerifyBearer)
+	route.DELETE("/v1/saved-places/:id", handler.DeleteSavedPlace, middlewares.VerifyBearer)
+	route.GET("/v1/recent-destinations", handler.GetRecentDestinations, middlewares.VerifyBearer)
+	route.GET("/v1/scheduled-rides", handler.GetScheduledRides, middlewares.VerifyBearer)
+	route.POST("/v1/scheduled-rides", handler.ScheduleRide, middlewares.VerifyBearer, idempotency)
+	route.DELETE("/v1/scheduled-rides/:id", handler.CancelScheduledRide, middlewares.VerifyBearer)
 
 }
 
@@ -73,3 +105,327 @@ func (u userHttpHandler) FindDriver(c echo.Context) error {
 
 	return utils.Response(result.Data, "finding driver", 200, c)
 }
+
+// TrackDriver streams the live position of the driver assigned to the rider trip over a websocket
+func (u userHttpHandler) TrackDriver(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUsecaseQuery.GetTripDriver(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+	driverId := result.Data.(models.TripTracking).DriverID
+
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		positions, unsubscribe := u.trackingHub.Subscribe(constants.DriverTrackingChannel + driverId)
+		defer unsubscribe()
+
+		// riders only listen, reading is needed to notice the client closing the socket
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var discard string
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case position, ok := <-positions:
+				if !ok {
+					return
+				}
+				if err := websocket.Message.Send(ws, string(position)); err != nil {
+					return
+				}
+			}
+		}
+	}}.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
+
+// StreamTrip pushes the assigned driver position, distance and ETA as server-sent events
+func (u userHttpHandler) StreamTrip(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	ctx := c.Request().Context()
+	result := u.userUsecaseQuery.GetTripDriver(userId, ctx)
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+	tracking := result.Data.(models.TripTracking)
+
+	positions, unsubscribe := u.trackingHub.Subscribe(constants.DriverTrackingChannel + tracking.DriverID)
+	defer unsubscribe()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		case message, ok := <-positions:
+			if !ok {
+				return nil
+			}
+			var position models.DriverPosition
+			if err := json.Unmarshal(message, &position); err != nil {
+				log.GetLogger().Error("http_handler", fmt.Sprintf("Invalid driver position: %v", err), "StreamTrip", string(message))
+				continue
+			}
+			data, _ := json.Marshal(tracking.Progress(position))
+			fmt.Fprintf(w, "event: driver-location\ndata: %s\n\n", data)
+			w.Flush()
+		}
+	}
+}
+
+func (u userHttpHandler) GetSurge(c echo.Context) error {
+	result := u.userUsecaseQuery.GetSurge(c.Param("zone"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Get surge success", 200, c)
+}
+
+func (u userHttpHandler) OverrideSurge(c echo.Context) error {
+	var request models.SurgeOverrideRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	result := u.userUseCaseCommand.OverrideSurge(c.Param("zone"), request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Override surge success", 200, c)
+}
+
+func (u userHttpHandler) ClearSurgeOverride(c echo.Context) error {
+	result := u.userUseCaseCommand.ClearSurgeOverride(c.Param("zone"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Clear surge override success", 200, c)
+}
+
+func (u userHttpHandler) GetRouteCacheStats(c echo.Context) error {
+	result := u.userUsecaseQuery.GetRouteCacheStats(c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Get route cache stats success", 200, c)
+}
+
+func (u userHttpHandler) AutocompletePlaces(c echo.Context) error {
+	var request models.PlaceAutocompleteRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	result := u.userUsecaseQuery.AutocompletePlaces(request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Autocomplete places success", 200, c)
+}
+
+func (u userHttpHandler) ReverseGeocode(c echo.Context) error {
+	var request models.ReverseGeocodeRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	result := u.userUsecaseQuery.ReverseGeocode(request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Reverse geocode success", 200, c)
+}
+
+func (u userHttpHandler) FindPool(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUsecaseQuery.FindPool(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "finding pool ride", 200, c)
+}
+
+func (u userHttpHandler) SearchCommuteOffers(c echo.Context) error {
+	var request models.CommuteSearchRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	result := u.userUsecaseQuery.SearchCommuteOffers(request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Search commute offers success", 200, c)
+}
+
+func (u userHttpHandler) GetSavedPlaces(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUsecaseQuery.GetSavedPlaces(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Get saved places success", 200, c)
+}
+
+func (u userHttpHandler) CreateSavedPlace(c echo.Context) error {
+	var request models.SavedPlaceRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUseCaseCommand.CreateSavedPlace(userId, request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Save place success", 200, c)
+}
+
+func (u userHttpHandler) UpdateSavedPlace(c echo.Context) error {
+	var request models.SavedPlaceRequest
+	if err := c.Bind(&request); err != nil {
+		return utils.ResponseError(err, c)
+	}
+
+	if err := request.Validate(); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Request validation error: %v", err.Error())
+		return utils.ResponseError(errObj, c)
+	}
+
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUseCaseCommand.UpdateSavedPlace(userId, c.Param("id"), request, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Update saved place success", 200, c)
+}
+
+func (u userHttpHandler) DeleteSavedPlace(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUseCaseCommand.DeleteSavedPlace(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Delete saved place success", 200, c)
+}
+
+func (u userHttpHandler) GetRecentDestinations(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUsecaseQuery.GetRecentDestinations(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Get recent destinations success", 200, c)
+}
+
+func (u userHttpHandler) GetScheduledRides(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUsecaseQuery.GetScheduledRides(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Get scheduled rides success", 200, c)
+}
+
+func (u userHttpHandler) ScheduleRide(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUseCaseCommand.ScheduleRide(userId, c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Schedule ride success", 200, c)
+}
+
+func (u userHttpHandler) CancelScheduledRide(c echo.Context) error {
+	userId := utils.ConvertString(c.Get("userId"))
+	result := u.userUseCaseCommand.CancelScheduledRide(userId, c.Param("id"), c.Request().Context())
+
+	if result.Error != nil {
+		return utils.ResponseError(result.Error, c)
+	}
+
+	return utils.Response(result.Data, "Cancel scheduled ride success", 200, c)
+}
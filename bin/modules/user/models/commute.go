@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const CommuteOfferOpen = "open"
+
+// GeoJSONLineString is a mongo geo line, every coordinate is longitude then latitude
+type GeoJSONLineString struct {
+	Type        string      `json:"type" bson:"type"`
+	Coordinates [][]float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// CommuteOffer is a trip published by a driver in the driver module
+type CommuteOffer struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DriverId    string             `json:"driverId" bson:"driverId"`
+	Path        GeoJSONLineString  `json:"path" bson:"path"`
+	DepartFrom  time.Time          `json:"departFrom" bson:"departFrom"`
+	DepartUntil time.Time          `json:"departUntil" bson:"departUntil"`
+	Seats       int                `json:"seats" bson:"seats"`
+	Status      string             `json:"status" bson:"status"`
+}
+
+type CommuteSearchRequest struct {
+	OriginLatitude       float64 `query:"originLat" validate:"required,latitude"`
+	OriginLongitude      float64 `query:"originLng" validate:"required,longitude"`
+	DestinationLatitude  float64 `query:"destinationLat" validate:"required,latitude"`
+	DestinationLongitude float64 `query:"destinationLng" validate:"required,longitude"`
+	// DepartAt is when the rider wants to leave, now when empty
+	DepartAt time.Time `query:"departAt"`
+	Seats    int       `query:"seats" validate:"omitempty,min=1,max=6"`
+}
+
+func (r *CommuteSearchRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// CommuteOfferMatch is an offer passing near the rider, the distances are from the rider to the driver path
+type CommuteOfferMatch struct {
+	Offer             CommuteOffer `json:"offer"`
+	PickupDistanceKm  float64      `json:"pickupDistanceKm"`
+	DropoffDistanceKm float64      `json:"dropoffDistanceKm"`
+	RideKm            float64      `json:"rideKm"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DispatchSearching is a new dispatch, the driver module offers its first wave
+const DispatchSearching = "searching"
+
+// Dispatch hands a requested ride to the driver module, which offers it to Candidates WaveSize at a time and
+// re-offers when an offer is rejected or outlives OfferTTL. Request is the request-ride event.
+type Dispatch struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId     string             `json:"userId" bson:"userId"`
+	RideId     string             `json:"rideId,omitempty" bson:"rideId,omitempty"`
+	Request    string             `json:"-" bson:"request"`
+	Candidates []string           `json:"candidates" bson:"candidates"`
+	Next       int                `json:"next" bson:"next"`
+	WaveSize   int                `json:"waveSize" bson:"waveSize"`
+	OfferTTL   time.Duration      `json:"offerTtl" bson:"offerTtl"`
+	Wave       int                `json:"wave" bson:"wave"`
+	Status     string             `json:"status" bson:"status"`
+	DueAt      time.Time          `json:"dueAt" bson:"dueAt"`
+	Version    int                `json:"version" bson:"version"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
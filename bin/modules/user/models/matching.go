@@ -0,0 +1,37 @@
+package models
+
+// DriverCandidate is an available driver found around the pickup
+type DriverCandidate struct {
+	DriverId   string          `json:"driverId"`
+	Location   LocationRequest `json:"location"`
+	DistanceKm float64         `json:"distanceKm"`
+}
+
+// RankedDriver is a candidate with what the matching strategy knew about it, Score is only comparable within
+// the same strategy
+type RankedDriver struct {
+	DriverId       string          `json:"driverId"`
+	Location       LocationRequest `json:"location"`
+	DistanceKm     float64         `json:"distanceKm"`
+	EtaMinutes     float64         `json:"etaMinutes"`
+	IdleMinutes    float64         `json:"idleMinutes"`
+	AcceptanceRate float64         `json:"acceptanceRate"`
+	Rating         float64         `json:"rating"`
+	Score          float64         `json:"score"`
+}
+
+// DriverSearchResult is the shortlist of a driver search and the radius around the pickup it was found in
+type DriverSearchResult struct {
+	RadiusKm   float64
+	Drivers    []RankedDriver
+	DispatchId string
+}
+
+// DriverStats is kept per driver by the dispatch and rating flows
+type DriverStats struct {
+	DriverId       string  `json:"driverId" bson:"driverId"`
+	Rating         float64 `json:"rating" bson:"rating"`
+	RatingCount    int     `json:"ratingCount" bson:"ratingCount"`
+	OffersReceived int     `json:"offersReceived" bson:"offersReceived"`
+	OffersAccepted int     `json:"offersAccepted" bson:"offersAccepted"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GeoJSONPoint is a mongo geo point, coordinates are longitude then latitude
+type GeoJSONPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+func NewGeoJSONPoint(latitude float64, longitude float64) GeoJSONPoint {
+	return GeoJSONPoint{
+		Type:        "Point",
+		Coordinates: []float64{longitude, latitude},
+	}
+}
+
+// Place is a point of interest of the local catalogue
+type Place struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name     string             `json:"name" bson:"name"`
+	Street   string             `json:"street" bson:"street"`
+	Location GeoJSONPoint       `json:"location" bson:"location"`
+}
+
+func (p Place) Suggestion() LocationSuggestion {
+	suggestion := LocationSuggestion{
+		StreetName:   p.Street,
+		NameLocation: p.Name,
+	}
+	if len(p.Location.Coordinates) == 2 {
+		suggestion.Longitude = p.Location.Coordinates[0]
+		suggestion.Latitude = p.Location.Coordinates[1]
+	}
+	return suggestion
+}
+
+type PlaceAutocompleteRequest struct {
+	Query string `query:"q" validate:"required,min=2,max=100"`
+	// Latitude and Longitude are the rider position, results nearby come first
+	Latitude  float64 `query:"lat" validate:"omitempty,latitude"`
+	Longitude float64 `query:"lng" validate:"omitempty,longitude"`
+}
+
+func (r *PlaceAutocompleteRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type ReverseGeocodeRequest struct {
+	Latitude  float64 `query:"lat" validate:"required,latitude"`
+	Longitude float64 `query:"lng" validate:"required,longitude"`
+}
+
+func (r *ReverseGeocodeRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+const (
+	PoolStopPickup  = "pickup"
+	PoolStopDropoff = "dropoff"
+)
+
+// PoolStop is a pickup or a dropoff still ahead of a driver, saved by the driver module
+type PoolStop struct {
+	UserId   string          `json:"userId"`
+	Kind     string          `json:"kind"`
+	Location LocationRequest `json:"location"`
+}
+
+// PoolTrip is a trip open to pooling, Stops are in driving order and a rider with a dropoff but no pickup
+// in Stops is on board
+type PoolTrip struct {
+	DriverId  string     `json:"driverId"`
+	Capacity  int        `json:"capacity"`
+	Stops     []PoolStop `json:"stops"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// PoolMatch is the cheapest way to fit the rider into a pool trip. Stops is the new stop order of the driver.
+type PoolMatch struct {
+	DriverId      string          `json:"driverId"`
+	DistanceKm    float64         `json:"distanceKm"`
+	DetourKm      float64         `json:"detourKm"`
+	DetourMinutes float64         `json:"detourMinutes"`
+	RideKm        float64         `json:"rideKm"`
+	SharedKm      float64         `json:"sharedKm"`
+	Fare          float64         `json:"fare"`
+	FareSplit     []PoolFareShare `json:"fareSplit"`
+	Stops         []PoolStop      `json:"stops"`
+}
+
+// PoolFareShare is what a rider pays of the legs shared with the new rider
+type PoolFareShare struct {
+	UserId   string  `json:"userId"`
+	SharedKm float64 `json:"sharedKm"`
+	Fare     float64 `json:"fare"`
+}
+
+// PoolRideRequest is the request-pool-ride event, the driver service adds the rider to the trip of DriverId
+type PoolRideRequest struct {
+	UserId       string       `json:"userId"`
+	DriverId     string       `json:"driverId"`
+	RouteSummary RouteSummary `json:"routeSummary"`
+	Match        PoolMatch    `json:"match"`
+}
@@ -0,0 +1,45 @@
+package models
+
+const (
+	// FareRuleAny matches every service type or city in a FareRule
+	FareRuleAny = "*"
+
+	DefaultServiceType = "bike"
+)
+
+type FareRule struct {
+	ServiceType string  `json:"serviceType" bson:"serviceType"`
+	City        string  `json:"city" bson:"city"`
+	BaseFare    float64 `json:"baseFare" bson:"baseFare"`
+	PerKm       float64 `json:"perKm" bson:"perKm"`
+	PerMinute   float64 `json:"perMinute" bson:"perMinute"`
+	MinimumFare float64 `json:"minimumFare" bson:"minimumFare"`
+	BookingFee  float64 `json:"bookingFee" bson:"bookingFee"`
+	// PerStop is charged for every intermediate stop of the trip
+	PerStop float64 `json:"perStop" bson:"perStop"`
+}
+
+// CityArea is a city for pricing, the circle of RadiusKm around its center
+type CityArea struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+type FareBreakdown struct {
+	ServiceType       string  `json:"serviceType"`
+	City              string  `json:"city"`
+	DistanceKm        float64 `json:"distanceKm"`
+	DurationMinutes   float64 `json:"durationMinutes"`
+	BaseFare          float64 `json:"baseFare"`
+	DistanceFare      float64 `json:"distanceFare"`
+	TimeFare          float64 `json:"timeFare"`
+	Stops             int     `json:"stops"`
+	StopFare          float64 `json:"stopFare"`
+	MinimumFareAdjust float64 `json:"minimumFareAdjust"`
+	SurgeMultiplier   float64 `json:"surgeMultiplier"`
+	SurgeFare         float64 `json:"surgeFare"`
+	BookingFee        float64 `json:"bookingFee"`
+	Total             float64 `json:"total"`
+}
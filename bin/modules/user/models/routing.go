@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type RouteRequest struct {
+	Origin      LocationRequest
+	Destination LocationRequest
+	// Waypoints are visited in order between the origin and the destination, providers must not reorder them
+	Waypoints     []LocationRequest
+	ServiceType   string
+	DepartureTime time.Time
+	// BypassCache asks the providers again, the fresh routes still refresh the cache
+	BypassCache bool
+}
+
+// RouteOption is one candidate route of a provider, the duration includes the expected traffic when known
+type RouteOption struct {
+	DistanceMeters  float64 `json:"distanceMeters"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Provider        string  `json:"provider"`
+	// Legs has one entry per segment between two consecutive points of the request
+	Legs []RouteOptionLeg `json:"legs"`
+}
+
+type RouteOptionLeg struct {
+	DistanceMeters  float64 `json:"distanceMeters"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// RouteLeg is a segment of the best route with its share of the trip fare
+type RouteLeg struct {
+	From            LocationRequest `json:"from"`
+	To              LocationRequest `json:"to"`
+	DistanceKm      float64         `json:"distanceKm"`
+	DurationMinutes float64         `json:"durationMinutes"`
+	Fare            float64         `json:"fare"`
+}
+
+type RouteCacheStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Bypassed int64   `json:"bypassed"`
+	HitRatio float64 `json:"hitRatio"`
+}
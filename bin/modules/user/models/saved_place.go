@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SavedPlaceHome   = "home"
+	SavedPlaceWork   = "work"
+	SavedPlaceCustom = "custom"
+
+	// MaxCustomSavedPlaces is how many custom places a rider may keep besides home and work
+	MaxCustomSavedPlaces = 20
+)
+
+type SavedPlace struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId    string             `json:"userId" bson:"userId"`
+	Label     string             `json:"label" bson:"label"`
+	Name      string             `json:"name" bson:"name"`
+	Location  LocationRequest    `json:"location" bson:"location"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+type SavedPlaceRequest struct {
+	Label    string          `json:"label" validate:"required,oneof=home work custom"`
+	Name     string          `json:"name" validate:"required_if=Label custom,max=50"`
+	Location LocationRequest `json:"location" validate:"required"`
+}
+
+func (r *SavedPlaceRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// RecentDestination is a destination quoted by the rider, quotes to about the same spot update one entry.
+// Destination has the shape of LocationSuggestionRequest.Destination so clients can pre-fill it.
+type RecentDestination struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId      string             `json:"userId" bson:"userId"`
+	Destination LocationRequest    `json:"destination" bson:"destination"`
+	Count       int                `json:"count" bson:"count"`
+	LastUsedAt  time.Time          `json:"lastUsedAt" bson:"lastUsedAt"`
+}
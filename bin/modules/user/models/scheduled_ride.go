@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ScheduledRideScheduled   = "scheduled"
+	ScheduledRideDispatching = "dispatching"
+	ScheduledRideDispatched  = "dispatched"
+	ScheduledRideCancelled   = "cancelled"
+	ScheduledRideFailed      = "failed"
+
+	// MaxScheduleAhead is how far in the future a ride can be booked
+	MaxScheduleAhead = 7 * 24 * time.Hour
+)
+
+// ScheduledRide is a ride booked for a future pickup, the driver search starts at DispatchAt.
+// RouteSummary is the quote the rider accepted, it is sent as is in the request-ride event.
+type ScheduledRide struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId       string             `json:"userId" bson:"userId"`
+	RouteSummary RouteSummary       `json:"routeSummary" bson:"routeSummary"`
+	PickupAt     time.Time          `json:"pickupAt" bson:"pickupAt"`
+	DispatchAt   time.Time          `json:"dispatchAt" bson:"dispatchAt"`
+	Status       string             `json:"status" bson:"status"`
+	LastError    string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DispatchedAt *time.Time         `json:"dispatchedAt,omitempty" bson:"dispatchedAt,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// SurgeZonePrecision is the geohash length of a surge zone, a cell of about 4.9km x 4.9km
+	SurgeZonePrecision = 5
+	// NoSurge is the multiplier of a zone where supply covers demand
+	NoSurge = 1.0
+)
+
+type SurgeState struct {
+	Zone              string     `json:"zone"`
+	Multiplier        float64    `json:"multiplier"`
+	Demand            int64      `json:"demand"`
+	Supply            int64      `json:"supply"`
+	Overridden        bool       `json:"overridden"`
+	OverrideExpiresAt *time.Time `json:"overrideExpiresAt,omitempty"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+}
+
+type SurgeOverrideRequest struct {
+	Multiplier float64 `json:"multiplier" validate:"required,gte=1,lte=10"`
+	// TTLSeconds ends the override after that many seconds, 0 keeps it until it is removed
+	TTLSeconds int `json:"ttlSeconds" validate:"gte=0"`
+}
+
+func (r *SurgeOverrideRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
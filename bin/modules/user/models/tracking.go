@@ -0,0 +1,53 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"location-service/bin/pkg/utils"
+)
+
+// averageCitySpeedKmh is used to recompute the pickup ETA on every position without calling a routing API
+const averageCitySpeedKmh = 20.0
+
+type DriverPosition struct {
+	DriverID  string    `json:"driverId"`
+	Status    string    `json:"status"`
+	Longitude float64   `json:"longitude"`
+	Latitude  float64   `json:"latitude"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type TripTracking struct {
+	DriverID string           `json:"driverId"`
+	Pickup   *LocationRequest `json:"pickup"`
+}
+
+type TripProgress struct {
+	DriverID   string    `json:"driverId"`
+	Longitude  float64   `json:"longitude"`
+	Latitude   float64   `json:"latitude"`
+	DistanceKm float64   `json:"distanceKm"`
+	EtaMinutes int       `json:"etaMinutes"`
+	Eta        string    `json:"eta"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Progress computes the distance and ETA of the driver to the pickup point
+func (t TripTracking) Progress(position DriverPosition) TripProgress {
+	progress := TripProgress{
+		DriverID:  t.DriverID,
+		Longitude: position.Longitude,
+		Latitude:  position.Latitude,
+		UpdatedAt: position.LastSeen,
+	}
+	if t.Pickup == nil {
+		return progress
+	}
+
+	distance := utils.HaversineKm(position.Latitude, position.Longitude, t.Pickup.Latitude, t.Pickup.Longitude)
+	progress.DistanceKm = math.Round(distance*100) / 100
+	progress.EtaMinutes = int(math.Ceil(distance / averageCitySpeedKmh * 60))
+	progress.Eta = utils.FormatDuration(progress.EtaMinutes)
+	return progress
+}
@@ -41,16 +41,41 @@ type LocationRequest struct {
 type LocationSuggestionRequest struct {
 	CurrentLocation LocationRequest `json:"currentLocation" validate:"required"`
 	Destination     LocationRequest `json:"destination" validate:"required"`
+	// Stops are visited in order between the current location and the destination
+	Stops       []LocationRequest `json:"stops" validate:"omitempty,max=3,dive"`
+	ServiceType string            `json:"serviceType"`
+	// BypassCache skips the cached routes, for riders who just saw a wrong estimate. It is honoured once per
+	// rider every few minutes.
+	BypassCache bool `json:"bypassCache"`
+	// PickupAt quotes a scheduled ride, the routes are estimated for that departure time
+	PickupAt *time.Time `json:"pickupAt"`
 }
 
 type Route struct {
-	Origin      LocationRequest `json:"origin" `
-	Destination LocationRequest `json:"destination"`
+	Origin      LocationRequest   `json:"origin" `
+	Stops       []LocationRequest `json:"stops,omitempty"`
+	Destination LocationRequest   `json:"destination"`
+}
+
+// Points returns the origin, the stops and the destination in the order they are visited
+func (r Route) Points() []LocationRequest {
+	points := make([]LocationRequest, 0, len(r.Stops)+2)
+	points = append(points, r.Origin)
+	points = append(points, r.Stops...)
+	return append(points, r.Destination)
 }
 
 type RequestRide struct {
 	RouteSummary RouteSummary `json:"routeSummary" bson:"routeSummary"`
 	UserId       string       `json:"userId" bson:"userId"`
+	// Stops is the full ordered list: pickup, intermediate stops then drop-off
+	Stops []LocationRequest `json:"stops" bson:"stops"`
+	// Drivers is the shortlist of the matching strategy, best first
+	Drivers []RankedDriver `json:"drivers" bson:"drivers"`
+	// SearchRadiusKm is the radius around the pickup the drivers were found in
+	SearchRadiusKm float64 `json:"searchRadiusKm" bson:"searchRadiusKm"`
+	// DispatchId is the dispatch offering the ride to Drivers one wave at a time
+	DispatchId string `json:"dispatchId,omitempty" bson:"dispatchId,omitempty"`
 }
 
 func (r *LocationSuggestionRequest) Validate() error {
@@ -59,13 +84,21 @@ func (r *LocationSuggestionRequest) Validate() error {
 }
 
 type RouteSummary struct {
-	Route             Route   `json:"route"`
-	MinPrice          float64 `json:"minPrice"`
-	MaxPrice          float64 `json:"maxPrice"`
-	BestRouteKm       float64 `json:"bestRouteKm"`
-	BestRoutePrice    float64 `json:"bestRoutePrice"`
-	BestRouteDuration string  `json:"bestRouteDuration"`
-	Duration          int     `json:"duration"`
+	Route             Route         `json:"route"`
+	MinPrice          float64       `json:"minPrice"`
+	MaxPrice          float64       `json:"maxPrice"`
+	BestRouteKm       float64       `json:"bestRouteKm"`
+	BestRoutePrice    float64       `json:"bestRoutePrice"`
+	BestRouteDuration string        `json:"bestRouteDuration"`
+	Duration          int           `json:"duration"`
+	Fare              FareBreakdown `json:"fare"`
+	Legs              []RouteLeg    `json:"legs"`
+	Zone              string        `json:"zone"`
+	SurgeMultiplier   float64       `json:"surgeMultiplier"`
+	Provider          string        `json:"provider"`
+	PickupAt          *time.Time    `json:"pickupAt,omitempty"`
+	// RideId is the ride opened by the quote, it follows the quote through the driver search
+	RideId string `json:"rideId,omitempty"`
 }
 
 type Wallet struct {
@@ -83,3 +116,11 @@ type TransactionLog struct {
 	Description   string    `bson:"description" json:"description"`
 	Timestamp     time.Time `bson:"timestamp" json:"timestamp"`
 }
+
+// RideCancelled is the ride-cancelled event of the ride module, Fee is what the rider owes for the cancellation
+type RideCancelled struct {
+	RideId      string    `json:"rideId"`
+	UserId      string    `json:"userId"`
+	Fee         float64   `json:"fee"`
+	CancelledAt time.Time `json:"cancelledAt"`
+}
@@ -2,10 +2,15 @@ package commands
 
 import (
 	"context"
+	"time"
 
 	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
 	"location-service/bin/pkg/databases/mongodb"
+	"location-service/bin/pkg/outbox"
+	"location-service/bin/pkg/utils"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -22,3 +27,308 @@ func NewCommandMongodbRepository(mongodb mongodb.MongoDBLogger) user.MongodbRepo
 func (c commandMongodbRepository) NewObjectID(ctx context.Context) string {
 	return primitive.NewObjectID().Hex()
 }
+
+func (c commandMongodbRepository) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: outbox.CollectionName,
+			Document:       event,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: event,
+		}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) InsertSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		place.ID = primitive.NewObjectID()
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: "saved-place",
+			Document:       place,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: place,
+		}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) UpdateSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.UpdateOne(mongodb.UpdateOne{
+			CollectionName: "saved-place",
+			Filter: bson.M{
+				"_id":    place.ID,
+				"userId": place.UserId,
+			},
+			Document: place,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: place,
+		}
+
+	}()
+
+	return output
+}
+
+// DeleteSavedPlace returns whether a place of the rider was deleted
+func (c commandMongodbRepository) DeleteSavedPlace(userId string, placeId string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		id, err := primitive.ObjectIDFromHex(placeId)
+		if err != nil {
+			output <- utils.Result{
+				Data: false,
+			}
+			return
+		}
+
+		var deleted int64
+		err = c.mongoDb.DeleteOne(mongodb.DeleteOne{
+			Result:         &deleted,
+			CollectionName: "saved-place",
+			Filter: bson.M{
+				"_id":    id,
+				"userId": userId,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: deleted > 0,
+		}
+
+	}()
+
+	return output
+}
+
+// UpsertRecentDestination inserts the destination when its id is not set yet
+func (c commandMongodbRepository) UpsertRecentDestination(recent models.RecentDestination, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		if recent.ID.IsZero() {
+			recent.ID = primitive.NewObjectID()
+		}
+		err := c.mongoDb.UpsertOne(mongodb.UpsertOne{
+			CollectionName: "recent-destination",
+			Filter: bson.M{
+				"_id": recent.ID,
+			},
+			Document: recent,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: recent,
+		}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) InsertScheduledRide(ride models.ScheduledRide, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		ride.ID = primitive.NewObjectID()
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: "scheduled-ride",
+			Document:       ride,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: ride,
+		}
+
+	}()
+
+	return output
+}
+
+// UpdateScheduledRide saves the ride only while it still has fromStatus, it returns whether the ride was updated.
+// The status guard keeps a cancellation and the scheduler from both winning the same ride.
+func (c commandMongodbRepository) UpdateScheduledRide(ride models.ScheduledRide, fromStatus string, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var matched int64
+		err := c.mongoDb.UpdateOne(mongodb.UpdateOne{
+			Result:         &matched,
+			CollectionName: "scheduled-ride",
+			Filter: bson.M{
+				"_id":    ride.ID,
+				"userId": ride.UserId,
+				"status": fromStatus,
+			},
+			Document: ride,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
+
+// RequeueStaleScheduledRides gives the rides stuck dispatching since before staleBefore back to the scheduler
+func (c commandMongodbRepository) RequeueStaleScheduledRides(staleBefore time.Time, now time.Time, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.UpdateMany(mongodb.UpdateMany{
+			CollectionName: "scheduled-ride",
+			Filter: bson.M{
+				"status":    models.ScheduledRideDispatching,
+				"updatedAt": bson.M{"$lte": staleBefore},
+			},
+			Document: bson.M{
+				"status":    models.ScheduledRideScheduled,
+				"lastError": "dispatch interrupted",
+				"updatedAt": now,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{}
+
+	}()
+
+	return output
+}
+
+func (c commandMongodbRepository) InsertDispatch(dispatch models.Dispatch, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		err := c.mongoDb.InsertOne(mongodb.InsertOne{
+			CollectionName: "dispatch",
+			Document:       dispatch,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: dispatch,
+		}
+
+	}()
+
+	return output
+}
+
+// ChargeWallet takes the amount of the transaction from the wallet of the user and logs it, Data is whether it was
+// charged. A transaction already in the log is not charged twice.
+func (c commandMongodbRepository) ChargeWallet(userId string, transaction models.TransactionLog, ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var matched int64
+		err := c.mongoDb.ModifyOne(mongodb.ModifyOne{
+			Result:         &matched,
+			CollectionName: "wallet",
+			Filter: bson.M{
+				"userId":                       userId,
+				"transactionLog.transactionId": bson.M{"$ne": transaction.TransactionID},
+			},
+			Update: bson.M{
+				"$inc":  bson.M{"balance": -transaction.Amount},
+				"$push": bson.M{"transactionLog": transaction},
+				"$set":  bson.M{"lastUpdated": transaction.Timestamp},
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: matched > 0,
+		}
+
+	}()
+
+	return output
+}
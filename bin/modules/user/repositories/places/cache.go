@@ -0,0 +1,84 @@
+package places
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// biasCellPrecision groups riders within about 5km, they get the same biased results
+	biasCellPrecision = 5
+	// reverseCellPrecision snaps reverse lookups to cells of about 40m x 20m
+	reverseCellPrecision = 8
+
+	defaultCacheTTL = 24 * time.Hour
+)
+
+type cachedProvider struct {
+	provider    user.PlaceProvider
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+}
+
+// NewCachedProvider caches the places of provider in redis, empty results are not cached
+func NewCachedProvider(provider user.PlaceProvider, rc redis.UniversalClient, ttl time.Duration) user.PlaceProvider {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &cachedProvider{
+		provider:    provider,
+		redisClient: rc,
+		ttl:         ttl,
+	}
+}
+
+func (c *cachedProvider) Name() string {
+	return c.provider.Name()
+}
+
+func (c *cachedProvider) Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	cell := "-"
+	if hasPosition(location) {
+		cell = utils.EncodeGeohash(location.Latitude, location.Longitude, biasCellPrecision)
+	}
+	keyword := strings.ToLower(strings.Join(strings.Fields(location.Keyword), " "))
+	key := fmt.Sprintf(constants.PlaceAutocompleteKey, cell, keyword)
+	return c.cached(key, location, ctx, c.provider.Autocomplete)
+}
+
+func (c *cachedProvider) Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	key := fmt.Sprintf(constants.PlaceReverseKey, utils.EncodeGeohash(location.Latitude, location.Longitude, reverseCellPrecision))
+	return c.cached(key, location, ctx, c.provider.Reverse)
+}
+
+func (c *cachedProvider) cached(key string, location models.Location, ctx context.Context, find func(models.Location, context.Context) ([]models.LocationSuggestion, error)) ([]models.LocationSuggestion, error) {
+	if cached, err := c.redisClient.Get(ctx, key).Result(); err == nil {
+		var suggestions []models.LocationSuggestion
+		if json.Unmarshal([]byte(cached), &suggestions) == nil {
+			return suggestions, nil
+		}
+	} else if err != redis.Nil {
+		log.GetLogger().Error("place_cache", fmt.Sprintf("Error read place cache: %v", err), "cached", key)
+	}
+
+	suggestions, err := find(location, ctx)
+	if err != nil || len(suggestions) == 0 {
+		return suggestions, err
+	}
+	suggestionsJSON, _ := json.Marshal(suggestions)
+	if err := c.redisClient.Set(ctx, key, suggestionsJSON, c.ttl).Err(); err != nil {
+		log.GetLogger().Error("place_cache", fmt.Sprintf("Error write place cache: %v", err), "cached", key)
+	}
+	return suggestions, nil
+}
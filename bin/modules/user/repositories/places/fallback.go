@@ -0,0 +1,64 @@
+package places
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+)
+
+type fallbackChain struct {
+	providers []user.PlaceProvider
+}
+
+// NewFallbackChain asks the providers in order and returns the places of the first one that finds any,
+// an empty list is only returned when every provider answered without error
+func NewFallbackChain(providers ...user.PlaceProvider) user.PlaceProvider {
+	return &fallbackChain{
+		providers: providers,
+	}
+}
+
+func (f *fallbackChain) Name() string {
+	names := make([]string, 0, len(f.providers))
+	for _, provider := range f.providers {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *fallbackChain) Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	return f.first(location, ctx, user.PlaceProvider.Autocomplete)
+}
+
+func (f *fallbackChain) Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	return f.first(location, ctx, user.PlaceProvider.Reverse)
+}
+
+type lookup func(provider user.PlaceProvider, location models.Location, ctx context.Context) ([]models.LocationSuggestion, error)
+
+func (f *fallbackChain) first(location models.Location, ctx context.Context, find lookup) ([]models.LocationSuggestion, error) {
+	var errs []error
+	for _, provider := range f.providers {
+		suggestions, err := find(provider, location, ctx)
+		if err == nil && len(suggestions) > 0 {
+			return suggestions, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			log.GetLogger().Error("place_provider", fmt.Sprintf("Place provider %s failed: %v", provider.Name(), err), "first", utils.ConvertString(location))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == len(f.providers) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return []models.LocationSuggestion{}, nil
+}
@@ -0,0 +1,90 @@
+package places
+
+import (
+	"context"
+	"fmt"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+
+	"googlemaps.github.io/maps"
+)
+
+// googleBiasRadiusMeters is how far around the rider the text search prefers results
+const googleBiasRadiusMeters = 20000
+
+type googleProvider struct {
+	mapsClient *maps.Client
+	limit      int
+}
+
+func NewGoogleProvider(apiKey string, limit int) (user.PlaceProvider, error) {
+	mapsClient, err := maps.NewClient(maps.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("error creating Google Maps client: %w", err)
+	}
+	return &googleProvider{
+		mapsClient: mapsClient,
+		limit:      limit,
+	}, nil
+}
+
+func (g *googleProvider) Name() string {
+	return "google"
+}
+
+func (g *googleProvider) Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	req := &maps.TextSearchRequest{
+		Query: location.Keyword,
+	}
+	if hasPosition(location) {
+		req.Location = &maps.LatLng{Lat: location.Latitude, Lng: location.Longitude}
+		req.Radius = googleBiasRadiusMeters
+	}
+
+	response, err := g.mapsClient.TextSearch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error making text search request: %w", err)
+	}
+
+	suggestions := make([]models.LocationSuggestion, 0, g.limit)
+	for _, place := range response.Results {
+		if len(suggestions) == g.limit {
+			break
+		}
+		suggestions = append(suggestions, models.LocationSuggestion{
+			Latitude:     place.Geometry.Location.Lat,
+			Longitude:    place.Geometry.Location.Lng,
+			StreetName:   place.FormattedAddress,
+			NameLocation: place.Name,
+		})
+	}
+	return suggestions, nil
+}
+
+func (g *googleProvider) Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	results, err := g.mapsClient.ReverseGeocode(ctx, &maps.GeocodingRequest{
+		LatLng: &maps.LatLng{Lat: location.Latitude, Lng: location.Longitude},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error making reverse geocode request: %w", err)
+	}
+
+	suggestions := make([]models.LocationSuggestion, 0, g.limit)
+	for _, result := range results {
+		if len(suggestions) == g.limit {
+			break
+		}
+		name := result.FormattedAddress
+		if len(result.AddressComponents) > 0 {
+			name = result.AddressComponents[0].LongName
+		}
+		suggestions = append(suggestions, models.LocationSuggestion{
+			Latitude:     result.Geometry.Location.Lat,
+			Longitude:    result.Geometry.Location.Lng,
+			StreetName:   result.FormattedAddress,
+			NameLocation: name,
+		})
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,78 @@
+package places
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubRepository struct {
+	user.MongodbRepositoryQuery
+	places  []models.Place
+	near    *models.GeoJSONPoint
+	keyword string
+}
+
+func (s *stubRepository) SearchPlaces(ctx context.Context, keyword string, near *models.GeoJSONPoint, limit int64) <-chan utils.Result {
+	s.keyword, s.near = keyword, near
+	output := make(chan utils.Result, 1)
+	output <- utils.Result{Data: s.places}
+	return output
+}
+
+type stubProvider struct {
+	name        string
+	suggestions []models.LocationSuggestion
+	err         error
+}
+
+func (s stubProvider) Name() string { return s.name }
+
+func (s stubProvider) Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	return s.suggestions, s.err
+}
+
+func (s stubProvider) Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	return s.suggestions, s.err
+}
+
+func TestPOIProvider_BiasedAutocomplete(t *testing.T) {
+	repository := &stubRepository{places: []models.Place{{
+		Name:     "Stasiun Gambir",
+		Street:   "Jl. Medan Merdeka Timur",
+		Location: models.NewGeoJSONPoint(-6.1767, 106.8306),
+	}}}
+	provider := NewPOIProvider(repository, 5)
+
+	suggestions, err := provider.Autocomplete(models.Location{Keyword: "gambir", Latitude: -6.2, Longitude: 106.8}, context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{106.8, -6.2}, repository.near.Coordinates)
+	assert.Equal(t, models.LocationSuggestion{Latitude: -6.1767, Longitude: 106.8306, StreetName: "Jl. Medan Merdeka Timur", NameLocation: "Stasiun Gambir"}, suggestions[0])
+
+	provider.Autocomplete(models.Location{Keyword: "gambir"}, context.Background())
+	assert.Nil(t, repository.near)
+}
+
+func TestFallbackChain_Places(t *testing.T) {
+	found := []models.LocationSuggestion{{NameLocation: "Stasiun Gambir"}}
+	ctx := context.Background()
+
+	suggestions, err := NewFallbackChain(stubProvider{name: "poi"}, stubProvider{name: "google", suggestions: found}).Autocomplete(models.Location{Keyword: "gambir"}, ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, found, suggestions)
+
+	// nothing found is not an error as long as one provider answered
+	suggestions, err = NewFallbackChain(stubProvider{name: "poi"}, stubProvider{name: "google", err: errors.New("quota exceeded")}).Reverse(models.Location{}, ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, suggestions)
+
+	_, err = NewFallbackChain(stubProvider{name: "google", err: errors.New("quota exceeded")}).Reverse(models.Location{}, ctx)
+	assert.ErrorContains(t, err, "google: quota exceeded")
+}
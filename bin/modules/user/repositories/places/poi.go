@@ -0,0 +1,64 @@
+package places
+
+import (
+	"context"
+	"fmt"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+)
+
+// reverseMaxDistanceMeters is how far a place may be from the point to name it
+const reverseMaxDistanceMeters = 150
+
+type poiProvider struct {
+	userRepositoryQuery user.MongodbRepositoryQuery
+	limit               int64
+}
+
+// NewPOIProvider searches the local catalogue of places, the place collection needs a 2dsphere index on location
+func NewPOIProvider(mq user.MongodbRepositoryQuery, limit int) user.PlaceProvider {
+	return &poiProvider{
+		userRepositoryQuery: mq,
+		limit:               int64(limit),
+	}
+}
+
+func (p *poiProvider) Name() string {
+	return "poi"
+}
+
+func (p *poiProvider) Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	var near *models.GeoJSONPoint
+	if hasPosition(location) {
+		point := models.NewGeoJSONPoint(location.Latitude, location.Longitude)
+		near = &point
+	}
+
+	result := <-p.userRepositoryQuery.SearchPlaces(ctx, location.Keyword, near, p.limit)
+	if result.Error != nil {
+		return nil, fmt.Errorf("search places: %v", result.Error)
+	}
+	return toSuggestions(result.Data.([]models.Place)), nil
+}
+
+func (p *poiProvider) Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error) {
+	point := models.NewGeoJSONPoint(location.Latitude, location.Longitude)
+	result := <-p.userRepositoryQuery.FindPlacesNear(ctx, point, reverseMaxDistanceMeters, p.limit)
+	if result.Error != nil {
+		return nil, fmt.Errorf("find places near: %v", result.Error)
+	}
+	return toSuggestions(result.Data.([]models.Place)), nil
+}
+
+func toSuggestions(places []models.Place) []models.LocationSuggestion {
+	suggestions := make([]models.LocationSuggestion, 0, len(places))
+	for _, place := range places {
+		suggestions = append(suggestions, place.Suggestion())
+	}
+	return suggestions
+}
+
+func hasPosition(location models.Location) bool {
+	return location.Latitude != 0 || location.Longitude != 0
+}
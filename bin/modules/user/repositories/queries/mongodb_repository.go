@@ -2,8 +2,11 @@ package queries
 
 import (
 	"context"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"location-service/bin/modules/user"
 	"location-service/bin/modules/user/models"
@@ -77,3 +80,364 @@ func (q queryMongodbRepository) Findwallet(ctx context.Context, userId string) <
 
 	return output
 }
+
+func (q queryMongodbRepository) FindFareRules(ctx context.Context) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var fareRules []models.FareRule
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &fareRules,
+			CollectionName: "fare-rule",
+			Filter:         bson.M{},
+			Page:           1,
+			Size:           1000,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: fareRules,
+		}
+
+	}()
+
+	return output
+}
+
+// SearchPlaces matches the keyword at the start of any word of the place name, nearest first when near is set
+func (q queryMongodbRepository) SearchPlaces(ctx context.Context, keyword string, near *models.GeoJSONPoint, limit int64) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		filter := bson.M{
+			"name": bson.M{
+				"$regex":   `(^|\s)` + regexp.QuoteMeta(keyword),
+				"$options": "i",
+			},
+		}
+		if near != nil {
+			filter["location"] = bson.M{
+				"$nearSphere": bson.M{"$geometry": near},
+			}
+		}
+
+		var places []models.Place
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &places,
+			CollectionName: "place",
+			Filter:         filter,
+			Page:           1,
+			Size:           limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: places,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindPlacesNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, limit int64) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var places []models.Place
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &places,
+			CollectionName: "place",
+			Filter: bson.M{
+				"location": bson.M{
+					"$nearSphere": bson.M{
+						"$geometry":    near,
+						"$maxDistance": maxDistanceMeters,
+					},
+				},
+			},
+			Page: 1,
+			Size: limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: places,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindSavedPlaces(ctx context.Context, userId string) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var places []models.SavedPlace
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &places,
+			CollectionName: "saved-place",
+			Filter: bson.M{
+				"userId": userId,
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "createdAt",
+				By:        mongodb.SortAscending,
+			},
+			Page: 1,
+			Size: models.MaxCustomSavedPlaces + 2,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: places,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindRecentDestinations(ctx context.Context, userId string, limit int64) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var recents []models.RecentDestination
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &recents,
+			CollectionName: "recent-destination",
+			Filter: bson.M{
+				"userId": userId,
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "lastUsedAt",
+				By:        mongodb.SortDescending,
+			},
+			Page: 1,
+			Size: limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: recents,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindScheduledRides(ctx context.Context, userId string) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var rides []models.ScheduledRide
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &rides,
+			CollectionName: "scheduled-ride",
+			Filter: bson.M{
+				"userId": userId,
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "pickupAt",
+				By:        mongodb.SortDescending,
+			},
+			Page: 1,
+			Size: 50,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: rides,
+		}
+
+	}()
+
+	return output
+}
+
+// FindScheduledRide returns an empty ride when the rider has no ride with that id
+func (q queryMongodbRepository) FindScheduledRide(ctx context.Context, userId string, rideId string) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var ride models.ScheduledRide
+		id, err := primitive.ObjectIDFromHex(rideId)
+		if err != nil {
+			output <- utils.Result{
+				Data: ride,
+			}
+			return
+		}
+
+		err = q.mongoDb.FindOne(mongodb.FindOne{
+			Result:         &ride,
+			CollectionName: "scheduled-ride",
+			Filter: bson.M{
+				"_id":    id,
+				"userId": userId,
+			},
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: ride,
+		}
+
+	}()
+
+	return output
+}
+
+// FindDueScheduledRides returns the scheduled rides whose dispatch time has come, the earliest first
+func (q queryMongodbRepository) FindDueScheduledRides(ctx context.Context, now time.Time, limit int64) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var rides []models.ScheduledRide
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &rides,
+			CollectionName: "scheduled-ride",
+			Filter: bson.M{
+				"status":     models.ScheduledRideScheduled,
+				"dispatchAt": bson.M{"$lte": now},
+			},
+			Sort: &mongodb.Sort{
+				FieldName: "dispatchAt",
+				By:        mongodb.SortAscending,
+			},
+			Page: 1,
+			Size: limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: rides,
+		}
+
+	}()
+
+	return output
+}
+
+// FindCommuteOffersNear returns the open offers whose path passes within maxDistanceMeters of near, with a free seat
+// and a departure window overlapping from and until, the closest path first
+func (q queryMongodbRepository) FindCommuteOffersNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, from time.Time, until time.Time, seats int, limit int64) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var offers []models.CommuteOffer
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &offers,
+			CollectionName: "commute-offer",
+			Filter: bson.M{
+				"status":      models.CommuteOfferOpen,
+				"seats":       bson.M{"$gte": seats},
+				"departFrom":  bson.M{"$lte": until},
+				"departUntil": bson.M{"$gte": from},
+				"path": bson.M{
+					"$nearSphere": bson.M{
+						"$geometry":    near,
+						"$maxDistance": maxDistanceMeters,
+					},
+				},
+			},
+			Page: 1,
+			Size: limit,
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: offers,
+		}
+
+	}()
+
+	return output
+}
+
+func (q queryMongodbRepository) FindDriverStats(ctx context.Context, driverIds []string) <-chan utils.Result {
+	output := make(chan utils.Result)
+
+	go func() {
+		defer close(output)
+		var stats []models.DriverStats
+		err := q.mongoDb.FindAllData(mongodb.FindAllData{
+			Result:         &stats,
+			CollectionName: "driver-stats",
+			Filter: bson.M{
+				"driverId": bson.M{"$in": driverIds},
+			},
+			Page: 1,
+			Size: int64(len(driverIds)),
+		}, ctx)
+		if err != nil {
+			output <- utils.Result{
+				Error: err,
+			}
+			return
+		}
+
+		output <- utils.Result{
+			Data: stats,
+		}
+
+	}()
+
+	return output
+}
@@ -0,0 +1,120 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// cacheCellPrecision snaps coordinates to geohash cells of about 150m x 150m
+	cacheCellPrecision = 7
+
+	defaultCacheTTL    = 10 * time.Minute
+	defaultCacheBucket = 15 * time.Minute
+)
+
+type cachedProvider struct {
+	provider    user.RouteProvider
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+	bucket      time.Duration
+}
+
+// NewCachedProvider caches the routes of provider in redis, trips starting and ending in the same cells
+// within the same departure bucket share their routes. Routes of the offline estimator are not cached
+// so the real routes are used again as soon as the providers recover.
+func NewCachedProvider(provider user.RouteProvider, rc redis.UniversalClient, ttl time.Duration, bucket time.Duration) user.RouteProvider {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	if bucket <= 0 {
+		bucket = defaultCacheBucket
+	}
+	return &cachedProvider{
+		provider:    provider,
+		redisClient: rc,
+		ttl:         ttl,
+		bucket:      bucket,
+	}
+}
+
+func (c *cachedProvider) Name() string {
+	return c.provider.Name()
+}
+
+func (c *cachedProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	key := c.cacheKey(request)
+	if request.BypassCache {
+		c.count("bypassed", ctx)
+	} else if routes, ok := c.read(key, ctx); ok {
+		c.count("hits", ctx)
+		return routes, nil
+	} else {
+		c.count("misses", ctx)
+	}
+
+	routes, err := c.provider.Routes(request, ctx)
+	if err != nil || !cacheable(routes) {
+		return routes, err
+	}
+	routesJSON, _ := json.Marshal(routes)
+	if err := c.redisClient.Set(ctx, key, routesJSON, c.ttl).Err(); err != nil {
+		log.GetLogger().Error("route_cache", fmt.Sprintf("Error write route cache: %v", err), "Routes", key)
+	}
+	return routes, nil
+}
+
+func (c *cachedProvider) read(key string, ctx context.Context) ([]models.RouteOption, bool) {
+	cached, err := c.redisClient.Get(ctx, key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.GetLogger().Error("route_cache", fmt.Sprintf("Error read route cache: %v", err), "Routes", key)
+		}
+		return nil, false
+	}
+	var routes []models.RouteOption
+	if err := json.Unmarshal([]byte(cached), &routes); err != nil || len(routes) == 0 {
+		return nil, false
+	}
+	return routes, true
+}
+
+// cacheKey puts the waypoint cells after the origin cell, in order, so a trip with stops never
+// shares the routes of the direct trip
+func (c *cachedProvider) cacheKey(request models.RouteRequest) string {
+	path := utils.EncodeGeohash(request.Origin.Latitude, request.Origin.Longitude, cacheCellPrecision)
+	for _, waypoint := range request.Waypoints {
+		path += ">" + utils.EncodeGeohash(waypoint.Latitude, waypoint.Longitude, cacheCellPrecision)
+	}
+	return fmt.Sprintf(constants.RouteCacheKey,
+		request.ServiceType,
+		path,
+		utils.EncodeGeohash(request.Destination.Latitude, request.Destination.Longitude, cacheCellPrecision),
+		request.DepartureTime.Unix()/int64(c.bucket.Seconds()),
+	)
+}
+
+func (c *cachedProvider) count(field string, ctx context.Context) {
+	if err := c.redisClient.HIncrBy(ctx, constants.RouteCacheStatsKey, field, 1).Err(); err != nil {
+		log.GetLogger().Error("route_cache", fmt.Sprintf("Error count route cache %s: %v", field, err), "count", "")
+	}
+}
+
+func cacheable(routes []models.RouteOption) bool {
+	for _, route := range routes {
+		if route.Provider == estimatorName {
+			return false
+		}
+	}
+	return len(routes) > 0
+}
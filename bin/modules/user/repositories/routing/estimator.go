@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"context"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+)
+
+const (
+	estimatorName = "estimator"
+	// detourFactor turns the straight line distance into a typical road distance
+	detourFactor = 1.3
+	// defaultSpeedKmh is used for service types missing from the speed profile
+	defaultSpeedKmh = 20.0
+)
+
+// DefaultSpeedProfile is the average city speed in km/h of every service type
+var DefaultSpeedProfile = map[string]float64{
+	"bike": 25,
+	"car":  20,
+}
+
+type estimatorProvider struct {
+	speedProfile map[string]float64
+}
+
+// NewEstimatorProvider estimates a single route offline from the haversine distance and the speed profile,
+// it never fails so it belongs at the end of a fallback chain
+func NewEstimatorProvider(speedProfile map[string]float64) user.RouteProvider {
+	if len(speedProfile) == 0 {
+		speedProfile = DefaultSpeedProfile
+	}
+	return &estimatorProvider{
+		speedProfile: speedProfile,
+	}
+}
+
+func (e *estimatorProvider) Name() string {
+	return estimatorName
+}
+
+func (e *estimatorProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	speed, ok := e.speedProfile[request.ServiceType]
+	if !ok || speed <= 0 {
+		speed = defaultSpeedKmh
+	}
+
+	option := models.RouteOption{Provider: e.Name()}
+	stops := append(append([]models.LocationRequest{}, request.Waypoints...), request.Destination)
+	from := request.Origin
+	for _, to := range stops {
+		distanceKm := utils.HaversineKm(from.Latitude, from.Longitude, to.Latitude, to.Longitude) * detourFactor
+		leg := models.RouteOptionLeg{
+			DistanceMeters:  distanceKm * 1000,
+			DurationSeconds: distanceKm / speed * 3600,
+		}
+		option.DistanceMeters += leg.DistanceMeters
+		option.DurationSeconds += leg.DurationSeconds
+		option.Legs = append(option.Legs, leg)
+		from = to
+	}
+	return []models.RouteOption{option}, nil
+}
@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+)
+
+type fallbackChain struct {
+	providers []user.RouteProvider
+}
+
+// NewFallbackChain asks the providers in order and returns the routes of the first one that finds any
+func NewFallbackChain(providers ...user.RouteProvider) user.RouteProvider {
+	return &fallbackChain{
+		providers: providers,
+	}
+}
+
+func (f *fallbackChain) Name() string {
+	names := make([]string, 0, len(f.providers))
+	for _, provider := range f.providers {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *fallbackChain) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	var errs []error
+	for _, provider := range f.providers {
+		routes, err := provider.Routes(request, ctx)
+		if err == nil && len(routes) > 0 {
+			return routes, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no routes found")
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		log.GetLogger().Error("route_provider", fmt.Sprintf("Route provider %s failed: %v", provider.Name(), err), "Routes", utils.ConvertString(request))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no route provider configured")
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+
+	"googlemaps.github.io/maps"
+)
+
+type googleProvider struct {
+	mapsClient *maps.Client
+}
+
+// NewGoogleProvider builds the maps client once, it is safe for concurrent use
+func NewGoogleProvider(apiKey string) (user.RouteProvider, error) {
+	mapsClient, err := maps.NewClient(maps.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("error creating Google Maps client: %w", err)
+	}
+	return &googleProvider{
+		mapsClient: mapsClient,
+	}, nil
+}
+
+func (g *googleProvider) Name() string {
+	return "google"
+}
+
+func (g *googleProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	req := &maps.DirectionsRequest{
+		Origin:      latLng(request.Origin),
+		Destination: latLng(request.Destination),
+		Mode:        maps.TravelModeDriving,
+		// Google returns no alternatives for a trip with waypoints
+		Alternatives:  len(request.Waypoints) == 0,
+		DepartureTime: fmt.Sprintf("%d", request.DepartureTime.Unix()),
+		TrafficModel:  maps.TrafficModelBestGuess,
+	}
+	for _, waypoint := range request.Waypoints {
+		req.Waypoints = append(req.Waypoints, latLng(waypoint))
+	}
+
+	routes, _, err := g.mapsClient.Directions(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error making directions request: %w", err)
+	}
+
+	options := make([]models.RouteOption, 0, len(routes))
+	for _, route := range routes {
+		option := models.RouteOption{Provider: g.Name()}
+		for _, leg := range route.Legs {
+			duration := leg.DurationInTraffic
+			if duration == 0 {
+				duration = leg.Duration
+			}
+			option.DistanceMeters += float64(leg.Distance.Meters)
+			option.DurationSeconds += duration.Seconds()
+			option.Legs = append(option.Legs, models.RouteOptionLeg{
+				DistanceMeters:  float64(leg.Distance.Meters),
+				DurationSeconds: duration.Seconds(),
+			})
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+func latLng(location models.LocationRequest) string {
+	return fmt.Sprintf("%f,%f", location.Latitude, location.Longitude)
+}
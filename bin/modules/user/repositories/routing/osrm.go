@@ -0,0 +1,98 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+const osrmTimeout = 5 * time.Second
+
+type osrmProvider struct {
+	baseUrl    string
+	profile    string
+	httpClient *http.Client
+}
+
+type osrmResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Routes  []struct {
+		Distance float64 `json:"distance"`
+		Duration float64 `json:"duration"`
+		Legs     []struct {
+			Distance float64 `json:"distance"`
+			Duration float64 `json:"duration"`
+		} `json:"legs"`
+	} `json:"routes"`
+}
+
+// NewOSRMProvider calls the route service of an OSRM compatible server, profile is usually "driving"
+func NewOSRMProvider(baseUrl string, profile string) user.RouteProvider {
+	if profile == "" {
+		profile = "driving"
+	}
+	return &osrmProvider{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		profile:    profile,
+		httpClient: apmhttp.WrapClient(&http.Client{Timeout: osrmTimeout}),
+	}
+}
+
+func (o *osrmProvider) Name() string {
+	return "osrm"
+}
+
+func (o *osrmProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	points := append(append([]models.LocationRequest{request.Origin}, request.Waypoints...), request.Destination)
+	coordinates := make([]string, 0, len(points))
+	for _, point := range points {
+		// OSRM takes longitude first
+		coordinates = append(coordinates, fmt.Sprintf("%f,%f", point.Longitude, point.Latitude))
+	}
+	url := fmt.Sprintf("%s/route/v1/%s/%s?alternatives=%t&overview=false", o.baseUrl, o.profile,
+		strings.Join(coordinates, ";"), len(request.Waypoints) == 0)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making osrm request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body osrmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error decoding osrm response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Code != "Ok" {
+		return nil, fmt.Errorf("osrm error %s: %s", body.Code, body.Message)
+	}
+
+	options := make([]models.RouteOption, 0, len(body.Routes))
+	for _, route := range body.Routes {
+		option := models.RouteOption{
+			DistanceMeters:  route.Distance,
+			DurationSeconds: route.Duration,
+			Provider:        o.Name(),
+		}
+		for _, leg := range route.Legs {
+			option.Legs = append(option.Legs, models.RouteOptionLeg{
+				DistanceMeters:  leg.Distance,
+				DurationSeconds: leg.Duration,
+			})
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
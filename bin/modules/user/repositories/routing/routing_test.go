@@ -0,0 +1,155 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProvider struct {
+	name   string
+	routes []models.RouteOption
+	err    error
+}
+
+func (s stubProvider) Name() string { return s.name }
+
+func (s stubProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	return s.routes, s.err
+}
+
+var testRouteRequest = models.RouteRequest{
+	Origin:      models.LocationRequest{Latitude: -6.2, Longitude: 106.8},
+	Destination: models.LocationRequest{Latitude: -6.3, Longitude: 106.8},
+	ServiceType: "bike",
+}
+
+func TestFallbackChain_UsesNextProviderOnFailure(t *testing.T) {
+	chain := NewFallbackChain(
+		stubProvider{name: "down", err: errors.New("quota exceeded")},
+		stubProvider{name: "empty"},
+		NewEstimatorProvider(nil),
+	)
+
+	routes, err := chain.Routes(testRouteRequest, context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "estimator", routes[0].Provider)
+}
+
+func TestFallbackChain_AllFailed(t *testing.T) {
+	chain := NewFallbackChain(stubProvider{name: "down", err: errors.New("quota exceeded")})
+
+	_, err := chain.Routes(testRouteRequest, context.Background())
+
+	assert.ErrorContains(t, err, "down: quota exceeded")
+}
+
+func TestEstimatorProvider_SpeedProfile(t *testing.T) {
+	routes, _ := NewEstimatorProvider(map[string]float64{"bike": 30}).Routes(testRouteRequest, context.Background())
+
+	// 11.12km straight line, 14.46km by road at 30km/h
+	assert.InDelta(t, 14455, routes[0].DistanceMeters, 10)
+	assert.InDelta(t, 1734, routes[0].DurationSeconds, 2)
+}
+
+func TestEstimatorProvider_Waypoints(t *testing.T) {
+	request := testRouteRequest
+	request.Waypoints = []models.LocationRequest{{Latitude: -6.25, Longitude: 106.8}}
+
+	routes, _ := NewEstimatorProvider(nil).Routes(request, context.Background())
+
+	assert.Len(t, routes[0].Legs, 2)
+	assert.InDelta(t, routes[0].Legs[0].DistanceMeters+routes[0].Legs[1].DistanceMeters, routes[0].DistanceMeters, 0.001)
+}
+
+func TestOSRMProvider_Routes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/route/v1/driving/106.800000,-6.200000;106.800000,-6.300000", r.URL.Path)
+		w.Write([]byte(`{"code":"Ok","routes":[{"distance":14000.5,"duration":1500},{"distance":15000,"duration":1400}]}`))
+	}))
+	defer server.Close()
+
+	routes, err := NewOSRMProvider(server.URL+"/", "").Routes(testRouteRequest, context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, routes, 2)
+	assert.Equal(t, 14000.5, routes[0].DistanceMeters)
+	assert.Equal(t, "osrm", routes[1].Provider)
+}
+
+type fakeRedis struct {
+	redis.UniversalClient
+	values map[string]string
+	stats  map[string]int64
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	if value, ok := f.values[key]; ok {
+		return redis.NewStringResult(value, nil)
+	}
+	return redis.NewStringResult("", redis.Nil)
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	f.values[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (f *fakeRedis) HIncrBy(ctx context.Context, key string, field string, incr int64) *redis.IntCmd {
+	f.stats[field] += incr
+	return redis.NewIntResult(f.stats[field], nil)
+}
+
+type countingProvider struct {
+	stubProvider
+	calls int
+}
+
+func (c *countingProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	c.calls++
+	return c.stubProvider.Routes(request, ctx)
+}
+
+func TestCachedProvider_SnapsAndBypasses(t *testing.T) {
+	rc := &fakeRedis{values: map[string]string{}, stats: map[string]int64{}}
+	inner := &countingProvider{stubProvider: stubProvider{name: "google", routes: []models.RouteOption{{DistanceMeters: 14000, Provider: "google"}}}}
+	cached := NewCachedProvider(inner, rc, time.Minute, 15*time.Minute)
+	ctx := context.Background()
+	request := testRouteRequest
+	request.DepartureTime = time.Date(2024, 1, 1, 8, 1, 0, 0, time.UTC)
+
+	cached.Routes(request, ctx)
+	// a few meters away and a few minutes later is the same trip
+	nearby := request
+	nearby.Origin.Latitude += 0.0001
+	nearby.DepartureTime = nearby.DepartureTime.Add(5 * time.Minute)
+	routes, err := cached.Routes(nearby, ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 14000.0, routes[0].DistanceMeters)
+	assert.Equal(t, 1, inner.calls)
+
+	nearby.BypassCache = true
+	cached.Routes(nearby, ctx)
+	assert.Equal(t, 2, inner.calls)
+	assert.Equal(t, map[string]int64{"hits": 1, "misses": 1, "bypassed": 1}, rc.stats)
+}
+
+func TestCachedProvider_SkipsEstimates(t *testing.T) {
+	rc := &fakeRedis{values: map[string]string{}, stats: map[string]int64{}}
+	cached := NewCachedProvider(NewEstimatorProvider(nil), rc, time.Minute, time.Minute)
+
+	cached.Routes(testRouteRequest, context.Background())
+
+	assert.Empty(t, rc.values)
+}
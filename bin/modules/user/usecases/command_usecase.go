@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
 	"location-service/bin/modules/user"
 	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
 	httpError "location-service/bin/pkg/http-error"
 	"location-service/bin/pkg/log"
 	"location-service/bin/pkg/utils"
@@ -13,37 +16,58 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
-	"googlemaps.github.io/maps"
 )
 
+// routeBypassInterval is how often a rider may ask for fresh routes instead of the cached ones
+const routeBypassInterval = 10 * time.Minute
+
 type commandUsecase struct {
 	userRepositoryQuery   user.MongodbRepositoryQuery
 	userRepositoryCommand user.MongodbRepositoryCommand
-	googleMapsAPIKey      string
+	routeProvider         user.RouteProvider
 	redisClient           redis.UniversalClient
+	pricingEngine         user.PricingEngine
+	surgePricing          user.SurgePricing
+	rides                 ride.UsecaseCommand
 }
 
-func NewCommandUsecase(mq user.MongodbRepositoryQuery, mc user.MongodbRepositoryCommand, gkey string, rc redis.UniversalClient) user.UsecaseCommand {
+func NewCommandUsecase(mq user.MongodbRepositoryQuery, mc user.MongodbRepositoryCommand, rp user.RouteProvider, rc redis.UniversalClient, pe user.PricingEngine, sp user.SurgePricing, rides ride.UsecaseCommand) user.UsecaseCommand {
 	return &commandUsecase{
 		userRepositoryQuery:   mq,
 		userRepositoryCommand: mc,
-		googleMapsAPIKey:      gkey,
+		routeProvider:         rp,
 		redisClient:           rc,
+		pricingEngine:         pe,
+		surgePricing:          sp,
+		rides:                 rides,
 	}
 }
 
 func (c *commandUsecase) PostLocation(userId string, payload models.LocationSuggestionRequest, ctx context.Context) utils.Result {
 	var result utils.Result
-	mapsClient, err := maps.NewClient(maps.WithAPIKey(c.googleMapsAPIKey))
+	if payload.PickupAt != nil {
+		if err := validatePickupAt(*payload.PickupAt, time.Now(), scheduledRideLead()); err != nil {
+			errObj := httpError.NewBadRequest()
+			errObj.Message = err.Error()
+			result.Error = errObj
+			return result
+		}
+	}
+	serviceType := payload.ServiceType
+	if serviceType == "" {
+		serviceType = models.DefaultServiceType
+	}
+	zone := c.surgePricing.Zone(payload.CurrentLocation.Latitude, payload.CurrentLocation.Longitude)
+	surge, err := c.surgePricing.Multiplier(zone, ctx)
 	if err != nil {
-		errObj := httpError.NewInternalServerError()
-		errObj.Message = fmt.Sprintf("error creating Google Maps client: %v", err)
-		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "PostLocation", utils.ConvertString(err))
-		return result
+		// a quote without surge is better than no quote
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Error get surge of zone %s: %v", zone, err), "PostLocation", utils.ConvertString(err))
+		surge.Multiplier = models.NoSurge
 	}
-
-	routeSuggestion, err := c.getRouteSuggestions(ctx, mapsClient, payload.CurrentLocation, payload.Destination)
+	if payload.BypassCache {
+		payload.BypassCache = c.allowCacheBypass(userId, ctx)
+	}
+	routeSuggestion, err := c.getRouteSuggestions(ctx, payload, serviceType, surge.Multiplier)
 	if err != nil {
 		errObj := httpError.NewNotFound()
 		errObj.Message = fmt.Sprintf("error getRouteSuggestions: %v", err)
@@ -52,8 +76,12 @@ func (c *commandUsecase) PostLocation(userId string, payload models.LocationSugg
 		return result
 	}
 	key := fmt.Sprintf("USER:ROUTE:%s", userId)
+	routeSuggestion.Zone = zone
 	routeSuggestion.Route.Origin = payload.CurrentLocation
+	routeSuggestion.Route.Stops = payload.Stops
 	routeSuggestion.Route.Destination = payload.Destination
+	routeSuggestion.PickupAt = payload.PickupAt
+	routeSuggestion.RideId = quoteRide(c.rides, userId, *routeSuggestion, ctx)
 	routeSummaryJSON, err := json.Marshal(routeSuggestion)
 	if err != nil {
 		errObj := httpError.NewInternalServerError()
@@ -71,52 +99,114 @@ func (c *commandUsecase) PostLocation(userId string, payload models.LocationSugg
 		log.GetLogger().Error("command_usecase", errObj.Message, "PostLocation", utils.ConvertString(redisErr))
 		return result
 	}
+	c.recordRecentDestination(userId, payload.Destination, ctx)
 	result.Data = routeSuggestion
 	return result
 }
 
-func (c *commandUsecase) getRouteSuggestions(ctx context.Context, mapsClient *maps.Client, currentRequest models.LocationRequest, destinationRequest models.LocationRequest) (*models.RouteSummary, error) {
-	origin := fmt.Sprintf("%f,%f", currentRequest.Latitude, currentRequest.Longitude)
-	destination := fmt.Sprintf("%f,%f", destinationRequest.Latitude, destinationRequest.Longitude)
-	departureTime := time.Now().Add(5 * time.Minute).Unix()
+// priceLegs splits the trip fare, without the booking fee, between the legs by distance, the last leg takes
+// the rounding so the legs add up to the trip fare
+func priceLegs(route models.Route, option models.RouteOption, fare models.FareBreakdown) []models.RouteLeg {
+	points := route.Points()
+	legs := option.Legs
+	if len(legs) != len(points)-1 {
+		// the provider did not split the route, price it as a single leg
+		points = []models.LocationRequest{route.Origin, route.Destination}
+		legs = []models.RouteOptionLeg{{DistanceMeters: option.DistanceMeters, DurationSeconds: option.DurationSeconds}}
+	}
 
-	req := &maps.DirectionsRequest{
-		Origin:        origin,
-		Destination:   destination,
-		Mode:          maps.TravelModeDriving,
-		Alternatives:  true,
-		Optimize:      true,
-		DepartureTime: fmt.Sprintf("%d", departureTime),
-		TrafficModel:  maps.TrafficModelBestGuess,
+	tripFare := fare.Total - fare.BookingFee
+	remaining := tripFare
+	priced := make([]models.RouteLeg, 0, len(legs))
+	for i, leg := range legs {
+		legFare := remaining
+		if i < len(legs)-1 && option.DistanceMeters > 0 {
+			legFare = math.Min(math.Round(tripFare*leg.DistanceMeters/option.DistanceMeters), remaining)
+		}
+		remaining -= legFare
+		priced = append(priced, models.RouteLeg{
+			From:            points[i],
+			To:              points[i+1],
+			DistanceKm:      leg.DistanceMeters / 1000,
+			DurationMinutes: leg.DurationSeconds / 60,
+			Fare:            legFare,
+		})
 	}
+	return priced
+}
 
-	routes, _, err := mapsClient.Directions(ctx, req)
+// recordRecentDestination only logs its errors, the quote is already made
+func (c *commandUsecase) recordRecentDestination(userId string, destination models.LocationRequest, ctx context.Context) {
+	recentsRes := <-c.userRepositoryQuery.FindRecentDestinations(ctx, userId, recentDestinationScan)
+	if recentsRes.Error != nil {
+		log.GetLogger().Error("command_usecase", "Error find recent destinations", "recordRecentDestination", utils.ConvertString(recentsRes.Error))
+		return
+	}
+
+	recents, _ := recentsRes.Data.([]models.RecentDestination)
+	recent := models.RecentDestination{
+		UserId: userId,
+	}
+	if i := findNearbyDestination(recents, destination); i >= 0 {
+		recent = recents[i]
+	}
+	recent.Destination = destination
+	recent.Count++
+	recent.LastUsedAt = time.Now()
+
+	upsertRes := <-c.userRepositoryCommand.UpsertRecentDestination(recent, ctx)
+	if upsertRes.Error != nil {
+		log.GetLogger().Error("command_usecase", "Error save recent destination", "recordRecentDestination", utils.ConvertString(upsertRes.Error))
+	}
+}
+
+// allowCacheBypass lets a rider skip the route cache once per routeBypassInterval, every bypass is paid to the
+// providers. A rider past the limit gets the cached routes.
+func (c *commandUsecase) allowCacheBypass(userId string, ctx context.Context) bool {
+	allowed, err := c.redisClient.SetNX(ctx, fmt.Sprintf(constants.RouteBypassKey, userId), 1, routeBypassInterval).Result()
 	if err != nil {
-		return nil, fmt.Errorf("error making directions request: %w", err)
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Error check route cache bypass of rider %s: %v", userId, err), "allowCacheBypass", utils.ConvertString(err))
+		return false
+	}
+	return allowed
+}
+
+func (c *commandUsecase) getRouteSuggestions(ctx context.Context, payload models.LocationSuggestionRequest, serviceType string, surgeMultiplier float64) (*models.RouteSummary, error) {
+	departureTime := time.Now().Add(5 * time.Minute)
+	if payload.PickupAt != nil {
+		departureTime = *payload.PickupAt
+	}
+	routes, err := c.routeProvider.Routes(models.RouteRequest{
+		Origin:        payload.CurrentLocation,
+		Destination:   payload.Destination,
+		Waypoints:     payload.Stops,
+		ServiceType:   serviceType,
+		DepartureTime: departureTime,
+		BypassCache:   payload.BypassCache,
+	}, ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(routes) == 0 {
 		return nil, fmt.Errorf("no routes found")
 	}
 
-	const pricePerKm = 3000.0
 	var minPrice, maxPrice float64
 	var bestRouteKm, bestRoutePrice, bestRouteDuration float64
+	var bestFare models.FareBreakdown
+	var bestRoute models.RouteOption
 
 	minPrice = math.MaxFloat64
 	maxPrice = -math.MaxFloat64
 
+	// the city picks the fare rule and the driver search cap, it comes from the pickup and never from the rider
+	city := c.pricingEngine.City(payload.CurrentLocation.Latitude, payload.CurrentLocation.Longitude)
 	for _, route := range routes {
-		totalDistance := 0.0
-		totalDuration := 0.0
-
-		for _, leg := range route.Legs {
-			totalDistance += float64(leg.Distance.Meters)
-			totalDuration += float64(leg.DurationInTraffic.Seconds())
-		}
-
-		distanceInKm := totalDistance / 1000.0
-		price := distanceInKm * pricePerKm
+		distanceInKm := route.DistanceMeters / 1000.0
+		durationInMinutes := route.DurationSeconds / 60
+		fare := c.pricingEngine.Quote(serviceType, city, distanceInKm, durationInMinutes, len(payload.Stops), surgeMultiplier)
+		price := fare.Total
 
 		if price < minPrice {
 			minPrice = price
@@ -128,7 +218,9 @@ func (c *commandUsecase) getRouteSuggestions(ctx context.Context, mapsClient *ma
 		if bestRouteKm == 0 || price < bestRoutePrice {
 			bestRouteKm = distanceInKm
 			bestRoutePrice = price
-			bestRouteDuration = totalDuration / 60
+			bestRouteDuration = durationInMinutes
+			bestFare = fare
+			bestRoute = route
 		}
 	}
 
@@ -139,6 +231,367 @@ func (c *commandUsecase) getRouteSuggestions(ctx context.Context, mapsClient *ma
 		BestRoutePrice:    bestRoutePrice,
 		BestRouteDuration: utils.FormatDuration(int(math.Ceil(bestRouteDuration))),
 		Duration:          int(math.Ceil(bestRouteDuration)),
+		Fare:              bestFare,
+		SurgeMultiplier:   bestFare.SurgeMultiplier,
+		Legs:              priceLegs(models.Route{Origin: payload.CurrentLocation, Stops: payload.Stops, Destination: payload.Destination}, bestRoute, bestFare),
+		Provider:          bestRoute.Provider,
 	}, nil
 
 }
+
+// RecordRideDemand counts a request-ride in the surge demand of its pickup zone
+func (c *commandUsecase) RecordRideDemand(payload models.RequestRide, ctx context.Context) utils.Result {
+	var result utils.Result
+	origin := payload.RouteSummary.Route.Origin
+	zone := c.surgePricing.Zone(origin.Latitude, origin.Longitude)
+	if err := c.surgePricing.RecordDemand(zone, payload.UserId, ctx); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error record demand of zone %s: %v", zone, err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "RecordRideDemand", utils.ConvertString(err))
+		return result
+	}
+	result.Data = zone
+	return result
+}
+
+// ChargeCancellationFee takes the fee of a cancelled ride from the rider wallet, the balance may go below zero. The
+// transaction is keyed by ride, a ride-cancelled read again is not charged twice.
+func (c *commandUsecase) ChargeCancellationFee(payload models.RideCancelled, ctx context.Context) utils.Result {
+	var result utils.Result
+	chargeRes := <-c.userRepositoryCommand.ChargeWallet(payload.UserId, models.TransactionLog{
+		TransactionID: fmt.Sprintf("cancellation-%s", payload.RideId),
+		Amount:        payload.Fee,
+		Type:          "debit",
+		Description:   fmt.Sprintf("Cancellation fee of ride %s", payload.RideId),
+		Timestamp:     payload.CancelledAt,
+	}, ctx)
+	if chargeRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error charge cancellation fee of ride %s: %v", payload.RideId, chargeRes.Error)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ChargeCancellationFee", utils.ConvertString(chargeRes.Error))
+		return result
+	}
+	if charged, _ := chargeRes.Data.(bool); !charged {
+		log.GetLogger().Info("command_usecase", fmt.Sprintf("Cancellation fee of ride %s not charged, already charged or no wallet for rider %s", payload.RideId, payload.UserId), "ChargeCancellationFee", "")
+	}
+	result.Data = chargeRes.Data
+	return result
+}
+
+func (c *commandUsecase) OverrideSurge(zone string, payload models.SurgeOverrideRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	if !validSurgeZone(zone) {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Invalid zone %s, expected a geohash of %d characters", zone, models.SurgeZonePrecision)
+		result.Error = errObj
+		return result
+	}
+
+	state, err := c.surgePricing.Override(zone, payload.Multiplier, time.Duration(payload.TTLSeconds)*time.Second, ctx)
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error override surge of zone %s: %v", zone, err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "OverrideSurge", utils.ConvertString(err))
+		return result
+	}
+	log.GetLogger().Info("command_usecase", fmt.Sprintf("Surge of zone %s overridden", zone), "OverrideSurge", utils.ConvertString(payload))
+	result.Data = state
+	return result
+}
+
+func (c *commandUsecase) ClearSurgeOverride(zone string, ctx context.Context) utils.Result {
+	var result utils.Result
+	if !validSurgeZone(zone) {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Invalid zone %s, expected a geohash of %d characters", zone, models.SurgeZonePrecision)
+		result.Error = errObj
+		return result
+	}
+
+	if err := c.surgePricing.ClearOverride(zone, ctx); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error clear surge override of zone %s: %v", zone, err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ClearSurgeOverride", utils.ConvertString(err))
+		return result
+	}
+	result.Data = zone
+	return result
+}
+
+func (c *commandUsecase) CreateSavedPlace(userId string, payload models.SavedPlaceRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	placesRes := <-c.userRepositoryQuery.FindSavedPlaces(ctx, userId)
+	if placesRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find saved places"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CreateSavedPlace", utils.ConvertString(placesRes.Error))
+		return result
+	}
+
+	places, _ := placesRes.Data.([]models.SavedPlace)
+	now := time.Now()
+	place := models.SavedPlace{
+		UserId:    userId,
+		CreatedAt: now,
+	}
+	customPlaces := 0
+	for _, saved := range places {
+		// a rider has one home and one work, saving it again moves it
+		if payload.Label != models.SavedPlaceCustom && saved.Label == payload.Label {
+			place = saved
+		}
+		if saved.Label == models.SavedPlaceCustom {
+			customPlaces++
+		}
+	}
+	if place.ID.IsZero() && payload.Label == models.SavedPlaceCustom && customPlaces >= models.MaxCustomSavedPlaces {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("You can save up to %d places, please delete one first", models.MaxCustomSavedPlaces)
+		result.Error = errObj
+		return result
+	}
+
+	place.Label = payload.Label
+	place.Name = savedPlaceName(payload)
+	place.Location = payload.Location
+	place.UpdatedAt = now
+
+	var saveRes utils.Result
+	if place.ID.IsZero() {
+		saveRes = <-c.userRepositoryCommand.InsertSavedPlace(place, ctx)
+	} else {
+		saveRes = <-c.userRepositoryCommand.UpdateSavedPlace(place, ctx)
+	}
+	if saveRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error save place"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CreateSavedPlace", utils.ConvertString(saveRes.Error))
+		return result
+	}
+	result.Data = saveRes.Data
+	return result
+}
+
+func (c *commandUsecase) UpdateSavedPlace(userId string, placeId string, payload models.SavedPlaceRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	placesRes := <-c.userRepositoryQuery.FindSavedPlaces(ctx, userId)
+	if placesRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find saved places"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "UpdateSavedPlace", utils.ConvertString(placesRes.Error))
+		return result
+	}
+
+	var place *models.SavedPlace
+	places, _ := placesRes.Data.([]models.SavedPlace)
+	for i, saved := range places {
+		if saved.ID.Hex() == placeId {
+			place = &places[i]
+			continue
+		}
+		if payload.Label != models.SavedPlaceCustom && saved.Label == payload.Label {
+			errObj := httpError.NewBadRequest()
+			errObj.Message = fmt.Sprintf("You already saved a %s place", payload.Label)
+			result.Error = errObj
+			return result
+		}
+	}
+	if place == nil {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Saved place not found"
+		result.Error = errObj
+		return result
+	}
+
+	place.Label = payload.Label
+	place.Name = savedPlaceName(payload)
+	place.Location = payload.Location
+	place.UpdatedAt = time.Now()
+	updateRes := <-c.userRepositoryCommand.UpdateSavedPlace(*place, ctx)
+	if updateRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error save place"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "UpdateSavedPlace", utils.ConvertString(updateRes.Error))
+		return result
+	}
+	result.Data = updateRes.Data
+	return result
+}
+
+func (c *commandUsecase) DeleteSavedPlace(userId string, placeId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	deleteRes := <-c.userRepositoryCommand.DeleteSavedPlace(userId, placeId, ctx)
+	if deleteRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error delete place"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "DeleteSavedPlace", utils.ConvertString(deleteRes.Error))
+		return result
+	}
+	if deleted, _ := deleteRes.Data.(bool); !deleted {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Saved place not found"
+		result.Error = errObj
+		return result
+	}
+	result.Data = placeId
+	return result
+}
+
+// ScheduleRide books the last quote of the rider, the quote must have been made for a pickup time
+func (c *commandUsecase) ScheduleRide(userId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	var tripPlan models.RouteSummary
+	key := fmt.Sprintf("USER:ROUTE:%s", userId)
+	redisData, errRedis := c.redisClient.Get(ctx, key).Result()
+	if errRedis != nil || redisData == "" {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Quote not found, please request a quote with a pickup time first"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ScheduleRide", utils.ConvertString(errRedis))
+		return result
+	}
+	if err := json.Unmarshal([]byte(redisData), &tripPlan); err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error unmarshal tripdata: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ScheduleRide", utils.ConvertString(err))
+		return result
+	}
+	if tripPlan.PickupAt == nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = "The quote has no pickup time, please request a quote with a pickup time"
+		result.Error = errObj
+		return result
+	}
+	now := time.Now()
+	lead := scheduledRideLead()
+	// the quote lives for an hour, its pickup time may be too close by now
+	if err := validatePickupAt(*tripPlan.PickupAt, now, lead); err != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = err.Error()
+		result.Error = errObj
+		return result
+	}
+	walletCheck := <-c.userRepositoryQuery.Findwallet(ctx, userId)
+	if walletCheck.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Wallet not found, Please create wallet first"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ScheduleRide", utils.ConvertString(walletCheck.Error))
+		return result
+	}
+	if wallet := walletCheck.Data.(models.Wallet); wallet.Balance <= tripPlan.MaxPrice {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = "insufficient balance, please topup"
+		result.Error = errObj
+		return result
+	}
+	// the quote is booked once, of two requests racing for it only the one that deletes it schedules the ride
+	consumed, err := c.redisClient.Del(ctx, key).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error schedule ride"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ScheduleRide", utils.ConvertString(err))
+		return result
+	}
+	if consumed == 0 {
+		errObj := httpError.NewConflict()
+		errObj.Message = "This quote is already booked, please request a new quote"
+		result.Error = errObj
+		return result
+	}
+
+	insertRes := <-c.userRepositoryCommand.InsertScheduledRide(models.ScheduledRide{
+		UserId:       userId,
+		RouteSummary: tripPlan,
+		PickupAt:     *tripPlan.PickupAt,
+		DispatchAt:   tripPlan.PickupAt.Add(-lead),
+		Status:       models.ScheduledRideScheduled,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, ctx)
+	if insertRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error schedule ride"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "ScheduleRide", utils.ConvertString(insertRes.Error))
+		// give the quote back so the rider can try again
+		if err := c.redisClient.Set(ctx, key, redisData, 60*time.Minute).Err(); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Error restore quote of rider %s: %v", userId, err), "ScheduleRide", utils.ConvertString(err))
+		}
+		return result
+	}
+	result.Data = insertRes.Data
+	return result
+}
+
+// CancelScheduledRide cancels a ride whose driver search has not started yet
+func (c *commandUsecase) CancelScheduledRide(userId string, rideId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	rideRes := <-c.userRepositoryQuery.FindScheduledRide(ctx, userId, rideId)
+	if rideRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find scheduled ride"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CancelScheduledRide", utils.ConvertString(rideRes.Error))
+		return result
+	}
+	ride, _ := rideRes.Data.(models.ScheduledRide)
+	if ride.ID.IsZero() {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "Scheduled ride not found"
+		result.Error = errObj
+		return result
+	}
+	if ride.Status != models.ScheduledRideScheduled {
+		errObj := httpError.NewConflict()
+		errObj.Message = fmt.Sprintf("Scheduled ride can not be cancelled, it is %s", ride.Status)
+		result.Error = errObj
+		return result
+	}
+
+	ride.Status = models.ScheduledRideCancelled
+	ride.UpdatedAt = time.Now()
+	updateRes := <-c.userRepositoryCommand.UpdateScheduledRide(ride, models.ScheduledRideScheduled, ctx)
+	if updateRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error cancel scheduled ride"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "CancelScheduledRide", utils.ConvertString(updateRes.Error))
+		return result
+	}
+	// the scheduler claimed the ride between the read and the update
+	if updated, _ := updateRes.Data.(bool); !updated {
+		errObj := httpError.NewConflict()
+		errObj.Message = "Scheduled ride can not be cancelled, the driver search has started"
+		result.Error = errObj
+		return result
+	}
+	moveRide(c.rides, ride.RouteSummary.RideId, rideModels.Transition{
+		Status:  rideModels.StatusCancelled,
+		From:    rideModels.StatusQuoted,
+		Actor:   rideModels.ActorRider,
+		ActorId: userId,
+		Reason:  "scheduled ride cancelled",
+	}, "CancelScheduledRide", ctx)
+	result.Data = ride
+	return result
+}
+
+// savedPlaceName names home and work after their label when the rider gave no name
+func savedPlaceName(payload models.SavedPlaceRequest) string {
+	if payload.Name == "" {
+		return payload.Label
+	}
+	return payload.Name
+}
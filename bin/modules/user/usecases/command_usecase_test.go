@@ -0,0 +1,76 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAllowCacheBypass(t *testing.T) {
+	mockRedis := new(MockRedisClient)
+	usecase := &commandUsecase{redisClient: mockRedis}
+	ctx := context.Background()
+
+	mockRedis.On("SetNX", ctx, "ROUTE:BYPASS:user123", 1, routeBypassInterval).Return(redis.NewBoolResult(true, nil)).Once()
+	mockRedis.On("SetNX", ctx, "ROUTE:BYPASS:user123", 1, routeBypassInterval).Return(redis.NewBoolResult(false, nil)).Once()
+
+	assert.True(t, usecase.allowCacheBypass("user123", ctx))
+	// a second bypass within the interval is served from the cache
+	assert.False(t, usecase.allowCacheBypass("user123", ctx))
+}
+
+func TestChargeCancellationFee(t *testing.T) {
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := &commandUsecase{userRepositoryCommand: mockCommand}
+	ctx := context.Background()
+	cancelledAt := time.Now()
+
+	mockCommand.On("ChargeWallet", "user123", models.TransactionLog{
+		TransactionID: "cancellation-ride1",
+		Amount:        7000,
+		Type:          "debit",
+		Description:   "Cancellation fee of ride ride1",
+		Timestamp:     cancelledAt,
+	}, ctx).Return(utils.Result{Data: true})
+
+	result := usecase.ChargeCancellationFee(models.RideCancelled{RideId: "ride1", UserId: "user123", Fee: 7000, CancelledAt: cancelledAt}, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, true, result.Data)
+	mockCommand.AssertExpectations(t)
+}
+
+func TestChargeCancellationFee_AlreadyCharged(t *testing.T) {
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := &commandUsecase{userRepositoryCommand: mockCommand}
+	ctx := context.Background()
+
+	mockCommand.On("ChargeWallet", "user123", mock.Anything, ctx).Return(utils.Result{Data: false})
+
+	// a ride-cancelled read again after a rewind is not an error
+	result := usecase.ChargeCancellationFee(models.RideCancelled{RideId: "ride1", UserId: "user123", Fee: 7000}, ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Equal(t, false, result.Data)
+}
+
+func TestChargeCancellationFee_Error(t *testing.T) {
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := &commandUsecase{userRepositoryCommand: mockCommand}
+	ctx := context.Background()
+
+	mockCommand.On("ChargeWallet", "user123", mock.Anything, ctx).Return(utils.Result{Error: errors.New("connection refused")})
+
+	result := usecase.ChargeCancellationFee(models.RideCancelled{RideId: "ride1", UserId: "user123", Fee: 7000}, ctx)
+
+	assert.IsType(t, httpError.InternalServerErrorData{}, result.Error)
+}
@@ -0,0 +1,50 @@
+package usecases
+
+import (
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+	"sort"
+	"time"
+)
+
+const (
+	// commuteMatchRadiusKm is how far the driver path may pass from the rider origin and destination
+	commuteMatchRadiusKm = 1.0
+	// commuteWindowSlack widens the departure window of offers, commuters wait a little for each other
+	commuteWindowSlack = 30 * time.Minute
+	// commuteCandidateLimit is how many offers near the origin are checked against the destination
+	commuteCandidateLimit = 50
+)
+
+// matchCommuteOffer accepts an offer whose path passes near the origin, then further along near the destination
+func matchCommuteOffer(offer models.CommuteOffer, origin models.LocationRequest, destination models.LocationRequest, radiusKm float64) (models.CommuteOfferMatch, bool) {
+	pickupKm, pickupAlongKm := utils.ProjectOnPolyline(origin.Latitude, origin.Longitude, offer.Path.Coordinates)
+	dropoffKm, dropoffAlongKm := utils.ProjectOnPolyline(destination.Latitude, destination.Longitude, offer.Path.Coordinates)
+	if pickupKm > radiusKm || dropoffKm > radiusKm {
+		return models.CommuteOfferMatch{}, false
+	}
+	// the driver would pass the destination first, the offer goes the other way
+	if dropoffAlongKm <= pickupAlongKm {
+		return models.CommuteOfferMatch{}, false
+	}
+	return models.CommuteOfferMatch{
+		Offer:             offer,
+		PickupDistanceKm:  round2(pickupKm),
+		DropoffDistanceKm: round2(dropoffKm),
+		RideKm:            round2(dropoffAlongKm - pickupAlongKm),
+	}, true
+}
+
+// rankCommuteOffers keeps the offers going the rider way, the least walking first
+func rankCommuteOffers(offers []models.CommuteOffer, origin models.LocationRequest, destination models.LocationRequest) []models.CommuteOfferMatch {
+	matches := make([]models.CommuteOfferMatch, 0, len(offers))
+	for _, offer := range offers {
+		if match, ok := matchCommuteOffer(offer, origin, destination, commuteMatchRadiusKm); ok {
+			matches = append(matches, match)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].PickupDistanceKm+matches[i].DropoffDistanceKm < matches[j].PickupDistanceKm+matches[j].DropoffDistanceKm
+	})
+	return matches
+}
@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// commutePath goes east along latitude -6.2 from longitude 106.80 to 106.90
+var commutePath = models.GeoJSONLineString{
+	Type:        "LineString",
+	Coordinates: [][]float64{{106.80, -6.2}, {106.85, -6.2}, {106.90, -6.2}},
+}
+
+func TestMatchCommuteOffer(t *testing.T) {
+	offer := models.CommuteOffer{DriverId: "driver1", Path: commutePath}
+	origin := models.LocationRequest{Latitude: -6.203, Longitude: 106.82}
+	destination := models.LocationRequest{Latitude: -6.2, Longitude: 106.88}
+
+	match, ok := matchCommuteOffer(offer, origin, destination, 1)
+
+	assert.True(t, ok)
+	assert.InDelta(t, 0.33, match.PickupDistanceKm, 0.01)
+	assert.Equal(t, 0.0, match.DropoffDistanceKm)
+	assert.InDelta(t, 6.6, match.RideKm, 0.1)
+
+	// same places, other way
+	_, ok = matchCommuteOffer(offer, destination, origin, 1)
+	assert.False(t, ok)
+
+	// destination 5 km off the path
+	_, ok = matchCommuteOffer(offer, origin, models.LocationRequest{Latitude: -6.245, Longitude: 106.88}, 1)
+	assert.False(t, ok)
+}
+
+func TestSearchCommuteOffers(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	usecase := NewQueryUsecase(mockQuery, nil, nil, nil, nil, nil, nil, nil)
+
+	ctx := context.Background()
+	departAt := time.Now().Add(2 * time.Hour)
+	near := models.NewGeoJSONPoint(-6.2, 106.82)
+	offers := []models.CommuteOffer{
+		{DriverId: "westbound", Path: models.GeoJSONLineString{Type: "LineString", Coordinates: [][]float64{{106.90, -6.2}, {106.80, -6.2}}}},
+		{DriverId: "eastbound", Path: commutePath},
+	}
+	mockQuery.On("FindCommuteOffersNear", ctx, near, 1000.0, departAt.Add(-commuteWindowSlack), departAt.Add(commuteWindowSlack), 1, int64(commuteCandidateLimit)).
+		Return(utils.Result{Data: offers})
+
+	result := usecase.SearchCommuteOffers(models.CommuteSearchRequest{
+		OriginLatitude:       -6.2,
+		OriginLongitude:      106.82,
+		DestinationLatitude:  -6.2,
+		DestinationLongitude: 106.88,
+		DepartAt:             departAt,
+	}, ctx)
+
+	assert.Nil(t, result.Error)
+	matches := result.Data.([]models.CommuteOfferMatch)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "eastbound", matches[0].Offer.DriverId)
+	mockQuery.AssertExpectations(t)
+}
@@ -0,0 +1,62 @@
+package usecases
+
+import (
+	"location-service/bin/config"
+	"location-service/bin/modules/user/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultDispatchWaveSize offers a ride to one driver at a time when DISPATCH_WAVE_SIZE is not set
+	defaultDispatchWaveSize = 1
+	// defaultDispatchOfferTTL is how long a driver has to answer when DISPATCH_OFFER_TTL is not set
+	defaultDispatchOfferTTL = 15 * time.Second
+
+	// riderSearchLockTTL holds the search of a rider while its drivers are searched and ranked
+	riderSearchLockTTL = time.Minute
+	// riderSearchGrace keeps the search of a rider past the last wave of its dispatch, the driver module ends it
+	// earlier when a driver accepts or every driver declined
+	riderSearchGrace = time.Minute
+	// tripPickupTTL keeps the pickup of a dispatched ride for the tracking of the trip
+	tripPickupTTL = 4 * time.Hour
+)
+
+// newDispatch is due at once so the dispatch worker offers the first wave on its next tick
+func newDispatch(userId string, rideId string, shortlist []models.RankedDriver, now time.Time) models.Dispatch {
+	candidates := make([]string, 0, len(shortlist))
+	for _, driver := range shortlist {
+		candidates = append(candidates, driver.DriverId)
+	}
+	waveSize := config.GetConfig().DispatchWaveSize
+	if waveSize <= 0 {
+		waveSize = defaultDispatchWaveSize
+	}
+	offerTTL := time.Duration(config.GetConfig().DispatchOfferTTL) * time.Second
+	if offerTTL <= 0 {
+		offerTTL = defaultDispatchOfferTTL
+	}
+	return models.Dispatch{
+		ID:         primitive.NewObjectID(),
+		UserId:     userId,
+		RideId:     rideId,
+		Candidates: candidates,
+		WaveSize:   waveSize,
+		OfferTTL:   offerTTL,
+		Status:     models.DispatchSearching,
+		DueAt:      now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+// dispatchLifetime is how long the dispatch offers the ride if every wave lets its offers expire
+func dispatchLifetime(dispatch models.Dispatch) time.Duration {
+	waveSize := dispatch.WaveSize
+	if waveSize <= 0 {
+		waveSize = 1
+	}
+	waves := (len(dispatch.Candidates) + waveSize - 1) / waveSize
+	return time.Duration(waves) * dispatch.OfferTTL
+}
@@ -0,0 +1,160 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultDriverSearchSteps widens from 1 to 8 km, waiting a little before each step for drivers to free up
+	DefaultDriverSearchSteps = "1:0,3:2,5:2,8:2"
+	// DefaultDriverSearchMinDrivers is enough drivers for the matching strategy to have a choice
+	DefaultDriverSearchMinDrivers = 3
+	// driverCandidateLimit is how many of the nearest drivers a step reads, the matching strategy ranks them all
+	driverCandidateLimit = 20
+)
+
+// DriverSearchStep is one radius of the driver search, Delay is the wait before searching it
+type DriverSearchStep struct {
+	RadiusKm float64
+	Delay    time.Duration
+}
+
+// DriverSearch widens the radius around the pickup step by step until MinDrivers are found or the steps, capped
+// by the max radius of the city, run out
+type DriverSearch struct {
+	steps         []DriverSearchStep
+	minDrivers    int
+	cityMaxRadius map[string]float64
+}
+
+// legacyDriverSearch is a single 3 km search, the behaviour before the widening search
+var legacyDriverSearch = NewDriverSearch([]DriverSearchStep{{RadiusKm: 3}}, 1, nil)
+
+func NewDriverSearch(steps []DriverSearchStep, minDrivers int, cityMaxRadius map[string]float64) *DriverSearch {
+	if minDrivers <= 0 {
+		minDrivers = 1
+	}
+	cities := make(map[string]float64, len(cityMaxRadius))
+	for city, maxRadius := range cityMaxRadius {
+		cities[strings.ToLower(strings.TrimSpace(city))] = maxRadius
+	}
+	return &DriverSearch{
+		steps:         steps,
+		minDrivers:    minDrivers,
+		cityMaxRadius: cities,
+	}
+}
+
+// ParseDriverSearchSteps reads steps written as radiusKm:delaySeconds separated by commas, e.g. 1:0,3:2,5:2,8:2.
+// The delay can be left out, the radii must grow.
+func ParseDriverSearchSteps(spec string) ([]DriverSearchStep, error) {
+	var steps []DriverSearchStep
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		radius, delay, _ := strings.Cut(part, ":")
+		radiusKm, err := strconv.ParseFloat(strings.TrimSpace(radius), 64)
+		if err != nil || radiusKm <= 0 {
+			return nil, fmt.Errorf("invalid driver search radius %q", part)
+		}
+		step := DriverSearchStep{RadiusKm: radiusKm}
+		if strings.TrimSpace(delay) != "" {
+			seconds, err := strconv.Atoi(strings.TrimSpace(delay))
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("invalid driver search delay %q", part)
+			}
+			step.Delay = time.Duration(seconds) * time.Second
+		}
+		if len(steps) > 0 && radiusKm <= steps[len(steps)-1].RadiusKm {
+			return nil, fmt.Errorf("driver search radii must grow, got %q", spec)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no driver search step in %q", spec)
+	}
+	return steps, nil
+}
+
+// ParseDriverSearchCityLimits reads the max search radius of cities written as city:radiusKm separated by commas,
+// e.g. jakarta:5,bogor:8
+func ParseDriverSearchCityLimits(spec string) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		city, radius, found := strings.Cut(part, ":")
+		radiusKm, err := strconv.ParseFloat(strings.TrimSpace(radius), 64)
+		if !found || strings.TrimSpace(city) == "" || err != nil || radiusKm <= 0 {
+			return nil, fmt.Errorf("invalid driver search city limit %q", part)
+		}
+		limits[city] = radiusKm
+	}
+	return limits, nil
+}
+
+// stepsFor caps the steps at the max radius of the city, the first step past the cap searches the cap itself
+func (d *DriverSearch) stepsFor(city string) []DriverSearchStep {
+	maxRadius, ok := d.cityMaxRadius[strings.ToLower(strings.TrimSpace(city))]
+	if !ok {
+		return d.steps
+	}
+	steps := make([]DriverSearchStep, 0, len(d.steps))
+	for _, step := range d.steps {
+		if step.RadiusKm >= maxRadius {
+			step.RadiusKm = maxRadius
+			steps = append(steps, step)
+			break
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// searchDrivers runs the steps of the city around the pickup and returns the drivers of the last radius searched
+// with that radius
+func (q *queryUsecase) searchDrivers(pickup models.LocationRequest, city string, ctx context.Context) ([]redis.GeoLocation, float64, error) {
+	search := q.driverSearch
+	if search == nil {
+		search = legacyDriverSearch
+	}
+	var drivers []redis.GeoLocation
+	var radiusKm float64
+	for i, step := range search.stepsFor(city) {
+		if i > 0 && step.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, radiusKm, ctx.Err()
+			case <-time.After(step.Delay):
+			}
+		}
+		found, err := q.redisClient.GeoRadius(ctx, constants.DriverLocationKey, pickup.Longitude, pickup.Latitude, &redis.GeoRadiusQuery{
+			Radius:    step.RadiusKm,
+			Unit:      "km",
+			WithDist:  true,
+			WithCoord: true,
+			Count:     driverCandidateLimit,
+			Sort:      "ASC",
+		}).Result()
+		if err != nil {
+			return nil, radiusKm, err
+		}
+		drivers, radiusKm = found, step.RadiusKm
+		if len(drivers) >= search.minDrivers {
+			break
+		}
+	}
+	return drivers, radiusKm, nil
+}
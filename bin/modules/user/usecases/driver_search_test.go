@@ -0,0 +1,63 @@
+package usecases
+
+import (
+	"context"
+	"location-service/bin/modules/user/models"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseDriverSearchSteps(t *testing.T) {
+	steps, err := ParseDriverSearchSteps(DefaultDriverSearchSteps)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []DriverSearchStep{
+		{RadiusKm: 1},
+		{RadiusKm: 3, Delay: 2 * time.Second},
+		{RadiusKm: 5, Delay: 2 * time.Second},
+		{RadiusKm: 8, Delay: 2 * time.Second},
+	}, steps)
+
+	_, err = ParseDriverSearchSteps("3,1")
+	assert.Error(t, err)
+	_, err = ParseDriverSearchSteps("1:soon")
+	assert.Error(t, err)
+	_, err = ParseDriverSearchSteps("")
+	assert.Error(t, err)
+}
+
+func TestDriverSearch_StepsForCity(t *testing.T) {
+	limits, err := ParseDriverSearchCityLimits("Jakarta:4")
+	assert.NoError(t, err)
+	search := NewDriverSearch([]DriverSearchStep{{RadiusKm: 1}, {RadiusKm: 3}, {RadiusKm: 5}, {RadiusKm: 8}}, 3, limits)
+
+	assert.Equal(t, []DriverSearchStep{{RadiusKm: 1}, {RadiusKm: 3}, {RadiusKm: 4}}, search.stepsFor("jakarta"))
+	assert.Len(t, search.stepsFor("bogor"), 4)
+}
+
+func TestSearchDrivers_WidensUntilMinDrivers(t *testing.T) {
+	mockRedis := new(MockRedisClient)
+	search := NewDriverSearch([]DriverSearchStep{{RadiusKm: 1}, {RadiusKm: 3}, {RadiusKm: 5}}, 2, nil)
+	usecase := &queryUsecase{redisClient: mockRedis, driverSearch: search}
+	ctx := context.Background()
+	pickup := models.LocationRequest{Latitude: -6.2, Longitude: 106.8}
+
+	radius := func(km float64) interface{} {
+		return mock.MatchedBy(func(query *redis.GeoRadiusQuery) bool {
+			return query.Radius == km && query.Count == driverCandidateLimit
+		})
+	}
+	mockRedis.On("GeoRadius", ctx, "drivers-locations", pickup.Longitude, pickup.Latitude, radius(1)).Return(redis.NewGeoLocationCmdResult(nil, nil))
+	mockRedis.On("GeoRadius", ctx, "drivers-locations", pickup.Longitude, pickup.Latitude, radius(3)).Return(redis.NewGeoLocationCmdResult([]redis.GeoLocation{{Name: "driver1"}, {Name: "driver2"}}, nil))
+
+	drivers, radiusKm, err := usecase.searchDrivers(pickup, "", ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, drivers, 2)
+	assert.Equal(t, 3.0, radiusKm)
+	mockRedis.AssertNumberOfCalls(t, "GeoRadius", 2)
+}
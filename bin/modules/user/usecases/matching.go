@@ -0,0 +1,215 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	MatchingNearest = "nearest"
+	MatchingScored  = "scored"
+
+	// matchingShortlist is how many drivers a strategy returns
+	matchingShortlist = 5
+	// scoredMatchingCandidates is how many of the nearest drivers get a road ETA, the rest are too far to win
+	scoredMatchingCandidates = 10
+
+	// a driver without history is ranked as an average one
+	newDriverAcceptanceRate = 0.8
+	newDriverRating         = 4.5
+
+	// the scores saturate past these
+	scoredMatchingMaxEta  = 15 * time.Minute
+	scoredMatchingMaxIdle = 30 * time.Minute
+
+	// the fallback ETA of a driver the route provider could not route, straight line made road distance at city speed
+	matchingRoadFactor = 1.3
+	matchingSpeedKmh   = 20.0
+)
+
+// ScoredMatchingWeights weight the normalized criteria of the scored strategy, they add up to 1
+type ScoredMatchingWeights struct {
+	Eta        float64
+	Idle       float64
+	Acceptance float64
+	Rating     float64
+}
+
+var DefaultScoredMatchingWeights = ScoredMatchingWeights{
+	Eta:        0.5,
+	Idle:       0.15,
+	Acceptance: 0.2,
+	Rating:     0.15,
+}
+
+type nearestMatching struct{}
+
+// NewNearestMatching ranks by straight line distance, the behaviour before the scored strategy
+func NewNearestMatching() user.MatchingStrategy {
+	return nearestMatching{}
+}
+
+func (n nearestMatching) Name() string {
+	return MatchingNearest
+}
+
+func (n nearestMatching) Rank(pickup models.LocationRequest, candidates []models.DriverCandidate, ctx context.Context) ([]models.RankedDriver, error) {
+	ranked := make([]models.RankedDriver, 0, len(candidates))
+	for _, candidate := range candidates {
+		ranked = append(ranked, models.RankedDriver{
+			DriverId:   candidate.DriverId,
+			Location:   candidate.Location,
+			DistanceKm: candidate.DistanceKm,
+			Score:      -candidate.DistanceKm,
+		})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].DistanceKm < ranked[j].DistanceKm
+	})
+	if len(ranked) > matchingShortlist {
+		ranked = ranked[:matchingShortlist]
+	}
+	return ranked, nil
+}
+
+type scoredMatching struct {
+	routeProvider   user.RouteProvider
+	repositoryQuery user.MongodbRepositoryQuery
+	redisClient     redis.UniversalClient
+	weights         ScoredMatchingWeights
+}
+
+// NewScoredMatching ranks by road ETA to the pickup, idle time, acceptance rate and rating
+func NewScoredMatching(rp user.RouteProvider, mq user.MongodbRepositoryQuery, rc redis.UniversalClient, weights ScoredMatchingWeights) user.MatchingStrategy {
+	return &scoredMatching{
+		routeProvider:   rp,
+		repositoryQuery: mq,
+		redisClient:     rc,
+		weights:         weights,
+	}
+}
+
+func (s *scoredMatching) Name() string {
+	return MatchingScored
+}
+
+func (s *scoredMatching) Rank(pickup models.LocationRequest, candidates []models.DriverCandidate, ctx context.Context) ([]models.RankedDriver, error) {
+	candidates = append([]models.DriverCandidate(nil), candidates...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].DistanceKm < candidates[j].DistanceKm
+	})
+	if len(candidates) > scoredMatchingCandidates {
+		candidates = candidates[:scoredMatchingCandidates]
+	}
+	if len(candidates) == 0 {
+		return []models.RankedDriver{}, nil
+	}
+
+	driverIds := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		driverIds = append(driverIds, candidate.DriverId)
+	}
+	statsRes := <-s.repositoryQuery.FindDriverStats(ctx, driverIds)
+	if statsRes.Error != nil {
+		return nil, fmt.Errorf("find driver stats: %v", statsRes.Error)
+	}
+	stats := map[string]models.DriverStats{}
+	driverStats, _ := statsRes.Data.([]models.DriverStats)
+	for _, stat := range driverStats {
+		stats[stat.DriverId] = stat
+	}
+	availableSince, err := s.redisClient.ZMScore(ctx, constants.DriverAvailableSinceKey, driverIds...).Result()
+	if err != nil {
+		// idle time has a small weight, rank without it
+		log.GetLogger().Error("matching", fmt.Sprintf("Error get available since: %v", err), "Rank", utils.ConvertString(err))
+	}
+	if len(availableSince) != len(driverIds) {
+		availableSince = make([]float64, len(driverIds))
+	}
+	etas := s.etas(pickup, candidates, ctx)
+
+	now := time.Now()
+	ranked := make([]models.RankedDriver, 0, len(candidates))
+	for i, candidate := range candidates {
+		idle := time.Duration(0)
+		if availableSince[i] > 0 {
+			idle = now.Sub(time.Unix(int64(availableSince[i]), 0))
+		}
+		driver := models.RankedDriver{
+			DriverId:       candidate.DriverId,
+			Location:       candidate.Location,
+			DistanceKm:     candidate.DistanceKm,
+			EtaMinutes:     round2(etas[i].Minutes()),
+			IdleMinutes:    math.Max(0, math.Floor(idle.Minutes())),
+			AcceptanceRate: acceptanceRate(stats[candidate.DriverId]),
+			Rating:         driverRating(stats[candidate.DriverId]),
+		}
+		driver.Score = round2(s.score(etas[i], idle, driver.AcceptanceRate, driver.Rating))
+		ranked = append(ranked, driver)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	if len(ranked) > matchingShortlist {
+		ranked = ranked[:matchingShortlist]
+	}
+	return ranked, nil
+}
+
+// etas asks the route provider for every candidate at once, a failed route falls back to the straight line
+// distance at city speed
+func (s *scoredMatching) etas(pickup models.LocationRequest, candidates []models.DriverCandidate, ctx context.Context) []time.Duration {
+	etas := make([]time.Duration, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, candidate models.DriverCandidate) {
+			defer wg.Done()
+			etas[i] = time.Duration(candidate.DistanceKm * matchingRoadFactor / matchingSpeedKmh * float64(time.Hour))
+			routes, err := s.routeProvider.Routes(models.RouteRequest{
+				Origin:        candidate.Location,
+				Destination:   pickup,
+				DepartureTime: time.Now(),
+			}, ctx)
+			if err != nil || len(routes) == 0 {
+				return
+			}
+			etas[i] = time.Duration(routes[0].DurationSeconds * float64(time.Second))
+		}(i, candidate)
+	}
+	wg.Wait()
+	return etas
+}
+
+// score normalizes every criterion to 0..1, higher is better
+func (s *scoredMatching) score(eta time.Duration, idle time.Duration, acceptance float64, rating float64) float64 {
+	etaScore := 1 - math.Min(eta.Minutes(), scoredMatchingMaxEta.Minutes())/scoredMatchingMaxEta.Minutes()
+	idleScore := math.Min(math.Max(idle.Minutes(), 0), scoredMatchingMaxIdle.Minutes()) / scoredMatchingMaxIdle.Minutes()
+	ratingScore := math.Min(math.Max((rating-1)/4, 0), 1)
+	return s.weights.Eta*etaScore + s.weights.Idle*idleScore + s.weights.Acceptance*acceptance + s.weights.Rating*ratingScore
+}
+
+func acceptanceRate(stats models.DriverStats) float64 {
+	if stats.OffersReceived == 0 {
+		return newDriverAcceptanceRate
+	}
+	return round2(float64(stats.OffersAccepted) / float64(stats.OffersReceived))
+}
+
+func driverRating(stats models.DriverStats) float64 {
+	if stats.RatingCount == 0 {
+		return newDriverRating
+	}
+	return stats.Rating
+}
@@ -0,0 +1,107 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRouteProvider struct {
+	mock.Mock
+}
+
+func (m *MockRouteProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockRouteProvider) Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error) {
+	args := m.Called(request.Origin, ctx)
+	return args.Get(0).([]models.RouteOption), args.Error(1)
+}
+
+func (m *MockRedisClient) ZMScore(ctx context.Context, key string, members ...string) *redis.FloatSliceCmd {
+	args := m.Called(ctx, key, members)
+	return args.Get(0).(*redis.FloatSliceCmd)
+}
+
+func floatSliceResult(val []float64, err error) *redis.FloatSliceCmd {
+	cmd := redis.NewFloatSliceCmd(context.Background())
+	cmd.SetVal(val)
+	cmd.SetErr(err)
+	return cmd
+}
+
+func TestNearestMatching(t *testing.T) {
+	candidates := []models.DriverCandidate{
+		{DriverId: "far", DistanceKm: 2.5},
+		{DriverId: "near", DistanceKm: 0.4},
+	}
+
+	ranked, err := NewNearestMatching().Rank(models.LocationRequest{}, candidates, context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "near", ranked[0].DriverId)
+	assert.Equal(t, "far", ranked[1].DriverId)
+}
+
+func TestScoredMatching_PrefersShortEtaOverDistance(t *testing.T) {
+	mockRoute := new(MockRouteProvider)
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	matching := NewScoredMatching(mockRoute, mockQuery, mockRedis, DefaultScoredMatchingWeights)
+
+	ctx := context.Background()
+	pickup := models.LocationRequest{Latitude: -6.2, Longitude: 106.82}
+	// the nearest driver is across the river, the other one is down the road
+	acrossRiver := models.DriverCandidate{DriverId: "across", DistanceKm: 0.5, Location: models.LocationRequest{Latitude: -6.205, Longitude: 106.82}}
+	downTheRoad := models.DriverCandidate{DriverId: "road", DistanceKm: 1.2, Location: models.LocationRequest{Latitude: -6.2, Longitude: 106.831}}
+	mockRoute.On("Routes", acrossRiver.Location, ctx).Return([]models.RouteOption{{DurationSeconds: 720}}, nil)
+	mockRoute.On("Routes", downTheRoad.Location, ctx).Return([]models.RouteOption{{DurationSeconds: 180}}, nil)
+	mockQuery.On("FindDriverStats", ctx, []string{"across", "road"}).Return(utils.Result{Data: []models.DriverStats{
+		{DriverId: "road", Rating: 4.9, RatingCount: 120, OffersReceived: 100, OffersAccepted: 95},
+	}})
+	idleSince := float64(time.Now().Add(-10 * time.Minute).Unix())
+	mockRedis.On("ZMScore", ctx, constants.DriverAvailableSinceKey, []string{"across", "road"}).Return(floatSliceResult([]float64{0, idleSince}, nil))
+
+	ranked, err := matching.Rank(pickup, []models.DriverCandidate{downTheRoad, acrossRiver}, ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, ranked, 2)
+	assert.Equal(t, "road", ranked[0].DriverId)
+	assert.Equal(t, 3.0, ranked[0].EtaMinutes)
+	assert.Equal(t, 10.0, ranked[0].IdleMinutes)
+	assert.Equal(t, 0.95, ranked[0].AcceptanceRate)
+	// no history, ranked as an average driver
+	assert.Equal(t, newDriverAcceptanceRate, ranked[1].AcceptanceRate)
+	assert.Equal(t, newDriverRating, ranked[1].Rating)
+	assert.Greater(t, ranked[0].Score, ranked[1].Score)
+}
+
+func TestScoredMatching_RouteErrorUsesStraightLine(t *testing.T) {
+	mockRoute := new(MockRouteProvider)
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	matching := NewScoredMatching(mockRoute, mockQuery, mockRedis, DefaultScoredMatchingWeights)
+
+	ctx := context.Background()
+	candidate := models.DriverCandidate{DriverId: "driver1", DistanceKm: 1}
+	mockRoute.On("Routes", candidate.Location, ctx).Return([]models.RouteOption(nil), errors.New("no route"))
+	mockQuery.On("FindDriverStats", ctx, []string{"driver1"}).Return(utils.Result{})
+	mockRedis.On("ZMScore", ctx, constants.DriverAvailableSinceKey, []string{"driver1"}).Return(floatSliceResult(nil, errors.New("redis down")))
+
+	ranked, err := matching.Rank(models.LocationRequest{}, []models.DriverCandidate{candidate}, ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, ranked, 1)
+	assert.Equal(t, 3.9, ranked[0].EtaMinutes)
+	assert.Equal(t, 0.0, ranked[0].IdleMinutes)
+}
@@ -0,0 +1,234 @@
+package usecases
+
+import (
+	"location-service/bin/config"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// poolSearchRadiusKm is how far from the pickup drivers on a trip are considered for pooling
+	poolSearchRadiusKm = 5.0
+	// poolCandidateLimit is how many drivers on a trip are read around the pickup
+	poolCandidateLimit = 20
+	// poolRoadFactor turns straight line distances into road distances, the same as the offline route estimator
+	poolRoadFactor = 1.3
+	// poolSpeedKmh converts detour distances into time, a city average
+	poolSpeedKmh = 20.0
+	// defaultPoolMaxDetour caps the extra driving of a pool match when POOL_MAX_DETOUR is not set
+	defaultPoolMaxDetour = 10 * time.Minute
+)
+
+// poolCandidate is a driver on a pool trip with its current position
+type poolCandidate struct {
+	Trip       models.PoolTrip
+	Position   models.LocationRequest
+	DistanceKm float64
+}
+
+type poolLeg struct {
+	km     float64
+	others []string
+}
+
+func poolMaxDetour() time.Duration {
+	maxDetour := time.Duration(config.GetConfig().PoolMaxDetour) * time.Second
+	if maxDetour <= 0 {
+		return defaultPoolMaxDetour
+	}
+	return maxDetour
+}
+
+func poolRoadKm(from models.LocationRequest, to models.LocationRequest) float64 {
+	return utils.HaversineKm(from.Latitude, from.Longitude, to.Latitude, to.Longitude) * poolRoadFactor
+}
+
+// rankPoolMatches matches the rider into every candidate trip and sorts the matches by detour, then by distance
+// to the driver
+func rankPoolMatches(candidates []poolCandidate, riderId string, pickup models.LocationRequest, dropoff models.LocationRequest, fare models.FareBreakdown, maxDetour time.Duration) []models.PoolMatch {
+	matches := make([]models.PoolMatch, 0, len(candidates))
+	for _, candidate := range candidates {
+		match, ok := matchPoolTrip(candidate.Trip, candidate.Position, riderId, pickup, dropoff, fare, maxDetour)
+		if !ok {
+			continue
+		}
+		match.DistanceKm = candidate.DistanceKm
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].DetourMinutes != matches[j].DetourMinutes {
+			return matches[i].DetourMinutes < matches[j].DetourMinutes
+		}
+		return matches[i].DistanceKm < matches[j].DistanceKm
+	})
+	return matches
+}
+
+// matchPoolTrip finds where to insert the rider pickup and dropoff in the remaining stops of the trip with the
+// least extra driving. ok is false when no insertion has a free seat all along the ride or stays under the detour cap.
+func matchPoolTrip(trip models.PoolTrip, position models.LocationRequest, riderId string, pickup models.LocationRequest, dropoff models.LocationRequest, fare models.FareBreakdown, maxDetour time.Duration) (models.PoolMatch, bool) {
+	stops := trip.Stops
+	points := make([]models.LocationRequest, 0, len(stops)+1)
+	points = append(points, position)
+	for _, stop := range stops {
+		points = append(points, stop.Location)
+	}
+
+	// load[k] is the riders in the car when leaving points[k]
+	load := make([]int, len(points))
+	load[0] = len(poolRidersOnBoard(stops))
+	for k, stop := range stops {
+		load[k+1] = load[k] - 1
+		if stop.Kind == models.PoolStopPickup {
+			load[k+1] = load[k] + 1
+		}
+	}
+	legKm := func(k int) float64 {
+		if k >= len(stops) {
+			return 0
+		}
+		return poolRoadKm(points[k], points[k+1])
+	}
+	// insertKm is the extra distance of visiting at between points[k] and the point after it
+	insertKm := func(k int, at models.LocationRequest) float64 {
+		if k >= len(stops) {
+			return poolRoadKm(points[k], at)
+		}
+		return poolRoadKm(points[k], at) + poolRoadKm(at, points[k+1]) - legKm(k)
+	}
+
+	bestKm, pickupAt, dropoffAt := math.Inf(1), -1, -1
+	for i := range points {
+		for j := i; j < len(points); j++ {
+			if load[j]+1 > trip.Capacity {
+				// no free seat from here on, a later dropoff does not fit either
+				break
+			}
+			var addedKm float64
+			if i == j {
+				addedKm = poolRoadKm(points[i], pickup) + poolRoadKm(pickup, dropoff)
+				if i < len(stops) {
+					addedKm += poolRoadKm(dropoff, points[i+1]) - legKm(i)
+				}
+			} else {
+				addedKm = insertKm(i, pickup) + insertKm(j, dropoff)
+			}
+			if addedKm < bestKm {
+				bestKm, pickupAt, dropoffAt = addedKm, i, j
+			}
+		}
+	}
+	if pickupAt < 0 {
+		return models.PoolMatch{}, false
+	}
+	detourMinutes := bestKm / poolSpeedKmh * 60
+	if detourMinutes > maxDetour.Minutes() {
+		return models.PoolMatch{}, false
+	}
+
+	newStops := make([]models.PoolStop, 0, len(stops)+2)
+	newStops = append(newStops, stops[:pickupAt]...)
+	newStops = append(newStops, models.PoolStop{UserId: riderId, Kind: models.PoolStopPickup, Location: pickup})
+	newStops = append(newStops, stops[pickupAt:dropoffAt]...)
+	newStops = append(newStops, models.PoolStop{UserId: riderId, Kind: models.PoolStopDropoff, Location: dropoff})
+	newStops = append(newStops, stops[dropoffAt:]...)
+
+	match := models.PoolMatch{
+		DriverId:      trip.DriverId,
+		DetourKm:      round2(bestKm),
+		DetourMinutes: round2(detourMinutes),
+		Stops:         newStops,
+	}
+	splitPoolFare(&match, position, riderId, fare)
+	return match, true
+}
+
+// splitPoolFare prices the ride of the new rider on the matched stops. Every leg of the ride costs its share of the
+// trip fare, and a leg shared with k riders is split k+1 ways. The split lists what each rider pays of the shared legs.
+func splitPoolFare(match *models.PoolMatch, position models.LocationRequest, riderId string, fare models.FareBreakdown) {
+	onBoard := map[string]bool{}
+	for _, rider := range poolRidersOnBoard(match.Stops) {
+		onBoard[rider] = true
+	}
+
+	var legs []poolLeg
+	from := position
+	for _, stop := range match.Stops {
+		km := poolRoadKm(from, stop.Location)
+		if onBoard[riderId] {
+			others := make([]string, 0, len(onBoard))
+			for rider, inCar := range onBoard {
+				if inCar && rider != riderId {
+					others = append(others, rider)
+				}
+			}
+			sort.Strings(others)
+			legs = append(legs, poolLeg{km: km, others: others})
+			match.RideKm += km
+		}
+		onBoard[stop.UserId] = stop.Kind == models.PoolStopPickup
+		from = stop.Location
+	}
+
+	tripFare := fare.Total - fare.BookingFee
+	riderCost, sharedCost := 0.0, 0.0
+	shares := map[string]*models.PoolFareShare{}
+	var order []string
+	for _, leg := range legs {
+		legCost := 0.0
+		if match.RideKm > 0 {
+			legCost = tripFare * leg.km / match.RideKm
+		}
+		perRider := legCost / float64(len(leg.others)+1)
+		riderCost += perRider
+		if len(leg.others) == 0 {
+			continue
+		}
+		match.SharedKm += leg.km
+		sharedCost += perRider
+		for _, rider := range leg.others {
+			share, ok := shares[rider]
+			if !ok {
+				share = &models.PoolFareShare{UserId: rider}
+				shares[rider] = share
+				order = append(order, rider)
+			}
+			share.SharedKm += leg.km
+			share.Fare += perRider
+		}
+	}
+
+	match.RideKm = round2(match.RideKm)
+	match.SharedKm = round2(match.SharedKm)
+	match.Fare = math.Round(riderCost) + fare.BookingFee
+	match.FareSplit = []models.PoolFareShare{{UserId: riderId, SharedKm: match.SharedKm, Fare: math.Round(sharedCost)}}
+	for _, rider := range order {
+		share := shares[rider]
+		match.FareSplit = append(match.FareSplit, models.PoolFareShare{
+			UserId:   rider,
+			SharedKm: round2(share.SharedKm),
+			Fare:     math.Round(share.Fare),
+		})
+	}
+}
+
+// poolRidersOnBoard returns the riders with a dropoff before any pickup in stops, they are already in the car
+func poolRidersOnBoard(stops []models.PoolStop) []string {
+	var onBoard []string
+	pickedUp := map[string]bool{}
+	for _, stop := range stops {
+		if stop.Kind == models.PoolStopPickup {
+			pickedUp[stop.UserId] = true
+		} else if !pickedUp[stop.UserId] {
+			onBoard = append(onBoard, stop.UserId)
+		}
+	}
+	return onBoard
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
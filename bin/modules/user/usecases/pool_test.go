@@ -0,0 +1,98 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func poolPoint(longitude float64) models.LocationRequest {
+	return models.LocationRequest{Latitude: -6.2, Longitude: longitude}
+}
+
+func TestMatchPoolTrip_OnTheWay(t *testing.T) {
+	// rider A is on board to the east, the new rider goes the same way
+	trip := models.PoolTrip{
+		DriverId: "driver1",
+		Capacity: 3,
+		Stops:    []models.PoolStop{{UserId: "riderA", Kind: models.PoolStopDropoff, Location: poolPoint(106.90)}},
+	}
+	fare := models.FareBreakdown{Total: 30000, BookingFee: 2000}
+
+	match, ok := matchPoolTrip(trip, poolPoint(106.80), "rider1", poolPoint(106.82), poolPoint(106.86), fare, 10*time.Minute)
+
+	assert.True(t, ok)
+	assert.InDelta(t, 0, match.DetourMinutes, 0.01)
+	assert.Equal(t, []string{"pickup", "dropoff", "dropoff"}, []string{match.Stops[0].Kind, match.Stops[1].Kind, match.Stops[2].Kind})
+	assert.Equal(t, "riderA", match.Stops[2].UserId)
+	assert.Equal(t, match.RideKm, match.SharedKm)
+	// the whole ride is shared with rider A, so the trip fare is halved
+	assert.Equal(t, 16000.0, match.Fare)
+	assert.Len(t, match.FareSplit, 2)
+	assert.Equal(t, 14000.0, match.FareSplit[0].Fare)
+	assert.Equal(t, "riderA", match.FareSplit[1].UserId)
+	assert.Equal(t, 14000.0, match.FareSplit[1].Fare)
+}
+
+func TestMatchPoolTrip_NoFreeSeat(t *testing.T) {
+	trip := models.PoolTrip{
+		DriverId: "driver1",
+		Capacity: 1,
+		Stops:    []models.PoolStop{{UserId: "riderA", Kind: models.PoolStopDropoff, Location: poolPoint(106.90)}},
+	}
+
+	match, ok := matchPoolTrip(trip, poolPoint(106.80), "rider1", poolPoint(106.82), poolPoint(106.86), models.FareBreakdown{}, time.Hour)
+
+	// the only seat frees up once rider A is dropped off
+	assert.True(t, ok)
+	assert.Equal(t, "riderA", match.Stops[0].UserId)
+	assert.Equal(t, 0.0, match.SharedKm)
+
+	_, ok = matchPoolTrip(trip, poolPoint(106.80), "rider1", poolPoint(106.82), poolPoint(106.86), models.FareBreakdown{}, 10*time.Minute)
+	assert.False(t, ok)
+}
+
+func TestMatchPoolTrip_DetourCapped(t *testing.T) {
+	trip := models.PoolTrip{
+		DriverId: "driver1",
+		Capacity: 3,
+		Stops:    []models.PoolStop{{UserId: "riderA", Kind: models.PoolStopDropoff, Location: poolPoint(106.90)}},
+	}
+	// the new rider goes 10 km north of the route
+	dropoff := models.LocationRequest{Latitude: -6.11, Longitude: 106.86}
+
+	_, ok := matchPoolTrip(trip, poolPoint(106.80), "rider1", poolPoint(106.82), dropoff, models.FareBreakdown{}, 10*time.Minute)
+
+	assert.False(t, ok)
+}
+
+func TestRankPoolMatches(t *testing.T) {
+	onTheWay := models.PoolTrip{
+		DriverId: "driver1",
+		Capacity: 3,
+		Stops:    []models.PoolStop{{UserId: "riderA", Kind: models.PoolStopDropoff, Location: poolPoint(106.90)}},
+	}
+	// rider B still has to be picked up a bit off the rider route
+	offTheWay := models.PoolTrip{
+		DriverId: "driver2",
+		Capacity: 3,
+		Stops: []models.PoolStop{
+			{UserId: "riderB", Kind: models.PoolStopPickup, Location: models.LocationRequest{Latitude: -6.21, Longitude: 106.83}},
+			{UserId: "riderB", Kind: models.PoolStopDropoff, Location: poolPoint(106.90)},
+		},
+	}
+	candidates := []poolCandidate{
+		{Trip: offTheWay, Position: poolPoint(106.81), DistanceKm: 1},
+		{Trip: onTheWay, Position: poolPoint(106.80), DistanceKm: 2},
+	}
+
+	matches := rankPoolMatches(candidates, "rider1", poolPoint(106.82), poolPoint(106.86), models.FareBreakdown{Total: 20000}, 10*time.Minute)
+
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "driver1", matches[0].DriverId)
+	assert.Equal(t, 2.0, matches[0].DistanceKm)
+	assert.Less(t, matches[0].DetourMinutes, matches[1].DetourMinutes)
+}
@@ -0,0 +1,166 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+)
+
+// defaultFareRule keeps the historical flat 3000/km price when no rule matches
+var defaultFareRule = models.FareRule{
+	ServiceType: models.FareRuleAny,
+	City:        models.FareRuleAny,
+	PerKm:       3000,
+}
+
+type pricingEngine struct {
+	rules map[string]models.FareRule
+	areas []models.CityArea
+}
+
+func NewPricingEngine(rules []models.FareRule, areas []models.CityArea) user.PricingEngine {
+	engine := &pricingEngine{
+		rules: make(map[string]models.FareRule),
+		areas: areas,
+	}
+	for _, rule := range rules {
+		engine.rules[fareRuleKey(rule.ServiceType, rule.City)] = rule
+	}
+	return engine
+}
+
+// LoadFareRules reads the rules from the JSON file at path, or from Mongo when path is empty
+func LoadFareRules(path string, mq user.MongodbRepositoryQuery, ctx context.Context) ([]models.FareRule, error) {
+	var rules []models.FareRule
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read fare rules %s: %w", path, err)
+		}
+		if err := json.Unmarshal(content, &rules); err != nil {
+			return nil, fmt.Errorf("parse fare rules %s: %w", path, err)
+		}
+		return rules, nil
+	}
+
+	fareRules := <-mq.FindFareRules(ctx)
+	if fareRules.Error != nil {
+		return nil, fmt.Errorf("find fare rules: %v", fareRules.Error)
+	}
+	rules, _ = fareRules.Data.([]models.FareRule)
+	return rules, nil
+}
+
+// ParseCityAreas reads cities written as name:latitude:longitude:radiusKm separated by commas,
+// e.g. jakarta:-6.2088:106.8456:30,bogor:-6.5971:106.8060:15
+func ParseCityAreas(spec string) ([]models.CityArea, error) {
+	var areas []models.CityArea
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) != 4 || strings.TrimSpace(fields[0]) == "" {
+			return nil, fmt.Errorf("invalid city area %q", part)
+		}
+		var values [3]float64
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid city area %q", part)
+			}
+			values[i] = value
+		}
+		if values[2] <= 0 {
+			return nil, fmt.Errorf("invalid city area %q", part)
+		}
+		areas = append(areas, models.CityArea{
+			Name:      strings.ToLower(strings.TrimSpace(fields[0])),
+			Latitude:  values[0],
+			Longitude: values[1],
+			RadiusKm:  values[2],
+		})
+	}
+	return areas, nil
+}
+
+// City picks the closest city whose area covers the coordinates, overlapping areas go to the nearer center
+func (p *pricingEngine) City(latitude float64, longitude float64) string {
+	city := ""
+	closest := math.MaxFloat64
+	for _, area := range p.areas {
+		distance := utils.HaversineKm(area.Latitude, area.Longitude, latitude, longitude)
+		if distance <= area.RadiusKm && distance < closest {
+			city, closest = area.Name, distance
+		}
+	}
+	return city
+}
+
+// Quote prices a trip with the most specific rule: service and city, then service, then city, then any.
+// The surge multiplier applies to the trip fare, the booking fee is never surged.
+func (p *pricingEngine) Quote(serviceType string, city string, distanceKm float64, durationMinutes float64, stops int, surgeMultiplier float64) models.FareBreakdown {
+	rule := p.findRule(serviceType, city)
+
+	fare := models.FareBreakdown{
+		ServiceType:     serviceType,
+		City:            city,
+		DistanceKm:      distanceKm,
+		DurationMinutes: durationMinutes,
+		BaseFare:        rule.BaseFare,
+		DistanceFare:    math.Ceil(distanceKm * rule.PerKm),
+		TimeFare:        math.Ceil(durationMinutes * rule.PerMinute),
+		Stops:           stops,
+		StopFare:        float64(stops) * rule.PerStop,
+		BookingFee:      rule.BookingFee,
+		SurgeMultiplier: models.NoSurge,
+	}
+	tripFare := fare.BaseFare + fare.DistanceFare + fare.TimeFare + fare.StopFare
+	if tripFare < rule.MinimumFare {
+		fare.MinimumFareAdjust = rule.MinimumFare - tripFare
+		tripFare = rule.MinimumFare
+	}
+	if surgeMultiplier > models.NoSurge {
+		fare.SurgeMultiplier = surgeMultiplier
+		fare.SurgeFare = math.Ceil(tripFare*surgeMultiplier) - tripFare
+		tripFare += fare.SurgeFare
+	}
+	fare.Total = tripFare + fare.BookingFee
+	return fare
+}
+
+func (p *pricingEngine) findRule(serviceType string, city string) models.FareRule {
+	candidates := []string{
+		fareRuleKey(serviceType, city),
+		fareRuleKey(serviceType, models.FareRuleAny),
+		fareRuleKey(models.FareRuleAny, city),
+		fareRuleKey(models.FareRuleAny, models.FareRuleAny),
+	}
+	for _, key := range candidates {
+		if rule, ok := p.rules[key]; ok {
+			return rule
+		}
+	}
+	return defaultFareRule
+}
+
+func fareRuleKey(serviceType string, city string) string {
+	if serviceType == "" {
+		serviceType = models.FareRuleAny
+	}
+	// cities are matched like the city areas, whatever the case written in the rules
+	city = strings.ToLower(strings.TrimSpace(city))
+	if city == "" {
+		city = models.FareRuleAny
+	}
+	return serviceType + "|" + city
+}
@@ -0,0 +1,149 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFareRules = []models.FareRule{
+	{ServiceType: "bike", City: models.FareRuleAny, BaseFare: 2000, PerKm: 2500, PerMinute: 100, MinimumFare: 10000, BookingFee: 1000},
+	{ServiceType: "bike", City: "jakarta", BaseFare: 3000, PerKm: 3000, PerMinute: 200, MinimumFare: 12000, BookingFee: 2000},
+	{ServiceType: models.FareRuleAny, City: models.FareRuleAny, PerKm: 5000},
+}
+
+func TestPricingEngine_QuoteItemized(t *testing.T) {
+	engine := NewPricingEngine(testFareRules, nil)
+
+	fare := engine.Quote("bike", "jakarta", 10, 30, 0, models.NoSurge)
+
+	assert.Equal(t, 3000.0, fare.BaseFare)
+	assert.Equal(t, 30000.0, fare.DistanceFare)
+	assert.Equal(t, 6000.0, fare.TimeFare)
+	assert.Equal(t, 0.0, fare.MinimumFareAdjust)
+	assert.Equal(t, 2000.0, fare.BookingFee)
+	assert.Equal(t, 41000.0, fare.Total)
+}
+
+func TestPricingEngine_QuoteMinimumFare(t *testing.T) {
+	engine := NewPricingEngine(testFareRules, nil)
+
+	fare := engine.Quote("bike", "bandung", 1, 4, 0, models.NoSurge)
+
+	assert.Equal(t, 2000.0+2500.0+400.0, fare.BaseFare+fare.DistanceFare+fare.TimeFare)
+	assert.Equal(t, 10000.0-4900.0, fare.MinimumFareAdjust)
+	assert.Equal(t, 11000.0, fare.Total)
+}
+
+func TestPricingEngine_QuoteSurge(t *testing.T) {
+	engine := NewPricingEngine(testFareRules, nil)
+
+	fare := engine.Quote("bike", "jakarta", 10, 30, 0, 1.5)
+
+	assert.Equal(t, 1.5, fare.SurgeMultiplier)
+	assert.Equal(t, 19500.0, fare.SurgeFare)
+	// the booking fee stays out of the surge
+	assert.Equal(t, 39000.0+19500.0+2000.0, fare.Total)
+}
+
+func TestPricingEngine_QuoteStops(t *testing.T) {
+	engine := NewPricingEngine([]models.FareRule{{ServiceType: "car", City: models.FareRuleAny, PerKm: 4000, PerStop: 5000}}, nil)
+
+	fare := engine.Quote("car", "jakarta", 10, 30, 2, models.NoSurge)
+
+	assert.Equal(t, 10000.0, fare.StopFare)
+	assert.Equal(t, 50000.0, fare.Total)
+}
+
+func TestPriceLegs(t *testing.T) {
+	route := models.Route{
+		Origin:      models.LocationRequest{Address: "A"},
+		Stops:       []models.LocationRequest{{Address: "B"}},
+		Destination: models.LocationRequest{Address: "C"},
+	}
+	option := models.RouteOption{
+		DistanceMeters: 3000,
+		Legs:           []models.RouteOptionLeg{{DistanceMeters: 1000, DurationSeconds: 120}, {DistanceMeters: 2000, DurationSeconds: 240}},
+	}
+
+	legs := priceLegs(route, option, models.FareBreakdown{Total: 12001, BookingFee: 1000})
+
+	assert.Len(t, legs, 2)
+	assert.Equal(t, "B", legs[0].To.Address)
+	assert.Equal(t, 3667.0, legs[0].Fare)
+	assert.Equal(t, 7334.0, legs[1].Fare)
+	assert.Equal(t, 2.0, legs[1].DistanceKm)
+
+	// a provider without legs prices the whole trip as one leg
+	single := priceLegs(route, models.RouteOption{DistanceMeters: 3000}, models.FareBreakdown{Total: 12001, BookingFee: 1000})
+	assert.Len(t, single, 1)
+	assert.Equal(t, "C", single[0].To.Address)
+	assert.Equal(t, 11001.0, single[0].Fare)
+}
+
+func TestPricingEngine_QuoteFallbackRules(t *testing.T) {
+	engine := NewPricingEngine(testFareRules, nil)
+	assert.Equal(t, 10000.0, engine.Quote("car", "jakarta", 2, 10, 0, models.NoSurge).Total)
+
+	legacy := NewPricingEngine(nil, nil)
+	assert.Equal(t, 6000.0, legacy.Quote("bike", "", 2, 10, 0, models.NoSurge).Total)
+}
+
+func TestPricingEngine_City(t *testing.T) {
+	areas, err := ParseCityAreas("Jakarta:-6.2088:106.8456:30, bogor:-6.5971:106.8060:15")
+	assert.NoError(t, err)
+	engine := NewPricingEngine(testFareRules, areas)
+
+	assert.Equal(t, "jakarta", engine.City(-6.1754, 106.8272))
+	assert.Equal(t, "bogor", engine.City(-6.5950, 106.8166))
+	// Bandung is outside every area, the rules for any city apply
+	assert.Equal(t, "", engine.City(-6.9175, 107.6191))
+	// the Jakarta rule charges its own booking fee
+	assert.Equal(t, 2000.0, engine.Quote("bike", engine.City(-6.1754, 106.8272), 2, 10, 0, models.NoSurge).BookingFee)
+}
+
+func TestParseCityAreas(t *testing.T) {
+	areas, err := ParseCityAreas("")
+	assert.NoError(t, err)
+	assert.Empty(t, areas)
+
+	_, err = ParseCityAreas("jakarta:-6.2:106.8")
+	assert.Error(t, err)
+	_, err = ParseCityAreas("jakarta:-6.2:106.8:0")
+	assert.Error(t, err)
+	_, err = ParseCityAreas(":-6.2:106.8:10")
+	assert.Error(t, err)
+}
+
+func TestLoadFareRules_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fare-rules.json")
+	os.WriteFile(path, []byte(`[{"serviceType":"car","city":"*","baseFare":5000,"perKm":4000}]`), 0644)
+
+	rules, err := LoadFareRules(path, nil, context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, 4000.0, rules[0].PerKm)
+}
+
+func TestLoadFareRules_Mongo(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	ctx := context.Background()
+	mockQuery.On("FindFareRules", ctx).Return(utils.Result{Data: testFareRules})
+
+	rules, err := LoadFareRules("", mockQuery, ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, rules, len(testFareRules))
+
+	failing := new(MockMongodbRepositoryQuery)
+	failing.On("FindFareRules", ctx).Return(utils.Result{Error: errors.New("mongo down")})
+	_, err = LoadFareRules("", failing, ctx)
+	assert.Error(t, err)
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
 	"location-service/bin/modules/user"
 	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
 	httpError "location-service/bin/pkg/http-error"
-	kafkaPkgConfluent "location-service/bin/pkg/kafka/confluent"
+	"location-service/bin/pkg/outbox"
 
 	"location-service/bin/pkg/log"
 	"location-service/bin/pkg/utils"
@@ -17,21 +23,35 @@ import (
 )
 
 type queryUsecase struct {
-	userRepositoryQuery user.MongodbRepositoryQuery
-	redisClient         redis.UniversalClient
-	kafkaProducer       kafkaPkgConfluent.Producer
+	userRepositoryQuery   user.MongodbRepositoryQuery
+	userRepositoryCommand user.MongodbRepositoryCommand
+	redisClient           redis.UniversalClient
+	surgePricing          user.SurgePricing
+	placeProvider         user.PlaceProvider
+	matchingStrategy      user.MatchingStrategy
+	driverSearch          *DriverSearch
+	rides                 ride.UsecaseCommand
 }
 
 type Response struct {
 	Message string      `json:"message"`
 	Driver  interface{} `json:"driver"`
+	// RadiusKm is the search radius the drivers were found in, only set by FindDriver
+	RadiusKm float64 `json:"radiusKm,omitempty"`
+	// DispatchId is the dispatch offering the ride to the drivers, only set by FindDriver
+	DispatchId string `json:"dispatchId,omitempty"`
 }
 
-func NewQueryUsecase(mq user.MongodbRepositoryQuery, rh redis.UniversalClient, kp kafkaPkgConfluent.Producer) user.UsecaseQuery {
+func NewQueryUsecase(mq user.MongodbRepositoryQuery, mc user.MongodbRepositoryCommand, rh redis.UniversalClient, sp user.SurgePricing, pp user.PlaceProvider, ms user.MatchingStrategy, ds *DriverSearch, rides ride.UsecaseCommand) user.UsecaseQuery {
 	return &queryUsecase{
-		userRepositoryQuery: mq,
-		redisClient:         rh,
-		kafkaProducer:       kp,
+		userRepositoryQuery:   mq,
+		userRepositoryCommand: mc,
+		redisClient:           rh,
+		surgePricing:          sp,
+		placeProvider:         pp,
+		matchingStrategy:      ms,
+		driverSearch:          ds,
+		rides:                 rides,
 	}
 }
 
@@ -51,6 +71,40 @@ func (q queryUsecase) GetUser(userId string, ctx context.Context) utils.Result {
 }
 
 func (q *queryUsecase) FindDriver(userId string, ctx context.Context) utils.Result {
+	planRes := q.findTripPlan(userId, ctx)
+	if planRes.Error != nil {
+		return planRes
+	}
+	tripPlan := planRes.Data.(models.RouteSummary)
+	requestRes := q.requestRide(userId, tripPlan, ctx)
+	if requestRes.Error != nil {
+		return requestRes
+	}
+	search := requestRes.Data.(models.DriverSearchResult)
+	if search.DispatchId != "" {
+		// the quote is booked, asking again would search a second driver for the same ride
+		if err := q.redisClient.Del(ctx, fmt.Sprintf("USER:ROUTE:%s", userId)).Err(); err != nil {
+			log.GetLogger().Error("query_usecase", fmt.Sprintf("Error delete quote of rider %s: %v", userId, err), "FindDriver", utils.ConvertString(err))
+		}
+	}
+	posibleDriver := "No driver available. Don't worry, please try again later."
+	if len(search.Drivers) > 0 {
+		posibleDriver = fmt.Sprintf("Please sit back, there are %d drivers available within %g km, we will let you know", len(search.Drivers), search.RadiusKm)
+	}
+
+	var result utils.Result
+	result.Data = Response{
+		Message:    posibleDriver,
+		Driver:     search.Drivers,
+		RadiusKm:   search.RadiusKm,
+		DispatchId: search.DispatchId,
+	}
+
+	return result
+}
+
+// findTripPlan returns the last quote of the rider when the wallet can pay for it
+func (q *queryUsecase) findTripPlan(userId string, ctx context.Context) utils.Result {
 	var result utils.Result
 	key := fmt.Sprintf("USER:ROUTE:%s", userId)
 	var tripPlan models.RouteSummary
@@ -59,7 +113,7 @@ func (q *queryUsecase) FindDriver(userId string, ctx context.Context) utils.Resu
 		errObj := httpError.NewNotFound()
 		errObj.Message = fmt.Sprintf("Error get data from redis: %v", errRedis)
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "FindDriver", utils.ConvertString(errRedis))
+		log.GetLogger().Error("command_usecase", errObj.Message, "findTripPlan", utils.ConvertString(errRedis))
 		return result
 	}
 	err := json.Unmarshal([]byte(redisData), &tripPlan)
@@ -67,7 +121,14 @@ func (q *queryUsecase) FindDriver(userId string, ctx context.Context) utils.Resu
 		errObj := httpError.NewInternalServerError()
 		errObj.Message = fmt.Sprintf("Error unmarshal tripdata: %v", err)
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "FindDriver", utils.ConvertString(err))
+		log.GetLogger().Error("command_usecase", errObj.Message, "findTripPlan", utils.ConvertString(err))
+		return result
+	}
+	// a quote with a pickup time is for ScheduleRide, searching now would send a driver before the rider is ready
+	if tripPlan.PickupAt != nil {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = "This quote has a pickup time, please schedule the ride instead"
+		result.Error = errObj
 		return result
 	}
 	walletCheck := <-q.userRepositoryQuery.Findwallet(ctx, userId)
@@ -75,7 +136,7 @@ func (q *queryUsecase) FindDriver(userId string, ctx context.Context) utils.Resu
 		errObj := httpError.NewInternalServerError()
 		errObj.Message = fmt.Sprintf("Wallet not found: %v, Please create wallet first", err)
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "FindDriver", utils.ConvertString(err))
+		log.GetLogger().Error("command_usecase", errObj.Message, "findTripPlan", utils.ConvertString(err))
 		return result
 	}
 	wallet := walletCheck.Data.(models.Wallet)
@@ -83,40 +144,527 @@ func (q *queryUsecase) FindDriver(userId string, ctx context.Context) utils.Resu
 		errObj := httpError.NewBadRequest()
 		errObj.Message = "insufficient balance, please topup"
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "FindDriver", "")
+		log.GetLogger().Error("command_usecase", errObj.Message, "findTripPlan", "")
+		return result
+	}
+	result.Data = tripPlan
+	return result
+}
+
+// requestRide searches drivers around the pickup, widening the radius as configured. When there are any it hands
+// the shortlist of the matching strategy to a dispatch and emits request-ride, result.Data is the
+// models.DriverSearchResult. A rider runs one search at a time, it lasts until the dispatch ends. The ride only moves to
+// searching with its dispatch, a search without driver leaves the quote to be requested again.
+func (q *queryUsecase) requestRide(userId string, tripPlan models.RouteSummary, ctx context.Context) utils.Result {
+	var result utils.Result
+	searchKey := fmt.Sprintf(constants.RiderSearchKey, userId)
+	started, err := q.redisClient.SetNX(ctx, searchKey, "searching", riderSearchLockTTL).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Failed to request ride, please try again"
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "requestRide", utils.ConvertString(err))
+		return result
+	}
+	if !started {
+		errObj := httpError.NewConflict()
+		errObj.Message = "You are already looking for a driver, please wait for the current search"
+		result.Error = errObj
+		return result
+	}
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			q.redisClient.Del(ctx, searchKey)
+		}
+	}()
+
+	// every search counts as demand, a zone without drivers is where the surge matters most
+	zone := q.surgePricing.Zone(tripPlan.Route.Origin.Latitude, tripPlan.Route.Origin.Longitude)
+	if err := q.surgePricing.RecordDemand(zone, userId, ctx); err != nil {
+		log.GetLogger().Error("command_usecase", fmt.Sprintf("Error record demand of zone %s: %v", zone, err), "requestRide", utils.ConvertString(err))
+	}
+	drivers, radiusKm, err := q.searchDrivers(tripPlan.Route.Origin, tripPlan.Fare.City, ctx)
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error searching drivers: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("command_usecase", errObj.Message, "requestRide", utils.ConvertString(err))
+		return result
+	}
+	shortlist := q.rankDrivers(tripPlan.Route.Origin, drivers, ctx)
+	var dispatchId string
+	if len(shortlist) > 0 {
+		dispatch := newDispatch(userId, tripPlan.RideId, shortlist, time.Now())
+		kafkaData := models.RequestRide{
+			UserId:         userId,
+			RouteSummary:   tripPlan,
+			Stops:          tripPlan.Route.Points(),
+			Drivers:        shortlist,
+			SearchRadiusKm: radiusKm,
+			DispatchId:     dispatch.ID.Hex(),
+		}
+		marshaledData, _ := json.Marshal(kafkaData)
+		log.GetLogger().Info("command_usecase", "marshaled", "kafkaProducer", utils.ConvertString(marshaledData))
+		dispatch.Request = string(marshaledData)
+		moveRes := moveRide(q.rides, tripPlan.RideId, rideModels.Transition{
+			Status:  rideModels.StatusSearching,
+			From:    rideModels.StatusQuoted,
+			Actor:   rideModels.ActorRider,
+			ActorId: userId,
+		}, "requestRide", ctx)
+		if _, conflict := moveRes.Error.(httpError.ConflictData); conflict {
+			errObj := httpError.NewConflict()
+			errObj.Message = "This ride is no longer waiting for a driver, please request a new quote"
+			result.Error = errObj
+			return result
+		}
+		if moveRes.Error != nil {
+			errObj := httpError.NewInternalServerError()
+			errObj.Message = "Failed to request ride, please try again"
+			result.Error = errObj
+			return result
+		}
+		dispatchRes := <-q.userRepositoryCommand.InsertDispatch(dispatch, ctx)
+		if dispatchRes.Error != nil {
+			errObj := httpError.NewInternalServerError()
+			errObj.Message = "Failed to request ride, please try again"
+			result.Error = errObj
+			log.GetLogger().Error("command_usecase", errObj.Message, "requestRide", utils.ConvertString(dispatchRes.Error))
+			return result
+		}
+		dispatchId = dispatch.ID.Hex()
+		dispatched = true
+		if err := q.redisClient.Set(ctx, searchKey, dispatchId, dispatchLifetime(dispatch)+riderSearchGrace).Err(); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Error set search of rider %s: %v", userId, err), "requestRide", utils.ConvertString(err))
+		}
+		pickup, _ := json.Marshal(tripPlan.Route.Origin)
+		if err := q.redisClient.Set(ctx, fmt.Sprintf(constants.TripPickupKey, userId), pickup, tripPickupTTL).Err(); err != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Error set pickup of rider %s: %v", userId, err), "requestRide", utils.ConvertString(err))
+		}
+		// keyed by rider so every event of a rider lands on the same partition, in order. The dispatch already carries
+		// the request its drivers are offered, so a lost event only costs the demand count and must not fail a live ride
+		outboxRes := <-q.userRepositoryCommand.InsertOutbox(outbox.NewEvent("request-ride", userId, marshaledData), ctx)
+		if outboxRes.Error != nil {
+			log.GetLogger().Error("command_usecase", fmt.Sprintf("Error emit request-ride of dispatch %s", dispatchId), "requestRide", utils.ConvertString(outboxRes.Error))
+		}
+	}
+	result.Data = models.DriverSearchResult{
+		RadiusKm:   radiusKm,
+		Drivers:    shortlist,
+		DispatchId: dispatchId,
+	}
+
+	return result
+}
+
+// rankDrivers shortlists the drivers with the configured strategy, a failing strategy falls back to the nearest drivers
+// so the rider still gets a ride
+func (q *queryUsecase) rankDrivers(pickup models.LocationRequest, drivers []redis.GeoLocation, ctx context.Context) []models.RankedDriver {
+	candidates := make([]models.DriverCandidate, 0, len(drivers))
+	for _, driver := range drivers {
+		candidates = append(candidates, models.DriverCandidate{
+			DriverId:   driver.Name,
+			Location:   models.LocationRequest{Latitude: driver.Latitude, Longitude: driver.Longitude},
+			DistanceKm: driver.Dist,
+		})
+	}
+	shortlist, err := q.matchingStrategy.Rank(pickup, candidates, ctx)
+	if err != nil {
+		log.GetLogger().Error("query_usecase", fmt.Sprintf("Error rank drivers with %s: %v", q.matchingStrategy.Name(), err), "rankDrivers", utils.ConvertString(err))
+		shortlist, _ = NewNearestMatching().Rank(pickup, candidates, ctx)
+	}
+	return shortlist
+}
+
+func (q *queryUsecase) GetTripDriver(userId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	driverId, errRedis := q.redisClient.Get(ctx, fmt.Sprintf(constants.TripDriverKey, userId)).Result()
+	if errRedis != nil || driverId == "" {
+		errObj := httpError.NewNotFound()
+		errObj.Message = "No driver assigned to your trip yet"
+		result.Error = errObj
 		return result
 	}
-	radius := 3.0
-	drivers, err := q.redisClient.GeoRadius(ctx, "drivers-locations", tripPlan.Route.Origin.Longitude, tripPlan.Route.Origin.Latitude, &redis.GeoRadiusQuery{
-		Radius:    radius,
+
+	tracking := models.TripTracking{
+		DriverID: driverId,
+	}
+	var pickup models.LocationRequest
+	redisData, errRedis := q.redisClient.Get(ctx, fmt.Sprintf(constants.TripPickupKey, userId)).Result()
+	if errRedis == nil && json.Unmarshal([]byte(redisData), &pickup) == nil {
+		tracking.Pickup = &pickup
+	}
+
+	result.Data = tracking
+	return result
+}
+
+func (q *queryUsecase) GetSurge(zone string, ctx context.Context) utils.Result {
+	var result utils.Result
+	if !validSurgeZone(zone) {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = fmt.Sprintf("Invalid zone %s, expected a geohash of %d characters", zone, models.SurgeZonePrecision)
+		result.Error = errObj
+		return result
+	}
+
+	state, err := q.surgePricing.Multiplier(zone, ctx)
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error get surge of zone %s: %v", zone, err)
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetSurge", utils.ConvertString(err))
+		return result
+	}
+	result.Data = state
+	return result
+}
+
+func (q *queryUsecase) GetRouteCacheStats(ctx context.Context) utils.Result {
+	var result utils.Result
+	counters, err := q.redisClient.HGetAll(ctx, constants.RouteCacheStatsKey).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = fmt.Sprintf("Error get route cache stats: %v", err)
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetRouteCacheStats", utils.ConvertString(err))
+		return result
+	}
+
+	var stats models.RouteCacheStats
+	stats.Hits, _ = strconv.ParseInt(counters["hits"], 10, 64)
+	stats.Misses, _ = strconv.ParseInt(counters["misses"], 10, 64)
+	stats.Bypassed, _ = strconv.ParseInt(counters["bypassed"], 10, 64)
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	result.Data = stats
+	return result
+}
+
+func (q *queryUsecase) AutocompletePlaces(payload models.PlaceAutocompleteRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	suggestions, err := q.placeProvider.Autocomplete(models.Location{
+		Keyword:   payload.Query,
+		Latitude:  payload.Latitude,
+		Longitude: payload.Longitude,
+	}, ctx)
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Place search is unavailable, please try again"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "AutocompletePlaces", utils.ConvertString(err.Error()))
+		return result
+	}
+	result.Data = suggestions
+	return result
+}
+
+func (q *queryUsecase) ReverseGeocode(payload models.ReverseGeocodeRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	suggestions, err := q.placeProvider.Reverse(models.Location{
+		Latitude:  payload.Latitude,
+		Longitude: payload.Longitude,
+	}, ctx)
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Place search is unavailable, please try again"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "ReverseGeocode", utils.ConvertString(err.Error()))
+		return result
+	}
+	result.Data = suggestions
+	return result
+}
+
+func (q *queryUsecase) GetSavedPlaces(userId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	placesRes := <-q.userRepositoryQuery.FindSavedPlaces(ctx, userId)
+	if placesRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find saved places"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetSavedPlaces", utils.ConvertString(placesRes.Error))
+		return result
+	}
+	places, _ := placesRes.Data.([]models.SavedPlace)
+	if places == nil {
+		places = []models.SavedPlace{}
+	}
+	result.Data = places
+	return result
+}
+
+func (q *queryUsecase) GetRecentDestinations(userId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	recentsRes := <-q.userRepositoryQuery.FindRecentDestinations(ctx, userId, recentDestinationScan)
+	if recentsRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find recent destinations"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetRecentDestinations", utils.ConvertString(recentsRes.Error))
+		return result
+	}
+	recents, _ := recentsRes.Data.([]models.RecentDestination)
+	result.Data = dedupeRecentDestinations(recents, recentDestinationLimit)
+	return result
+}
+
+func (q *queryUsecase) GetScheduledRides(userId string, ctx context.Context) utils.Result {
+	var result utils.Result
+	ridesRes := <-q.userRepositoryQuery.FindScheduledRides(ctx, userId)
+	if ridesRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find scheduled rides"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "GetScheduledRides", utils.ConvertString(ridesRes.Error))
+		return result
+	}
+	rides, _ := ridesRes.Data.([]models.ScheduledRide)
+	if rides == nil {
+		rides = []models.ScheduledRide{}
+	}
+	result.Data = rides
+	return result
+}
+
+// DispatchScheduledRides starts the driver search of the rides due for dispatch, result.Data is the rides
+// attempted with their new status. A ride is claimed before the search so a cancellation can not slip in
+// after the request-ride event.
+func (q *queryUsecase) DispatchScheduledRides(ctx context.Context) utils.Result {
+	var result utils.Result
+	now := time.Now()
+	// a ride claimed by an instance that died mid-dispatch would stay dispatching forever
+	requeueRes := <-q.userRepositoryCommand.RequeueStaleScheduledRides(now.Add(-scheduledRideStaleAfter), now, ctx)
+	if requeueRes.Error != nil {
+		log.GetLogger().Error("query_usecase", "Error requeue stale scheduled rides", "DispatchScheduledRides", utils.ConvertString(requeueRes.Error))
+	}
+	dueRes := <-q.userRepositoryQuery.FindDueScheduledRides(ctx, now, scheduledRideBatch)
+	if dueRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error find due scheduled rides"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "DispatchScheduledRides", utils.ConvertString(dueRes.Error))
+		return result
+	}
+	dueRides, _ := dueRes.Data.([]models.ScheduledRide)
+
+	// every driver search may wait between its steps, the rides of a tick are searched side by side
+	outcomes := make([]bool, len(dueRides))
+	slots := make(chan struct{}, scheduledRideConcurrency)
+	var wg sync.WaitGroup
+	for i := range dueRides {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			outcomes[i] = q.dispatchScheduledRide(&dueRides[i], ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	attempted := make([]models.ScheduledRide, 0, len(dueRides))
+	for i, ride := range dueRides {
+		if outcomes[i] {
+			attempted = append(attempted, ride)
+		}
+	}
+	result.Data = attempted
+	return result
+}
+
+// dispatchScheduledRide claims the ride and requests it, it returns false when the ride was not claimed
+func (q *queryUsecase) dispatchScheduledRide(ride *models.ScheduledRide, ctx context.Context) bool {
+	ride.Status = models.ScheduledRideDispatching
+	ride.UpdatedAt = time.Now()
+	claimRes := <-q.userRepositoryCommand.UpdateScheduledRide(*ride, models.ScheduledRideScheduled, ctx)
+	if claimRes.Error != nil {
+		log.GetLogger().Error("query_usecase", fmt.Sprintf("Error claim scheduled ride %s", ride.ID.Hex()), "DispatchScheduledRides", utils.ConvertString(claimRes.Error))
+		return false
+	}
+	// cancelled by the rider or claimed by another instance
+	if claimed, _ := claimRes.Data.(bool); !claimed {
+		return false
+	}
+
+	dispatched := false
+	requestRes := q.requestRide(ride.UserId, ride.RouteSummary, ctx)
+	if requestRes.Error != nil {
+		ride.LastError = "driver search failed"
+	} else if search, _ := requestRes.Data.(models.DriverSearchResult); len(search.Drivers) == 0 {
+		ride.LastError = "no driver available"
+	} else {
+		dispatched = true
+		ride.LastError = ""
+	}
+
+	now := time.Now()
+	ride.Status = nextScheduledRideStatus(*ride, dispatched, now)
+	ride.UpdatedAt = now
+	if dispatched {
+		ride.DispatchedAt = &now
+	}
+	updateRes := <-q.userRepositoryCommand.UpdateScheduledRide(*ride, models.ScheduledRideDispatching, ctx)
+	if updateRes.Error != nil {
+		log.GetLogger().Error("query_usecase", fmt.Sprintf("Error update scheduled ride %s to %s", ride.ID.Hex(), ride.Status), "DispatchScheduledRides", utils.ConvertString(updateRes.Error))
+	}
+	if ride.Status == models.ScheduledRideFailed {
+		// no search of the ride was dispatched, it is still quoted
+		moveRide(q.rides, ride.RouteSummary.RideId, rideModels.Transition{
+			Status: rideModels.StatusCancelled,
+			From:   rideModels.StatusQuoted,
+			Actor:  rideModels.ActorSystem,
+			Reason: ride.LastError,
+		}, "DispatchScheduledRides", ctx)
+	}
+	return true
+}
+
+// FindPool matches the rider into a trip of a driver with free seats going the same way, the best match is sent
+// to the driver service as a request-pool-ride event. It shares the one search at a time of a rider with requestRide.
+func (q *queryUsecase) FindPool(userId string, ctx context.Context) utils.Result {
+	planRes := q.findTripPlan(userId, ctx)
+	if planRes.Error != nil {
+		return planRes
+	}
+	var result utils.Result
+	tripPlan := planRes.Data.(models.RouteSummary)
+	if len(tripPlan.Route.Stops) > 0 {
+		errObj := httpError.NewBadRequest()
+		errObj.Message = "Pool rides can not have stops, please request a quote without stops"
+		result.Error = errObj
+		return result
+	}
+	searchKey := fmt.Sprintf(constants.RiderSearchKey, userId)
+	started, err := q.redisClient.SetNX(ctx, searchKey, "searching", riderSearchLockTTL).Result()
+	if err != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Failed to request pool ride, please try again"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "FindPool", utils.ConvertString(err))
+		return result
+	}
+	if !started {
+		errObj := httpError.NewConflict()
+		errObj.Message = "You are already looking for a driver, please wait for the current search"
+		result.Error = errObj
+		return result
+	}
+	requested := false
+	defer func() {
+		if !requested {
+			q.redisClient.Del(ctx, searchKey)
+		}
+	}()
+
+	origin := tripPlan.Route.Origin
+	zone := q.surgePricing.Zone(origin.Latitude, origin.Longitude)
+	if err := q.surgePricing.RecordDemand(zone, userId, ctx); err != nil {
+		log.GetLogger().Error("query_usecase", fmt.Sprintf("Error record demand of zone %s: %v", zone, err), "FindPool", utils.ConvertString(err))
+	}
+	drivers, err := q.redisClient.GeoRadius(ctx, constants.DriverOnTripLocationKey, origin.Longitude, origin.Latitude, &redis.GeoRadiusQuery{
+		Radius:    poolSearchRadiusKm,
 		Unit:      "km",
 		WithDist:  true,
 		WithCoord: true,
+		Count:     poolCandidateLimit,
 		Sort:      "ASC",
 	}).Result()
-
 	if err != nil {
 		errObj := httpError.NewInternalServerError()
 		errObj.Message = fmt.Sprintf("Error searching drivers: %v", err)
 		result.Error = errObj
-		log.GetLogger().Error("command_usecase", errObj.Message, "FindDriver", utils.ConvertString(err))
+		log.GetLogger().Error("query_usecase", errObj.Message, "FindPool", utils.ConvertString(err))
 		return result
 	}
-	posibleDriver := "No driver available. Don't worry, please try again later."
-	if len(drivers) > 0 {
-		kafkaData := models.RequestRide{
-			UserId:       userId,
-			RouteSummary: tripPlan,
+
+	candidates := make([]poolCandidate, 0, len(drivers))
+	for _, driver := range drivers {
+		// a driver on a trip is only a candidate once the driver app opened the trip to pooling
+		poolTripData, err := q.redisClient.Get(ctx, fmt.Sprintf(constants.PoolTripKey, driver.Name)).Result()
+		if err != nil {
+			continue
 		}
-		marshaledData, _ := json.Marshal(kafkaData)
-		log.GetLogger().Info("command_usecase", "marshaled", "kafkaProducer", utils.ConvertString(marshaledData))
-		q.kafkaProducer.Publish("request-ride", marshaledData)
-		posibleDriver = fmt.Sprintf("Please sit back, there are %d drivers available, we will let you know", len(drivers))
+		var poolTrip models.PoolTrip
+		if err := json.Unmarshal([]byte(poolTripData), &poolTrip); err != nil {
+			log.GetLogger().Error("query_usecase", fmt.Sprintf("Error unmarshal pool trip of driver %s", driver.Name), "FindPool", utils.ConvertString(err))
+			continue
+		}
+		candidates = append(candidates, poolCandidate{
+			Trip:       poolTrip,
+			Position:   models.LocationRequest{Latitude: driver.Latitude, Longitude: driver.Longitude},
+			DistanceKm: driver.Dist,
+		})
+	}
+
+	matches := rankPoolMatches(candidates, userId, origin, tripPlan.Route.Destination, tripPlan.Fare, poolMaxDetour())
+	if len(matches) == 0 {
+		result.Data = Response{
+			Message: "No pool ride available right now, please try a regular ride.",
+			Driver:  matches,
+		}
+		return result
+	}
+
+	marshaledData, _ := json.Marshal(models.PoolRideRequest{
+		UserId:       userId,
+		DriverId:     matches[0].DriverId,
+		RouteSummary: tripPlan,
+		Match:        matches[0],
+	})
+	outboxRes := <-q.userRepositoryCommand.InsertOutbox(outbox.NewEvent("request-pool-ride", userId, marshaledData), ctx)
+	if outboxRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Failed to request pool ride, please try again"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "FindPool", utils.ConvertString(outboxRes.Error))
+		return result
+	}
+	// no dispatch ends a pool search, it only lasts long enough to absorb a repeated request
+	requested = true
+	if err := q.redisClient.Set(ctx, searchKey, "pool", riderSearchGrace).Err(); err != nil {
+		log.GetLogger().Error("query_usecase", fmt.Sprintf("Error set search of rider %s: %v", userId, err), "FindPool", utils.ConvertString(err))
 	}
 	result.Data = Response{
-		Message: posibleDriver,
-		Driver:  drivers,
+		Message: fmt.Sprintf("Please sit back, a driver %.1f km away can take you for %.0f", matches[0].DistanceKm, matches[0].Fare),
+		Driver:  matches,
+	}
+	return result
+}
+
+// SearchCommuteOffers finds the commutes published by drivers that pass near the rider origin and then near the
+// destination, around the time the rider wants to leave
+func (q *queryUsecase) SearchCommuteOffers(payload models.CommuteSearchRequest, ctx context.Context) utils.Result {
+	var result utils.Result
+	now := time.Now()
+	departAt := payload.DepartAt
+	if departAt.IsZero() {
+		departAt = now
+	}
+	seats := payload.Seats
+	if seats == 0 {
+		seats = 1
+	}
+	from := departAt.Add(-commuteWindowSlack)
+	if from.Before(now) {
+		from = now
+	}
+
+	origin := models.LocationRequest{Latitude: payload.OriginLatitude, Longitude: payload.OriginLongitude}
+	destination := models.LocationRequest{Latitude: payload.DestinationLatitude, Longitude: payload.DestinationLongitude}
+	offersRes := <-q.userRepositoryQuery.FindCommuteOffersNear(ctx, models.NewGeoJSONPoint(origin.Latitude, origin.Longitude),
+		commuteMatchRadiusKm*1000, from, departAt.Add(commuteWindowSlack), seats, commuteCandidateLimit)
+	if offersRes.Error != nil {
+		errObj := httpError.NewInternalServerError()
+		errObj.Message = "Error search commute offers"
+		result.Error = errObj
+		log.GetLogger().Error("query_usecase", errObj.Message, "SearchCommuteOffers", utils.ConvertString(offersRes.Error))
+		return result
 	}
+	offers, _ := offersRes.Data.([]models.CommuteOffer)
 
+	result.Data = rankCommuteOffers(offers, origin, destination)
 	return result
 }
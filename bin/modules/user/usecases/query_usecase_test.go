@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
 	"location-service/bin/modules/user/models"
 	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -23,10 +27,24 @@ type MockRedisClient struct {
 	redis.UniversalClient
 }
 
-type MockKafkaProducer struct {
+type MockMongodbRepositoryCommand struct {
 	mock.Mock
 }
 
+type MockSurgePricing struct {
+	mock.Mock
+}
+
+type MockRideUsecase struct {
+	mock.Mock
+	ride.UsecaseCommand
+}
+
+func (m *MockRideUsecase) Transition(rideId string, payload rideModels.Transition, ctx context.Context) utils.Result {
+	args := m.Called(rideId, payload, ctx)
+	return args.Get(0).(utils.Result)
+}
+
 func (m *MockMongodbRepositoryQuery) FindOne(id string, ctx context.Context) <-chan utils.Result {
 	args := m.Called(id, ctx)
 	resultChan := make(chan utils.Result, 1)
@@ -41,27 +59,205 @@ func (m *MockMongodbRepositoryQuery) Findwallet(ctx context.Context, id string)
 	return resultChan
 }
 
+func (m *MockMongodbRepositoryQuery) FindFareRules(ctx context.Context) <-chan utils.Result {
+	args := m.Called(ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) SearchPlaces(ctx context.Context, keyword string, near *models.GeoJSONPoint, limit int64) <-chan utils.Result {
+	args := m.Called(ctx, keyword, near, limit)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindPlacesNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, limit int64) <-chan utils.Result {
+	args := m.Called(ctx, near, maxDistanceMeters, limit)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindSavedPlaces(ctx context.Context, userId string) <-chan utils.Result {
+	args := m.Called(ctx, userId)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindRecentDestinations(ctx context.Context, userId string, limit int64) <-chan utils.Result {
+	args := m.Called(ctx, userId, limit)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindScheduledRides(ctx context.Context, userId string) <-chan utils.Result {
+	args := m.Called(ctx, userId)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindScheduledRide(ctx context.Context, userId string, rideId string) <-chan utils.Result {
+	args := m.Called(ctx, userId, rideId)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindDueScheduledRides(ctx context.Context, now time.Time, limit int64) <-chan utils.Result {
+	args := m.Called(ctx, now, limit)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindCommuteOffersNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, from time.Time, until time.Time, seats int, limit int64) <-chan utils.Result {
+	args := m.Called(ctx, near, maxDistanceMeters, from, until, seats, limit)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryQuery) FindDriverStats(ctx context.Context, driverIds []string) <-chan utils.Result {
+	args := m.Called(ctx, driverIds)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
 func (m *MockRedisClient) Get(ctx context.Context, key string) *redis.StringCmd {
 	args := m.Called(ctx, key)
 	return args.Get(0).(*redis.StringCmd)
 }
 
+func (m *MockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	args := m.Called(ctx, key, value, expiration)
+	return args.Get(0).(*redis.BoolCmd)
+}
+
+func (m *MockRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	args := m.Called(ctx, key, value, expiration)
+	return args.Get(0).(*redis.StatusCmd)
+}
+
+func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	args := m.Called(ctx, keys)
+	return args.Get(0).(*redis.IntCmd)
+}
+
 func (m *MockRedisClient) GeoRadius(ctx context.Context, key string, longitude, latitude float64, query *redis.GeoRadiusQuery) *redis.GeoLocationCmd {
 	args := m.Called(ctx, key, longitude, latitude, query)
 	return args.Get(0).(*redis.GeoLocationCmd)
 }
 
-func (m *MockKafkaProducer) Publish(topic string, message []byte) {
-	m.Called(topic, message)
+func (m *MockMongodbRepositoryCommand) NewObjectID(ctx context.Context) string {
+	return m.Called(ctx).String(0)
+}
+
+func (m *MockMongodbRepositoryCommand) InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result {
+	args := m.Called(event, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockSurgePricing) Zone(latitude float64, longitude float64) string {
+	return m.Called(latitude, longitude).String(0)
+}
+
+func (m *MockSurgePricing) RecordDemand(zone string, riderId string, ctx context.Context) error {
+	return m.Called(zone, riderId, ctx).Error(0)
+}
+
+func (m *MockSurgePricing) Multiplier(zone string, ctx context.Context) (models.SurgeState, error) {
+	args := m.Called(zone, ctx)
+	return args.Get(0).(models.SurgeState), args.Error(1)
+}
+
+func (m *MockSurgePricing) Override(zone string, multiplier float64, ttl time.Duration, ctx context.Context) (models.SurgeState, error) {
+	args := m.Called(zone, multiplier, ttl, ctx)
+	return args.Get(0).(models.SurgeState), args.Error(1)
+}
+
+func (m *MockSurgePricing) ClearOverride(zone string, ctx context.Context) error {
+	return m.Called(zone, ctx).Error(0)
+}
+
+func (m *MockMongodbRepositoryCommand) InsertSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result {
+	args := m.Called(place, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) UpdateSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result {
+	args := m.Called(place, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) DeleteSavedPlace(userId string, placeId string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(userId, placeId, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) UpsertRecentDestination(recent models.RecentDestination, ctx context.Context) <-chan utils.Result {
+	args := m.Called(recent, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) InsertScheduledRide(ride models.ScheduledRide, ctx context.Context) <-chan utils.Result {
+	args := m.Called(ride, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) InsertDispatch(dispatch models.Dispatch, ctx context.Context) <-chan utils.Result {
+	args := m.Called(dispatch, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) UpdateScheduledRide(ride models.ScheduledRide, fromStatus string, ctx context.Context) <-chan utils.Result {
+	args := m.Called(ride, fromStatus, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) RequeueStaleScheduledRides(staleBefore time.Time, now time.Time, ctx context.Context) <-chan utils.Result {
+	args := m.Called(staleBefore, now, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
+}
+
+func (m *MockMongodbRepositoryCommand) ChargeWallet(userId string, transaction models.TransactionLog, ctx context.Context) <-chan utils.Result {
+	args := m.Called(userId, transaction, ctx)
+	resultChan := make(chan utils.Result, 1)
+	resultChan <- args.Get(0).(utils.Result)
+	return resultChan
 }
 
 // GetUser tests
 func TestGetUser_Success(t *testing.T) {
 	mockQuery := new(MockMongodbRepositoryQuery)
 	mockRedis := new(MockRedisClient)
-	mockKafka := new(MockKafkaProducer)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
 
-	usecase := NewQueryUsecase(mockQuery, mockRedis, mockKafka)
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
 
 	ctx := context.Background()
 	userId := "user123"
@@ -86,9 +282,10 @@ func TestGetUser_Success(t *testing.T) {
 func TestGetUser_NotFound(t *testing.T) {
 	mockQuery := new(MockMongodbRepositoryQuery)
 	mockRedis := new(MockRedisClient)
-	mockKafka := new(MockKafkaProducer)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
 
-	usecase := NewQueryUsecase(mockQuery, mockRedis, mockKafka)
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
 
 	ctx := context.Background()
 	userId := "nonexistent"
@@ -109,9 +306,10 @@ func TestGetUser_NotFound(t *testing.T) {
 func TestFindDriver_Success(t *testing.T) {
 	mockQuery := new(MockMongodbRepositoryQuery)
 	mockRedis := new(MockRedisClient)
-	mockKafka := new(MockKafkaProducer)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
 
-	usecase := NewQueryUsecase(mockQuery, mockRedis, mockKafka)
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
 
 	ctx := context.Background()
 	userId := "user123"
@@ -133,24 +331,88 @@ func TestFindDriver_Success(t *testing.T) {
 	drivers := []redis.GeoLocation{{Name: "driver1"}}
 	mockRedis.On("Get", ctx, key).Return(redis.NewStringResult(string(tripPlanData), nil))
 	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: wallet})
+	mockSurge.On("Zone", tripPlan.Route.Origin.Latitude, tripPlan.Route.Origin.Longitude).Return("9q8yy")
+	mockSurge.On("RecordDemand", "9q8yy", userId, ctx).Return(nil)
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
 	mockRedis.On("GeoRadius", ctx, "drivers-locations", tripPlan.Route.Origin.Longitude, tripPlan.Route.Origin.Latitude, mock.Anything).Return(redis.NewGeoLocationCmdResult(drivers, nil))
-	mockKafka.On("Publish", "request-ride", mock.Anything).Return(nil)
+	mockRedis.On("Set", ctx, "USER:SEARCH:user123", mock.Anything, 15*time.Second+riderSearchGrace).Return(redis.NewStatusResult("OK", nil))
+	mockRedis.On("Set", ctx, "USER:PICKUP:user123", mock.Anything, tripPickupTTL).Return(redis.NewStatusResult("OK", nil))
+	mockRedis.On("Del", ctx, []string{key}).Return(redis.NewIntResult(1, nil))
+	mockCommand.On("InsertDispatch", mock.MatchedBy(func(dispatch models.Dispatch) bool {
+		return dispatch.Status == models.DispatchSearching && len(dispatch.Candidates) == 1 && dispatch.Request != ""
+	}), ctx).Return(utils.Result{})
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(event outbox.Event) bool {
+		return event.Topic == "request-ride" && event.Key == userId && event.Status == outbox.StatusPending
+	}), ctx).Return(utils.Result{})
 
 	result := usecase.FindDriver(userId, ctx)
 
 	assert.Nil(t, result.Error)
 	assert.NotNil(t, result.Data)
 	response := result.Data.(Response)
-	assert.Equal(t, "Please sit back, there are 1 drivers available, we will let you know", response.Message)
-	assert.Len(t, response.Driver.([]redis.GeoLocation), 1)
+	assert.Equal(t, "Please sit back, there are 1 drivers available within 3 km, we will let you know", response.Message)
+	assert.Len(t, response.Driver.([]models.RankedDriver), 1)
+	assert.Equal(t, 3.0, response.RadiusKm)
+	assert.NotEmpty(t, response.DispatchId)
+	mockSurge.AssertExpectations(t)
+	mockRedis.AssertCalled(t, "Set", ctx, "USER:SEARCH:user123", response.DispatchId, 15*time.Second+riderSearchGrace)
+	// the quote is booked, the search lasts until the dispatch ends
+	mockRedis.AssertCalled(t, "Del", ctx, []string{key})
+	mockRedis.AssertNotCalled(t, "Del", ctx, []string{"USER:SEARCH:user123"})
+}
+
+func TestFindDriver_RideNoLongerQuoted(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+	mockRides := new(MockRideUsecase)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, mockRides)
+
+	ctx := context.Background()
+	userId := "user123"
+	key := "USER:ROUTE:user123"
+	tripPlan := models.RouteSummary{
+		MaxPrice: 1000,
+		RideId:   "ride1",
+		Route: models.Route{
+			Origin: models.LocationRequest{Latitude: 37.7749, Longitude: -122.4194},
+		},
+	}
+	tripPlanData, _ := json.Marshal(tripPlan)
+
+	conflict := httpError.NewConflict()
+	conflict.Message = "Ride is cancelled now"
+	mockRedis.On("Get", ctx, key).Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	mockSurge.On("Zone", 37.7749, -122.4194).Return("9q8yy")
+	mockSurge.On("RecordDemand", "9q8yy", userId, ctx).Return(nil)
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
+	mockRedis.On("GeoRadius", ctx, "drivers-locations", -122.4194, 37.7749, mock.Anything).Return(redis.NewGeoLocationCmdResult([]redis.GeoLocation{{Name: "driver1"}}, nil))
+	mockRides.On("Transition", "ride1", mock.MatchedBy(func(transition rideModels.Transition) bool {
+		return transition.Status == rideModels.StatusSearching && transition.From == rideModels.StatusQuoted
+	}), ctx).Return(utils.Result{Error: conflict})
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:user123"}).Return(redis.NewIntResult(1, nil))
+
+	result := usecase.FindDriver(userId, ctx)
+
+	errObj, ok := result.Error.(httpError.ConflictData)
+	assert.True(t, ok)
+	assert.Equal(t, 409, errObj.Code)
+	mockCommand.AssertNotCalled(t, "InsertDispatch", mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+	mockRedis.AssertCalled(t, "Del", ctx, []string{"USER:SEARCH:user123"})
+	mockRedis.AssertNotCalled(t, "Del", ctx, []string{key})
 }
 
 func TestFindDriver_GeoRadiusError(t *testing.T) {
 	mockQuery := new(MockMongodbRepositoryQuery)
 	mockRedis := new(MockRedisClient)
-	mockKafka := new(MockKafkaProducer)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
 
-	usecase := NewQueryUsecase(mockQuery, mockRedis, mockKafka)
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
 
 	ctx := context.Background()
 	userId := "user123"
@@ -171,7 +433,11 @@ func TestFindDriver_GeoRadiusError(t *testing.T) {
 
 	mockRedis.On("Get", ctx, key).Return(redis.NewStringResult(string(tripPlanData), nil))
 	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: wallet})
+	mockSurge.On("Zone", tripPlan.Route.Origin.Latitude, tripPlan.Route.Origin.Longitude).Return("9q8yy")
+	mockSurge.On("RecordDemand", "9q8yy", userId, ctx).Return(nil)
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
 	mockRedis.On("GeoRadius", ctx, "drivers-locations", tripPlan.Route.Origin.Longitude, tripPlan.Route.Origin.Latitude, mock.Anything).Return(redis.NewGeoLocationCmdResult(nil, errors.New("geo radius error")))
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:user123"}).Return(redis.NewIntResult(1, nil))
 
 	result := usecase.FindDriver(userId, ctx)
 
@@ -181,14 +447,115 @@ func TestFindDriver_GeoRadiusError(t *testing.T) {
 	} else {
 		t.Errorf("expected error of type httpError.HttpError, got %T", result.Error)
 	}
+	// the failed search does not block the next one
+	mockRedis.AssertCalled(t, "Del", ctx, []string{"USER:SEARCH:user123"})
+}
+
+func TestFindDriver_SearchRunning(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	userId := "user123"
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000})
+
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(false, nil))
+
+	result := usecase.FindDriver(userId, ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockSurge.AssertNotCalled(t, "RecordDemand", mock.Anything, mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+	// the running search keeps its lock
+	mockRedis.AssertNotCalled(t, "Del", mock.Anything, mock.Anything)
+}
+
+func TestFindDriver_ScheduledQuote(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	userId := "user123"
+	pickupAt := time.Now().Add(time.Hour)
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000, PickupAt: &pickupAt})
+
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+
+	result := usecase.FindDriver(userId, ctx)
+
+	assert.IsType(t, httpError.BadRequestData{}, result.Error)
+	mockRedis.AssertNotCalled(t, "SetNX", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertDispatch", mock.Anything, mock.Anything)
+}
+
+func TestFindPool_SearchRunning(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	userId := "user123"
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000})
+
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(false, nil))
+
+	result := usecase.FindPool(userId, ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockSurge.AssertNotCalled(t, "RecordDemand", mock.Anything, mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+	mockRedis.AssertNotCalled(t, "Del", mock.Anything, mock.Anything)
+}
+
+func TestFindPool_NoMatchEndsSearch(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	userId := "user123"
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000})
+
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
+	mockSurge.On("Zone", 0.0, 0.0).Return("zone-1")
+	mockSurge.On("RecordDemand", "zone-1", userId, ctx).Return(nil)
+	mockRedis.On("GeoRadius", ctx, "drivers-on-trip-locations", 0.0, 0.0, mock.Anything).Return(redis.NewGeoLocationCmdResult(nil, nil))
+	mockRedis.On("Del", ctx, []string{"USER:SEARCH:user123"}).Return(redis.NewIntResult(1, nil))
+
+	result := usecase.FindPool(userId, ctx)
+
+	assert.Nil(t, result.Error)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
+	mockRedis.AssertCalled(t, "Del", ctx, []string{"USER:SEARCH:user123"})
 }
 
-func TestFindDriver_KafkaPublishError(t *testing.T) {
+func TestFindDriver_OutboxError(t *testing.T) {
 	mockQuery := new(MockMongodbRepositoryQuery)
 	mockRedis := new(MockRedisClient)
-	mockKafka := new(MockKafkaProducer)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
 
-	usecase := NewQueryUsecase(mockQuery, mockRedis, mockKafka)
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
 
 	ctx := context.Background()
 	userId := "user123"
@@ -210,13 +577,94 @@ func TestFindDriver_KafkaPublishError(t *testing.T) {
 	drivers := []redis.GeoLocation{{Name: "driver1"}}
 	mockRedis.On("Get", ctx, key).Return(redis.NewStringResult(string(tripPlanData), nil))
 	mockQuery.On("Findwallet", ctx, userId).Return(utils.Result{Data: wallet})
+	mockSurge.On("Zone", tripPlan.Route.Origin.Latitude, tripPlan.Route.Origin.Longitude).Return("9q8yy")
+	mockSurge.On("RecordDemand", "9q8yy", userId, ctx).Return(nil)
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
 	mockRedis.On("GeoRadius", ctx, "drivers-locations", tripPlan.Route.Origin.Longitude, tripPlan.Route.Origin.Latitude, mock.Anything).Return(redis.NewGeoLocationCmdResult(drivers, nil))
-	mockKafka.On("Publish", "request-ride", mock.Anything).Return(errors.New("kafka publish error"))
+	mockRedis.On("Set", ctx, mock.Anything, mock.Anything, mock.Anything).Return(redis.NewStatusResult("OK", nil))
+	mockRedis.On("Del", ctx, []string{key}).Return(redis.NewIntResult(1, nil))
+	mockCommand.On("InsertDispatch", mock.Anything, ctx).Return(utils.Result{})
+	mockCommand.On("InsertOutbox", mock.Anything, ctx).Return(utils.Result{Error: errors.New("outbox insert error")})
 
 	result := usecase.FindDriver(userId, ctx)
 
+	// the dispatch is live, the rider gets it and keeps the search
 	assert.Nil(t, result.Error)
-	assert.NotNil(t, result.Data)
-	response := result.Data.(Response)
-	assert.Equal(t, "Please sit back, there are 1 drivers available, we will let you know", response.Message)
+	searchResult := result.Data.(Response)
+	assert.NotEmpty(t, searchResult.DispatchId)
+	mockRedis.AssertNotCalled(t, "Del", ctx, []string{"USER:SEARCH:user123"})
+}
+
+// DispatchScheduledRides tests
+func TestDispatchScheduledRides_Dispatched(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	ride := models.ScheduledRide{
+		UserId: "user123",
+		RouteSummary: models.RouteSummary{
+			Route: models.Route{
+				Origin: models.LocationRequest{Latitude: 37.7749, Longitude: -122.4194},
+			},
+		},
+		PickupAt: time.Now().Add(10 * time.Minute),
+		Status:   models.ScheduledRideScheduled,
+	}
+
+	mockCommand.On("RequeueStaleScheduledRides", mock.MatchedBy(func(staleBefore time.Time) bool {
+		return time.Since(staleBefore) >= scheduledRideStaleAfter
+	}), mock.Anything, ctx).Return(utils.Result{})
+	mockQuery.On("FindDueScheduledRides", ctx, mock.Anything, int64(scheduledRideBatch)).Return(utils.Result{Data: []models.ScheduledRide{ride}})
+	mockCommand.On("UpdateScheduledRide", mock.MatchedBy(func(r models.ScheduledRide) bool {
+		return r.Status == models.ScheduledRideDispatching
+	}), models.ScheduledRideScheduled, ctx).Return(utils.Result{Data: true})
+	mockSurge.On("Zone", 37.7749, -122.4194).Return("9q8yy")
+	mockSurge.On("RecordDemand", "9q8yy", "user123", ctx).Return(nil)
+	mockRedis.On("SetNX", ctx, "USER:SEARCH:user123", "searching", riderSearchLockTTL).Return(redis.NewBoolResult(true, nil))
+	mockRedis.On("GeoRadius", ctx, "drivers-locations", -122.4194, 37.7749, mock.Anything).Return(redis.NewGeoLocationCmdResult([]redis.GeoLocation{{Name: "driver1"}}, nil))
+	mockRedis.On("Set", ctx, "USER:SEARCH:user123", mock.Anything, mock.Anything).Return(redis.NewStatusResult("OK", nil))
+	mockRedis.On("Set", ctx, "USER:PICKUP:user123", mock.Anything, tripPickupTTL).Return(redis.NewStatusResult("OK", nil))
+	mockCommand.On("InsertDispatch", mock.Anything, ctx).Return(utils.Result{})
+	mockCommand.On("InsertOutbox", mock.MatchedBy(func(event outbox.Event) bool {
+		return event.Topic == "request-ride" && event.Key == "user123"
+	}), ctx).Return(utils.Result{})
+	mockCommand.On("UpdateScheduledRide", mock.MatchedBy(func(r models.ScheduledRide) bool {
+		return r.Status == models.ScheduledRideDispatched && r.DispatchedAt != nil
+	}), models.ScheduledRideDispatching, ctx).Return(utils.Result{Data: true})
+
+	result := usecase.DispatchScheduledRides(ctx)
+
+	assert.Nil(t, result.Error)
+	rides := result.Data.([]models.ScheduledRide)
+	assert.Len(t, rides, 1)
+	assert.Equal(t, models.ScheduledRideDispatched, rides[0].Status)
+	mockCommand.AssertExpectations(t)
+}
+
+func TestDispatchScheduledRides_CancelledBeforeClaim(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockRedis := new(MockRedisClient)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockSurge := new(MockSurgePricing)
+
+	usecase := NewQueryUsecase(mockQuery, mockCommand, mockRedis, mockSurge, nil, NewNearestMatching(), nil, nil)
+
+	ctx := context.Background()
+	ride := models.ScheduledRide{UserId: "user123", Status: models.ScheduledRideScheduled}
+
+	mockCommand.On("RequeueStaleScheduledRides", mock.Anything, mock.Anything, ctx).Return(utils.Result{})
+	mockQuery.On("FindDueScheduledRides", ctx, mock.Anything, int64(scheduledRideBatch)).Return(utils.Result{Data: []models.ScheduledRide{ride}})
+	mockCommand.On("UpdateScheduledRide", mock.Anything, models.ScheduledRideScheduled, ctx).Return(utils.Result{Data: false})
+
+	result := usecase.DispatchScheduledRides(ctx)
+
+	assert.Nil(t, result.Error)
+	assert.Empty(t, result.Data.([]models.ScheduledRide))
+	mockSurge.AssertNotCalled(t, "RecordDemand", mock.Anything, mock.Anything, mock.Anything)
+	mockCommand.AssertNotCalled(t, "InsertOutbox", mock.Anything, mock.Anything)
 }
@@ -0,0 +1,62 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"location-service/bin/modules/ride"
+	rideModels "location-service/bin/modules/ride/models"
+	"location-service/bin/modules/user/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/log"
+	"location-service/bin/pkg/utils"
+)
+
+// quoteRide opens the ride of a quote, the quote is still made when the ride can not be saved
+func quoteRide(rides ride.UsecaseCommand, userId string, quote models.RouteSummary, ctx context.Context) string {
+	if rides == nil {
+		return ""
+	}
+	stops := make([]rideModels.Location, 0, len(quote.Route.Stops))
+	for _, stop := range quote.Route.Stops {
+		stops = append(stops, rideLocation(stop))
+	}
+	rideRes := rides.CreateRide(rideModels.Ride{
+		UserId:      userId,
+		ServiceType: quote.Fare.ServiceType,
+		Pickup:      rideLocation(quote.Route.Origin),
+		Stops:       stops,
+		Destination: rideLocation(quote.Route.Destination),
+		Fare:        quote.Fare.Total,
+		PickupAt:    quote.PickupAt,
+	}, ctx)
+	if rideRes.Error != nil {
+		log.GetLogger().Error("command_usecase", "Error create ride of quote", "quoteRide", utils.ConvertString(rideRes.Error))
+		return ""
+	}
+	created, _ := rideRes.Data.(rideModels.Ride)
+	return created.ID.Hex()
+}
+
+// moveRide records a step of the ride of a quote, a quote without ride always moves. A transition guarded by From
+// that lost to another one is expected, its httpError.ConflictData is returned without being logged.
+func moveRide(rides ride.UsecaseCommand, rideId string, transition rideModels.Transition, scope string, ctx context.Context) utils.Result {
+	if rides == nil || rideId == "" {
+		return utils.Result{}
+	}
+	result := rides.Transition(rideId, transition, ctx)
+	if result.Error == nil {
+		return result
+	}
+	if _, conflict := result.Error.(httpError.ConflictData); !conflict || transition.From == "" {
+		log.GetLogger().Error("ride", fmt.Sprintf("Error move ride %s to %s", rideId, transition.Status), scope, utils.ConvertString(result.Error))
+	}
+	return result
+}
+
+func rideLocation(location models.LocationRequest) rideModels.Location {
+	return rideModels.Location{
+		Longitude: location.Longitude,
+		Latitude:  location.Latitude,
+		Address:   location.Address,
+	}
+}
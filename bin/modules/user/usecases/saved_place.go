@@ -0,0 +1,41 @@
+package usecases
+
+import (
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+)
+
+const (
+	// recentDestinationRadiusKm merges destinations closer than this, the same mall entrance or station exit
+	recentDestinationRadiusKm = 0.1
+	// recentDestinationScan is how many recent destinations are read to find a nearby one
+	recentDestinationScan = 50
+	// recentDestinationLimit is how many recent destinations are returned to the rider
+	recentDestinationLimit = 10
+)
+
+// findNearbyDestination returns the index of the recent destination within the merge radius of destination, -1 if none
+func findNearbyDestination(recents []models.RecentDestination, destination models.LocationRequest) int {
+	for i, recent := range recents {
+		distance := utils.HaversineKm(recent.Destination.Latitude, recent.Destination.Longitude, destination.Latitude, destination.Longitude)
+		if distance <= recentDestinationRadiusKm {
+			return i
+		}
+	}
+	return -1
+}
+
+// dedupeRecentDestinations keeps the latest of the destinations close to each other, recents are sorted latest first
+func dedupeRecentDestinations(recents []models.RecentDestination, limit int) []models.RecentDestination {
+	deduped := make([]models.RecentDestination, 0, limit)
+	for _, recent := range recents {
+		if len(deduped) == limit {
+			break
+		}
+		if findNearbyDestination(deduped, recent.Destination) >= 0 {
+			continue
+		}
+		deduped = append(deduped, recent)
+	}
+	return deduped
+}
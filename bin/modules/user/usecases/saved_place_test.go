@@ -0,0 +1,53 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDedupeRecentDestinations(t *testing.T) {
+	now := time.Now()
+	recents := []models.RecentDestination{
+		{Destination: models.LocationRequest{Latitude: -6.1767, Longitude: 106.8306, Address: "Gambir gate A"}, LastUsedAt: now},
+		// 50m away from the latest one
+		{Destination: models.LocationRequest{Latitude: -6.17715, Longitude: 106.8306, Address: "Gambir gate B"}, LastUsedAt: now.Add(-time.Hour)},
+		{Destination: models.LocationRequest{Latitude: -6.2250, Longitude: 106.7990, Address: "Senayan"}, LastUsedAt: now.Add(-2 * time.Hour)},
+	}
+
+	deduped := dedupeRecentDestinations(recents, 10)
+
+	assert.Len(t, deduped, 2)
+	assert.Equal(t, "Gambir gate A", deduped[0].Destination.Address)
+	assert.Equal(t, "Senayan", deduped[1].Destination.Address)
+	assert.Len(t, dedupeRecentDestinations(recents, 1), 1)
+}
+
+func TestCreateSavedPlace_MovesHome(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, nil, nil, nil, nil)
+
+	ctx := context.Background()
+	home := models.SavedPlace{ID: primitive.NewObjectID(), UserId: "user123", Label: models.SavedPlaceHome, Name: "home"}
+	mockQuery.On("FindSavedPlaces", ctx, "user123").Return(utils.Result{Data: []models.SavedPlace{home}})
+	mockCommand.On("UpdateSavedPlace", mock.MatchedBy(func(place models.SavedPlace) bool {
+		return place.ID == home.ID && place.Location.Address == "Jl. Baru"
+	}), ctx).Return(utils.Result{Data: home})
+
+	result := usecase.CreateSavedPlace("user123", models.SavedPlaceRequest{
+		Label:    models.SavedPlaceHome,
+		Location: models.LocationRequest{Latitude: -6.2, Longitude: 106.8, Address: "Jl. Baru"},
+	}, ctx)
+
+	assert.Nil(t, result.Error)
+	mockCommand.AssertNotCalled(t, "InsertSavedPlace", mock.Anything, mock.Anything)
+	mockCommand.AssertExpectations(t)
+}
@@ -0,0 +1,52 @@
+package usecases
+
+import (
+	"fmt"
+	"location-service/bin/config"
+	"location-service/bin/modules/user/models"
+	"time"
+)
+
+const (
+	// defaultScheduledRideLead is how long before pickup the driver search starts when SCHEDULED_RIDE_LEAD_TIME is not set
+	defaultScheduledRideLead = 15 * time.Minute
+	// scheduledRideBatch is how many due rides are dispatched per scheduler tick
+	scheduledRideBatch = 50
+	// scheduledRideConcurrency is how many rides of a tick search drivers at the same time
+	scheduledRideConcurrency = 10
+	// scheduledRideStaleAfter is when a dispatching ride is taken for one whose instance died, far longer than a
+	// driver search
+	scheduledRideStaleAfter = 5 * time.Minute
+)
+
+func scheduledRideLead() time.Duration {
+	lead := time.Duration(config.GetConfig().ScheduledRideLead) * time.Second
+	if lead <= 0 {
+		return defaultScheduledRideLead
+	}
+	return lead
+}
+
+// validatePickupAt accepts a pickup far enough ahead for the driver search to start on time, and not beyond
+// the booking horizon
+func validatePickupAt(pickupAt time.Time, now time.Time, lead time.Duration) error {
+	if pickupAt.Before(now.Add(lead)) {
+		return fmt.Errorf("pickup time must be at least %d minutes ahead", int(lead.Minutes()))
+	}
+	if pickupAt.After(now.Add(models.MaxScheduleAhead)) {
+		return fmt.Errorf("pickup time must be within %d days", int(models.MaxScheduleAhead.Hours()/24))
+	}
+	return nil
+}
+
+// nextScheduledRideStatus is where a claimed ride goes after a dispatch attempt. A ride without drivers around
+// stays scheduled and is tried again on the next tick until its pickup time has passed.
+func nextScheduledRideStatus(ride models.ScheduledRide, dispatched bool, now time.Time) string {
+	if dispatched {
+		return models.ScheduledRideDispatched
+	}
+	if now.Before(ride.PickupAt) {
+		return models.ScheduledRideScheduled
+	}
+	return models.ScheduledRideFailed
+}
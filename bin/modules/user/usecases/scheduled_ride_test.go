@@ -0,0 +1,78 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"location-service/bin/modules/user/models"
+	httpError "location-service/bin/pkg/http-error"
+	"location-service/bin/pkg/utils"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestValidatePickupAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	lead := 15 * time.Minute
+
+	assert.NoError(t, validatePickupAt(now.Add(time.Hour), now, lead))
+	assert.NoError(t, validatePickupAt(now.Add(lead), now, lead))
+	assert.EqualError(t, validatePickupAt(now.Add(10*time.Minute), now, lead), "pickup time must be at least 15 minutes ahead")
+	assert.EqualError(t, validatePickupAt(now.Add(8*24*time.Hour), now, lead), "pickup time must be within 7 days")
+}
+
+func TestNextScheduledRideStatus(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	ride := models.ScheduledRide{PickupAt: now.Add(5 * time.Minute)}
+
+	assert.Equal(t, models.ScheduledRideDispatched, nextScheduledRideStatus(ride, true, now))
+	// no driver yet, retried on the next tick
+	assert.Equal(t, models.ScheduledRideScheduled, nextScheduledRideStatus(ride, false, now))
+	assert.Equal(t, models.ScheduledRideFailed, nextScheduledRideStatus(ride, false, now.Add(10*time.Minute)))
+}
+
+func TestScheduleRide_ConsumesQuote(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockRedis := new(MockRedisClient)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, mockRedis, nil, nil, nil)
+
+	ctx := context.Background()
+	pickupAt := time.Now().Add(2 * time.Hour)
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000, PickupAt: &pickupAt, RideId: "ride1"})
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, "user123").Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	mockRedis.On("Del", ctx, []string{"USER:ROUTE:user123"}).Return(redis.NewIntResult(1, nil))
+	mockCommand.On("InsertScheduledRide", mock.MatchedBy(func(ride models.ScheduledRide) bool {
+		return ride.RouteSummary.RideId == "ride1" && ride.Status == models.ScheduledRideScheduled
+	}), ctx).Return(utils.Result{Data: models.ScheduledRide{}})
+
+	result := usecase.ScheduleRide("user123", ctx)
+
+	assert.Nil(t, result.Error)
+	mockRedis.AssertExpectations(t)
+	mockCommand.AssertExpectations(t)
+}
+
+func TestScheduleRide_QuoteAlreadyBooked(t *testing.T) {
+	mockQuery := new(MockMongodbRepositoryQuery)
+	mockCommand := new(MockMongodbRepositoryCommand)
+	mockRedis := new(MockRedisClient)
+	usecase := NewCommandUsecase(mockQuery, mockCommand, nil, mockRedis, nil, nil, nil)
+
+	ctx := context.Background()
+	pickupAt := time.Now().Add(2 * time.Hour)
+	tripPlanData, _ := json.Marshal(models.RouteSummary{MaxPrice: 1000, PickupAt: &pickupAt, RideId: "ride1"})
+	mockRedis.On("Get", ctx, "USER:ROUTE:user123").Return(redis.NewStringResult(string(tripPlanData), nil))
+	mockQuery.On("Findwallet", ctx, "user123").Return(utils.Result{Data: models.Wallet{Balance: 2000}})
+	// a concurrent request booked it first
+	mockRedis.On("Del", ctx, []string{"USER:ROUTE:user123"}).Return(redis.NewIntResult(0, nil))
+
+	result := usecase.ScheduleRide("user123", ctx)
+
+	assert.IsType(t, httpError.ConflictData{}, result.Error)
+	mockCommand.AssertNotCalled(t, "InsertScheduledRide", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,249 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"location-service/bin/modules/user"
+	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/constants"
+	"location-service/bin/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// surgeZoneRadiusKm covers a whole zone cell from its center
+	surgeZoneRadiusKm = 3.5
+	// surgeRefreshInterval is how long a computed multiplier is reused before the zone is counted again
+	surgeRefreshInterval = 30 * time.Second
+	// surgeSensitivity is how much the multiplier rises per extra rider for each available driver
+	surgeSensitivity = 0.5
+
+	defaultSurgeWindow        = 10 * time.Minute
+	defaultSurgeMaxMultiplier = 3.0
+	defaultSurgeSmoothing     = 0.5
+)
+
+// surgeOverridden is what saveSurgeState answers when an admin override is set on the zone
+const surgeOverridden = "override"
+
+// saveSurgeState saves the new state of a zone (ARGV[2], for ARGV[3] milliseconds) only while no override (KEYS[1])
+// is set and the state (KEYS[2]) is still the one it was computed from (ARGV[1], empty for none). It answers the
+// state the zone ends up with, or surgeOverridden.
+var saveSurgeState = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return "override"
+end
+local current = redis.call("GET", KEYS[2]) or ""
+if current ~= ARGV[1] then
+	return current
+end
+redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+return ARGV[2]
+`)
+
+type surgePricing struct {
+	redisClient   redis.UniversalClient
+	window        time.Duration
+	maxMultiplier float64
+	smoothing     float64
+}
+
+// NewSurgePricing counts demand over window, the multiplier is capped at maxMultiplier and moves
+// toward the live ratio by the smoothing factor (0 to 1) on every refresh
+func NewSurgePricing(rc redis.UniversalClient, window time.Duration, maxMultiplier float64, smoothing float64) user.SurgePricing {
+	if window <= 0 {
+		window = defaultSurgeWindow
+	}
+	if maxMultiplier < models.NoSurge {
+		maxMultiplier = defaultSurgeMaxMultiplier
+	}
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = defaultSurgeSmoothing
+	}
+	return &surgePricing{
+		redisClient:   rc,
+		window:        window,
+		maxMultiplier: maxMultiplier,
+		smoothing:     smoothing,
+	}
+}
+
+func (s *surgePricing) Zone(latitude float64, longitude float64) string {
+	return utils.EncodeGeohash(latitude, longitude, models.SurgeZonePrecision)
+}
+
+// RecordDemand counts the rider once per zone within the window, whatever the number of searches
+func (s *surgePricing) RecordDemand(zone string, riderId string, ctx context.Context) error {
+	key := fmt.Sprintf(constants.SurgeDemandKey, zone)
+	_, err := s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().UnixMilli()), Member: riderId})
+		pipe.Expire(ctx, key, s.window)
+		return nil
+	})
+	return err
+}
+
+func (s *surgePricing) Multiplier(zone string, ctx context.Context) (models.SurgeState, error) {
+	override, err := s.findOverride(zone, ctx)
+	if err != nil || override != nil {
+		return derefSurge(override), err
+	}
+
+	stateKey := fmt.Sprintf(constants.SurgeStateKey, zone)
+	previous := models.SurgeState{Zone: zone, Multiplier: models.NoSurge}
+	cached, err := s.redisClient.Get(ctx, stateKey).Result()
+	if err == nil {
+		json.Unmarshal([]byte(cached), &previous)
+		if time.Since(previous.UpdatedAt) < surgeRefreshInterval {
+			return previous, nil
+		}
+	} else if err != redis.Nil {
+		return models.SurgeState{}, err
+	}
+
+	demand, supply, err := s.count(zone, ctx)
+	if err != nil {
+		return models.SurgeState{}, err
+	}
+	state := models.SurgeState{
+		Zone:       zone,
+		Multiplier: smoothSurge(previous.Multiplier, targetSurge(demand, supply, s.maxMultiplier), s.smoothing),
+		Demand:     demand,
+		Supply:     supply,
+		UpdatedAt:  time.Now(),
+	}
+	stateJSON, _ := json.Marshal(state)
+	saved, err := saveSurgeState.Run(ctx, s.redisClient, []string{fmt.Sprintf(constants.SurgeOverrideKey, zone), stateKey},
+		cached, string(stateJSON), s.window.Milliseconds()).Text()
+	if err != nil {
+		return models.SurgeState{}, err
+	}
+	if saved == surgeOverridden {
+		// an admin set the zone while it was counted
+		override, err := s.findOverride(zone, ctx)
+		if err != nil || override != nil {
+			return derefSurge(override), err
+		}
+		return state, nil
+	}
+	if saved != string(stateJSON) {
+		// another replica refreshed the zone first, its smoothing wins. A state that expired meanwhile is saved again
+		// on the next call.
+		var current models.SurgeState
+		if json.Unmarshal([]byte(saved), &current) == nil && current.Zone != "" {
+			return current, nil
+		}
+	}
+	return state, nil
+}
+
+func (s *surgePricing) Override(zone string, multiplier float64, ttl time.Duration, ctx context.Context) (models.SurgeState, error) {
+	if err := s.redisClient.Set(ctx, fmt.Sprintf(constants.SurgeOverrideKey, zone), multiplier, ttl).Err(); err != nil {
+		return models.SurgeState{}, err
+	}
+	override, err := s.findOverride(zone, ctx)
+	return derefSurge(override), err
+}
+
+func (s *surgePricing) ClearOverride(zone string, ctx context.Context) error {
+	return s.redisClient.Del(ctx, fmt.Sprintf(constants.SurgeOverrideKey, zone)).Err()
+}
+
+// findOverride returns nil when no admin override is set on the zone
+func (s *surgePricing) findOverride(zone string, ctx context.Context) (*models.SurgeState, error) {
+	key := fmt.Sprintf(constants.SurgeOverrideKey, zone)
+	value, err := s.redisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	multiplier, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid surge override %s: %w", value, err)
+	}
+
+	state := &models.SurgeState{
+		Zone:       zone,
+		Multiplier: multiplier,
+		Overridden: true,
+		UpdatedAt:  time.Now(),
+	}
+	if ttl, err := s.redisClient.PTTL(ctx, key).Result(); err == nil && ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		state.OverrideExpiresAt = &expiresAt
+	}
+	return state, nil
+}
+
+// count returns the riders searching in the zone within the window and the available drivers around it
+func (s *surgePricing) count(zone string, ctx context.Context) (int64, int64, error) {
+	latitude, longitude, ok := utils.DecodeGeohash(zone)
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid zone %s", zone)
+	}
+
+	demandKey := fmt.Sprintf(constants.SurgeDemandKey, zone)
+	minScore := strconv.FormatInt(time.Now().Add(-s.window).UnixMilli(), 10)
+	if err := s.redisClient.ZRemRangeByScore(ctx, demandKey, "-inf", "("+minScore).Err(); err != nil {
+		return 0, 0, err
+	}
+	demand, err := s.redisClient.ZCard(ctx, demandKey).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	drivers, err := s.redisClient.GeoSearch(ctx, constants.DriverLocationKey, &redis.GeoSearchQuery{
+		Longitude:  longitude,
+		Latitude:   latitude,
+		Radius:     surgeZoneRadiusKm,
+		RadiusUnit: "km",
+	}).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	return demand, int64(len(drivers)), nil
+}
+
+// targetSurge is the multiplier for the current ratio of riders to drivers, capped at maxMultiplier
+func targetSurge(demand int64, supply int64, maxMultiplier float64) float64 {
+	ratio := float64(demand) / math.Max(float64(supply), 1)
+	if ratio <= 1 {
+		return models.NoSurge
+	}
+	return math.Min(models.NoSurge+(ratio-1)*surgeSensitivity, maxMultiplier)
+}
+
+// smoothSurge moves the previous multiplier toward target in steps of 0.1 so prices do not flicker,
+// rounding toward target makes sure it is reached
+func smoothSurge(previous float64, target float64, smoothing float64) float64 {
+	if previous < models.NoSurge {
+		previous = models.NoSurge
+	}
+	target = math.Round(target*10) / 10
+	// drop the float noise first, ceil would turn 15.000000001 into 16
+	next := math.Round((previous+(target-previous)*smoothing)*1e6) / 1e5
+	if target > previous {
+		return math.Ceil(next) / 10
+	}
+	return math.Max(math.Floor(next)/10, models.NoSurge)
+}
+
+func validSurgeZone(zone string) bool {
+	_, _, ok := utils.DecodeGeohash(zone)
+	return ok && len(zone) == models.SurgeZonePrecision
+}
+
+func derefSurge(state *models.SurgeState) models.SurgeState {
+	if state == nil {
+		return models.SurgeState{}
+	}
+	return *state
+}
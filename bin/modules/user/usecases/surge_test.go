@@ -0,0 +1,169 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"location-service/bin/modules/user/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSurgeRedis keeps the surge keys in memory and runs saveSurgeState the way redis would, beforeSave lets a test
+// write in between the count and the save like another replica or an admin
+type fakeSurgeRedis struct {
+	redis.UniversalClient
+	values     map[string]string
+	demand     int64
+	drivers    int
+	counted    int
+	beforeSave func()
+}
+
+func (f *fakeSurgeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	value, ok := f.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (f *fakeSurgeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	f.values[key] = fmt.Sprint(value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (f *fakeSurgeRedis) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	return redis.NewDurationResult(-1, nil)
+}
+
+func (f *fakeSurgeRedis) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	return redis.NewIntResult(0, nil)
+}
+
+func (f *fakeSurgeRedis) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	f.counted++
+	return redis.NewIntResult(f.demand, nil)
+}
+
+func (f *fakeSurgeRedis) GeoSearch(ctx context.Context, key string, q *redis.GeoSearchQuery) *redis.StringSliceCmd {
+	return redis.NewStringSliceResult(make([]string, f.drivers), nil)
+}
+
+func (f *fakeSurgeRedis) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	if f.beforeSave != nil {
+		f.beforeSave()
+	}
+	if _, ok := f.values[keys[0]]; ok {
+		return redis.NewCmdResult(surgeOverridden, nil)
+	}
+	if current := f.values[keys[1]]; current != args[0] {
+		return redis.NewCmdResult(current, nil)
+	}
+	f.values[keys[1]] = args[1].(string)
+	return redis.NewCmdResult(args[1], nil)
+}
+
+// age moves the saved state of the zone past the refresh interval
+func (f *fakeSurgeRedis) age(zone string) {
+	var state models.SurgeState
+	json.Unmarshal([]byte(f.values["SURGE:ZONE:{"+zone+"}"]), &state)
+	state.UpdatedAt = state.UpdatedAt.Add(-time.Minute)
+	aged, _ := json.Marshal(state)
+	f.values["SURGE:ZONE:{"+zone+"}"] = string(aged)
+}
+
+func TestTargetSurge(t *testing.T) {
+	assert.Equal(t, 1.0, targetSurge(3, 5, 3))
+	assert.Equal(t, 1.5, targetSurge(4, 2, 3))
+	// no driver counts as one so a single rider does not surge
+	assert.Equal(t, 1.0, targetSurge(1, 0, 3))
+	assert.Equal(t, 3.0, targetSurge(40, 2, 3))
+}
+
+func TestSmoothSurge(t *testing.T) {
+	assert.Equal(t, 1.5, smoothSurge(1, 2, 0.5))
+	assert.Equal(t, 1.8, smoothSurge(1.5, 2, 0.5))
+	// rounding toward the target always reaches it
+	assert.Equal(t, 2.0, smoothSurge(1.9, 2, 0.5))
+	assert.Equal(t, 1.0, smoothSurge(1.1, 1, 0.5))
+	assert.Equal(t, 1.0, smoothSurge(0, 1, 0.5))
+}
+
+func TestValidSurgeZone(t *testing.T) {
+	assert.True(t, validSurgeZone("qqguw"))
+	assert.False(t, validSurgeZone("qqgu"))
+	assert.False(t, validSurgeZone("qqgua"))
+}
+
+func TestSurgeMultiplier_SmoothsAcrossCalls(t *testing.T) {
+	fake := &fakeSurgeRedis{values: map[string]string{}, demand: 20, drivers: 2}
+	surge := NewSurgePricing(fake, time.Minute, 2, 0.5)
+	ctx := context.Background()
+
+	state, err := surge.Multiplier("qqguw", ctx)
+	assert.NoError(t, err)
+	// the live ratio asks for 5.5, capped at 2 and reached half way
+	assert.Equal(t, 1.5, state.Multiplier)
+
+	state, _ = surge.Multiplier("qqguw", ctx)
+	assert.Equal(t, 1.5, state.Multiplier)
+	assert.Equal(t, 1, fake.counted, "a fresh state is reused without counting the zone again")
+
+	fake.age("qqguw")
+	state, _ = surge.Multiplier("qqguw", ctx)
+	assert.Equal(t, 1.8, state.Multiplier)
+
+	fake.age("qqguw")
+	fake.demand = 0
+	state, _ = surge.Multiplier("qqguw", ctx)
+	assert.Equal(t, 1.4, state.Multiplier)
+}
+
+func TestSurgeMultiplier_Override(t *testing.T) {
+	fake := &fakeSurgeRedis{values: map[string]string{}, demand: 20, drivers: 2}
+	surge := NewSurgePricing(fake, time.Minute, 2, 0.5)
+	ctx := context.Background()
+
+	_, err := surge.Override("qqguw", 2.5, 0, ctx)
+	assert.NoError(t, err)
+	state, err := surge.Multiplier("qqguw", ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, state.Overridden)
+	assert.Equal(t, 2.5, state.Multiplier)
+	assert.Equal(t, 0, fake.counted)
+}
+
+func TestSurgeMultiplier_OverrideSetWhileCounting(t *testing.T) {
+	fake := &fakeSurgeRedis{values: map[string]string{}, demand: 20, drivers: 2}
+	surge := NewSurgePricing(fake, time.Minute, 2, 0.5)
+	ctx := context.Background()
+	fake.beforeSave = func() { fake.values["SURGE:OVERRIDE:{qqguw}"] = "1.2" }
+
+	state, err := surge.Multiplier("qqguw", ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, state.Overridden)
+	assert.Equal(t, 1.2, state.Multiplier)
+	_, saved := fake.values["SURGE:ZONE:{qqguw}"]
+	assert.False(t, saved, "the computed state does not replace the override")
+}
+
+func TestSurgeMultiplier_OtherReplicaSavedFirst(t *testing.T) {
+	fake := &fakeSurgeRedis{values: map[string]string{}, demand: 20, drivers: 2}
+	surge := NewSurgePricing(fake, time.Minute, 2, 0.5)
+	ctx := context.Background()
+	other, _ := json.Marshal(models.SurgeState{Zone: "qqguw", Multiplier: 1.3, UpdatedAt: time.Now()})
+	fake.beforeSave = func() { fake.values["SURGE:ZONE:{qqguw}"] = string(other) }
+
+	state, err := surge.Multiplier("qqguw", ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1.3, state.Multiplier)
+	assert.Equal(t, string(other), fake.values["SURGE:ZONE:{qqguw}"])
+}
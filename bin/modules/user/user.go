@@ -2,8 +2,10 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"location-service/bin/modules/user/models"
+	"location-service/bin/pkg/outbox"
 	"location-service/bin/pkg/utils"
 	//"go.mongodb.org/mongo-driver/bson"
 )
@@ -12,20 +14,93 @@ type UsecaseQuery interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	GetUser(userId string, ctx context.Context) utils.Result
 	FindDriver(userId string, ctx context.Context) utils.Result
+	FindPool(userId string, ctx context.Context) utils.Result
+	GetTripDriver(userId string, ctx context.Context) utils.Result
+	GetSurge(zone string, ctx context.Context) utils.Result
+	GetRouteCacheStats(ctx context.Context) utils.Result
+	AutocompletePlaces(payload models.PlaceAutocompleteRequest, ctx context.Context) utils.Result
+	ReverseGeocode(payload models.ReverseGeocodeRequest, ctx context.Context) utils.Result
+	GetSavedPlaces(userId string, ctx context.Context) utils.Result
+	GetRecentDestinations(userId string, ctx context.Context) utils.Result
+	GetScheduledRides(userId string, ctx context.Context) utils.Result
+	SearchCommuteOffers(payload models.CommuteSearchRequest, ctx context.Context) utils.Result
+	DispatchScheduledRides(ctx context.Context) utils.Result
 }
 
 type UsecaseCommand interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	PostLocation(userId string, payload models.LocationSuggestionRequest, ctx context.Context) utils.Result
+	RecordRideDemand(payload models.RequestRide, ctx context.Context) utils.Result
+	ChargeCancellationFee(payload models.RideCancelled, ctx context.Context) utils.Result
+	OverrideSurge(zone string, payload models.SurgeOverrideRequest, ctx context.Context) utils.Result
+	ClearSurgeOverride(zone string, ctx context.Context) utils.Result
+	CreateSavedPlace(userId string, payload models.SavedPlaceRequest, ctx context.Context) utils.Result
+	UpdateSavedPlace(userId string, placeId string, payload models.SavedPlaceRequest, ctx context.Context) utils.Result
+	DeleteSavedPlace(userId string, placeId string, ctx context.Context) utils.Result
+	ScheduleRide(userId string, ctx context.Context) utils.Result
+	CancelScheduledRide(userId string, rideId string, ctx context.Context) utils.Result
 }
 
 type MongodbRepositoryQuery interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	FindOne(userId string, ctx context.Context) <-chan utils.Result
 	Findwallet(ctx context.Context, userId string) <-chan utils.Result
+	FindFareRules(ctx context.Context) <-chan utils.Result
+	SearchPlaces(ctx context.Context, keyword string, near *models.GeoJSONPoint, limit int64) <-chan utils.Result
+	FindPlacesNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, limit int64) <-chan utils.Result
+	FindSavedPlaces(ctx context.Context, userId string) <-chan utils.Result
+	FindRecentDestinations(ctx context.Context, userId string, limit int64) <-chan utils.Result
+	FindScheduledRides(ctx context.Context, userId string) <-chan utils.Result
+	FindScheduledRide(ctx context.Context, userId string, rideId string) <-chan utils.Result
+	FindDueScheduledRides(ctx context.Context, now time.Time, limit int64) <-chan utils.Result
+	FindCommuteOffersNear(ctx context.Context, near models.GeoJSONPoint, maxDistanceMeters float64, from time.Time, until time.Time, seats int, limit int64) <-chan utils.Result
+	FindDriverStats(ctx context.Context, driverIds []string) <-chan utils.Result
+}
+
+type PricingEngine interface {
+	// City is the city of the area around the coordinates, empty outside every known city
+	City(latitude float64, longitude float64) string
+	Quote(serviceType string, city string, distanceKm float64, durationMinutes float64, stops int, surgeMultiplier float64) models.FareBreakdown
+}
+
+type RouteProvider interface {
+	Name() string
+	Routes(request models.RouteRequest, ctx context.Context) ([]models.RouteOption, error)
+}
+
+// PlaceProvider reads Keyword of the location for autocomplete, the coordinates bias the results toward
+// the rider when they are set
+type PlaceProvider interface {
+	Name() string
+	Autocomplete(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error)
+	Reverse(location models.Location, ctx context.Context) ([]models.LocationSuggestion, error)
+}
+
+// MatchingStrategy ranks the available drivers around the pickup into the shortlist offered the ride, best first
+type MatchingStrategy interface {
+	Name() string
+	Rank(pickup models.LocationRequest, candidates []models.DriverCandidate, ctx context.Context) ([]models.RankedDriver, error)
+}
+
+type SurgePricing interface {
+	Zone(latitude float64, longitude float64) string
+	RecordDemand(zone string, riderId string, ctx context.Context) error
+	Multiplier(zone string, ctx context.Context) (models.SurgeState, error)
+	Override(zone string, multiplier float64, ttl time.Duration, ctx context.Context) (models.SurgeState, error)
+	ClearOverride(zone string, ctx context.Context) error
 }
 
 type MongodbRepositoryCommand interface {
 	// idiomatic go, ctx first before payload. See https://pkg.go.dev/context#pkg-overview
 	NewObjectID(ctx context.Context) string
+	InsertOutbox(event outbox.Event, ctx context.Context) <-chan utils.Result
+	InsertSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result
+	UpdateSavedPlace(place models.SavedPlace, ctx context.Context) <-chan utils.Result
+	DeleteSavedPlace(userId string, placeId string, ctx context.Context) <-chan utils.Result
+	UpsertRecentDestination(recent models.RecentDestination, ctx context.Context) <-chan utils.Result
+	InsertScheduledRide(ride models.ScheduledRide, ctx context.Context) <-chan utils.Result
+	InsertDispatch(dispatch models.Dispatch, ctx context.Context) <-chan utils.Result
+	UpdateScheduledRide(ride models.ScheduledRide, fromStatus string, ctx context.Context) <-chan utils.Result
+	RequeueStaleScheduledRides(staleBefore time.Time, now time.Time, ctx context.Context) <-chan utils.Result
+	ChargeWallet(userId string, transaction models.TransactionLog, ctx context.Context) <-chan utils.Result
 }
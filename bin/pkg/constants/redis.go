@@ -0,0 +1,60 @@
+package constants
+
+const (
+	// DriverLocationKey is the redis geo set holding the latest position of every available driver
+	DriverLocationKey = "drivers-locations"
+	// DriverOnTripLocationKey is the redis geo set holding the latest position of drivers serving a trip
+	DriverOnTripLocationKey = "drivers-on-trip-locations"
+	// DriverLastSeenKey is the redis sorted set holding the last ping (unix seconds) of every tracked driver
+	DriverLastSeenKey = "drivers-last-seen"
+	// DriverAvailableSinceKey is the redis sorted set holding when (unix seconds) every available driver became available
+	DriverAvailableSinceKey = "drivers-available-since"
+)
+
+const (
+	// DriverTrackingChannel is the redis pub/sub channel prefix for live driver positions, suffixed by the driver id
+	DriverTrackingChannel = "driver-tracking:"
+	// TripDriverKey is the redis key format holding the driver id assigned to the rider trip
+	TripDriverKey = "USER:DRIVER:%s"
+	// TripPickupKey is the redis key format holding the pickup of the rider trip, the quote it was booked from is gone
+	TripPickupKey = "USER:PICKUP:%s"
+	// PoolTripKey is the redis key format holding the free seats and remaining stops of a driver on a trip open to pooling
+	PoolTripKey = "POOL:TRIP:%s"
+	// RiderSearchKey is the redis key format holding the dispatch of the driver search a rider is running, a rider
+	// searches once at a time
+	RiderSearchKey = "USER:SEARCH:%s"
+	// IdempotencyKey is the redis key format of the response stored for an Idempotency-Key header: user then key
+	IdempotencyKey = "IDEMPOTENCY:%s:%s"
+	// DriverRideKey is the redis key format holding the ride a driver accepted, the driver is out of matching until
+	// the ride ends
+	DriverRideKey = "DRIVER:RIDE:%s"
+	// DriverStatusKey is the redis key format holding the status a driver last set, it outlives the daily work-log
+	DriverStatusKey = "DRIVER:STATUS:%s"
+)
+
+const (
+	// SurgeDemandKey is the redis sorted set format of riders searching in a zone, scored by unix milliseconds
+	SurgeDemandKey = "SURGE:DEMAND:%s"
+	// SurgeStateKey is the redis key format holding the last computed surge of a zone, the zone is a hash tag so the
+	// state and the override of a zone share a cluster slot
+	SurgeStateKey = "SURGE:ZONE:{%s}"
+	// SurgeOverrideKey is the redis key format holding the multiplier forced by an admin on a zone
+	SurgeOverrideKey = "SURGE:OVERRIDE:{%s}"
+)
+
+const (
+	// RouteCacheKey is the redis key format of cached routes: service type, origin and waypoint cells, destination cell,
+	// departure bucket
+	RouteCacheKey = "ROUTE:CACHE:%s:%s:%s:%d"
+	// RouteCacheStatsKey is the redis hash counting route cache hits and misses
+	RouteCacheStatsKey = "ROUTE:CACHE:STATS"
+	// RouteBypassKey is the redis key format set while a rider cannot skip the route cache again
+	RouteBypassKey = "ROUTE:BYPASS:%s"
+)
+
+const (
+	// PlaceAutocompleteKey is the redis key format of cached autocomplete results: rider cell then keyword
+	PlaceAutocompleteKey = "PLACE:AUTOCOMPLETE:%s:%s"
+	// PlaceReverseKey is the redis key format of cached reverse geocode results by cell
+	PlaceReverseKey = "PLACE:REVERSE:%s"
+)
@@ -70,7 +70,7 @@ func (m MongoDBLogger) FindAllData(payload FindAllData, ctx context.Context) err
 	findOption := options.Find()
 
 	if payload.Sort != nil {
-		findOption.SetSort(bson.D{{payload.Sort.FieldName, payload.Sort.buildSortBy()}})
+		findOption.SetSort(bson.D{{Key: payload.Sort.FieldName, Value: payload.Sort.buildSortBy()}})
 	}
 
 	findOption.Limit = &payload.Size
@@ -217,6 +217,7 @@ func (m MongoDBLogger) InsertOne(payload InsertOne, ctx context.Context) error {
 }
 
 type UpdateOne struct {
+	Result         *int64
 	CollectionName string
 	Filter         interface{}
 	Document       interface{}
@@ -241,13 +242,17 @@ func (m MongoDBLogger) UpdateOne(payload UpdateOne, ctx context.Context) error {
 	}
 
 	doc := bson.D{{Key: "$set", Value: update}}
-	_, err = collection.UpdateOne(ctx, payload.Filter, doc)
+	updated, err := collection.UpdateOne(ctx, payload.Filter, doc)
 
 	if err != nil {
 		msg := fmt.Sprintf("Error Mongodb Connection : %s", err.Error())
 		return errors.InternalServerError(msg)
 	}
 
+	if payload.Result != nil {
+		*payload.Result = updated.MatchedCount
+	}
+
 	finish := time.Now()
 
 	if finish.Sub(start).Seconds() > 10 {
@@ -447,3 +452,128 @@ func (m MongoDBLogger) UpsertOne(payload UpsertOne, ctx context.Context) error {
 
 	return nil
 }
+
+type IncrementOne struct {
+	CollectionName string
+	Filter         interface{}
+	// Fields are the counters to add to, a missing document is created from the filter
+	Fields interface{}
+}
+
+func (m MongoDBLogger) IncrementOne(payload IncrementOne, ctx context.Context) error {
+	start := time.Now()
+
+	collection := m.mongoClient.Database(m.dbName).Collection(payload.CollectionName)
+
+	doc := bson.D{{Key: "$inc", Value: payload.Fields}}
+	_, err := collection.UpdateOne(ctx, payload.Filter, doc, options.Update().SetUpsert(true))
+
+	if err != nil {
+		msg := fmt.Sprintf("Error Mongodb Connection : %s", err.Error())
+		return errors.InternalServerError(msg)
+	}
+
+	finish := time.Now()
+
+	if finish.Sub(start).Seconds() > 10 {
+		j, _ := json.Marshal(payload.Filter)
+		msg := fmt.Sprintf("slow query: %v second, query: %s", finish.Sub(start).Seconds(), string(j))
+		m.logger.Slow("mongo-incrementOne", msg, "mongo-query-slow", "mongodb")
+	}
+
+	return nil
+}
+
+type ModifyOne struct {
+	Result         *int64
+	CollectionName string
+	Filter         interface{}
+	// Update is the whole update document, for the updates a $set alone cannot do
+	Update interface{}
+}
+
+func (m MongoDBLogger) ModifyOne(payload ModifyOne, ctx context.Context) error {
+	start := time.Now()
+
+	collection := m.mongoClient.Database(m.dbName).Collection(payload.CollectionName)
+	updated, err := collection.UpdateOne(ctx, payload.Filter, payload.Update)
+
+	if err != nil {
+		msg := fmt.Sprintf("Error Mongodb Connection : %s", err.Error())
+		return errors.InternalServerError(msg)
+	}
+
+	if payload.Result != nil {
+		*payload.Result = updated.MatchedCount
+	}
+
+	finish := time.Now()
+
+	if finish.Sub(start).Seconds() > 10 {
+		j, _ := json.Marshal(payload.Filter)
+		msg := fmt.Sprintf("slow query: %v second, query: %s", finish.Sub(start).Seconds(), string(j))
+		m.logger.Slow("mongo-modifyOne", msg, "mongo-query-slow", "mongodb")
+	}
+
+	return nil
+}
+
+type DeleteOne struct {
+	Result         *int64
+	CollectionName string
+	Filter         interface{}
+}
+
+func (m MongoDBLogger) DeleteOne(payload DeleteOne, ctx context.Context) error {
+	start := time.Now()
+
+	collection := m.mongoClient.Database(m.dbName).Collection(payload.CollectionName)
+	deleted, err := collection.DeleteOne(ctx, payload.Filter)
+
+	if err != nil {
+		msg := fmt.Sprintf("Error Mongodb Connection : %s", err.Error())
+		return errors.InternalServerError(msg)
+	}
+
+	if payload.Result != nil {
+		*payload.Result = deleted.DeletedCount
+	}
+
+	finish := time.Now()
+
+	if finish.Sub(start).Seconds() > 10 {
+		j, _ := json.Marshal(payload.Filter)
+		msg := fmt.Sprintf("slow query: %v second, query: %s", finish.Sub(start).Seconds(), string(j))
+		m.logger.Slow("mongo-deleteOne", msg, "mongo-query-slow", "mongodb")
+	}
+
+	return nil
+}
+
+// CreateIndex makes a TTL index when ExpireAfter is set, documents are deleted that long after the date in the key
+type CreateIndex struct {
+	CollectionName string
+	Keys           interface{}
+	Unique         bool
+	ExpireAfter    time.Duration
+}
+
+// CreateIndex is a no-op when the same index already exists
+func (m MongoDBLogger) CreateIndex(payload CreateIndex, ctx context.Context) error {
+	collection := m.mongoClient.Database(m.dbName).Collection(payload.CollectionName)
+
+	indexOptions := options.Index().SetUnique(payload.Unique)
+	if payload.ExpireAfter > 0 {
+		indexOptions.SetExpireAfterSeconds(int32(payload.ExpireAfter.Seconds()))
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    payload.Keys,
+		Options: indexOptions,
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Error Mongodb Connection : %s", err.Error())
+		return errors.InternalServerError(msg)
+	}
+
+	return nil
+}
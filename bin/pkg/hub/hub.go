@@ -0,0 +1,104 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"location-service/bin/pkg/log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hub fans out redis pub/sub messages to the subscribers connected to this instance,
+// every replica runs its own Hub so a message published anywhere reaches every subscriber
+type Hub struct {
+	sync.RWMutex
+	redisClient redis.UniversalClient
+	patterns    []string
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+// NewHub is a constructor of Hub listening to the given redis channel patterns
+func NewHub(rc redis.UniversalClient, patterns ...string) *Hub {
+	return &Hub{
+		redisClient: rc,
+		patterns:    patterns,
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// Run listens to redis until ctx is cancelled, then closes every local subscription
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.redisClient.PSubscribe(ctx, h.patterns...)
+	defer pubsub.Close()
+	defer h.closeAll()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			h.dispatch(msg.Channel, []byte(msg.Payload))
+		}
+	}
+}
+
+// Publish sends the message to every subscriber of the channel on every instance
+func (h *Hub) Publish(ctx context.Context, channel string, message []byte) error {
+	return h.redisClient.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe registers a local subscriber of the channel, the returned func must be called to unsubscribe
+func (h *Hub) Subscribe(channel string) (<-chan []byte, func()) {
+	ch := make(chan []byte, 16)
+
+	h.Lock()
+	if h.subscribers[channel] == nil {
+		h.subscribers[channel] = make(map[chan []byte]struct{})
+	}
+	h.subscribers[channel][ch] = struct{}{}
+	h.Unlock()
+
+	return ch, func() {
+		h.Lock()
+		defer h.Unlock()
+		if _, ok := h.subscribers[channel][ch]; !ok {
+			return
+		}
+		delete(h.subscribers[channel], ch)
+		if len(h.subscribers[channel]) == 0 {
+			delete(h.subscribers, channel)
+		}
+		close(ch)
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.Lock()
+	defer h.Unlock()
+	for channel, subscribers := range h.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(h.subscribers, channel)
+	}
+}
+
+func (h *Hub) dispatch(channel string, message []byte) {
+	h.RLock()
+	defer h.RUnlock()
+
+	for ch := range h.subscribers[channel] {
+		select {
+		case ch <- message:
+		default:
+			// a slow subscriber only misses positions, the next one supersedes it anyway
+			log.GetLogger().Info("hub", fmt.Sprintf("subscriber buffer full, message dropped on %s", channel), "dispatch", "")
+		}
+	}
+}
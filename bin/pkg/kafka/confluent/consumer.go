@@ -1,66 +1,323 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"location-service/bin/pkg/log"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
 )
 
+const (
+	// readTimeout bounds every poll so the read loop notices Close
+	readTimeout = 500 * time.Millisecond
+	// maxRetries is how many times a failed message is handled again before it goes to the dead-letter topic
+	maxRetries = 3
+	// retryBackoff is the first delay between retries, doubled on every attempt
+	retryBackoff = 500 * time.Millisecond
+	// partitionBuffer is how many messages may wait for a busy partition worker
+	partitionBuffer = 64
+	// deadLetterSuffix is appended to the source topic to name its dead-letter topic
+	deadLetterSuffix = ".dlq"
+	// deadLetterTimeout bounds the wait for the dead-letter delivery report
+	deadLetterTimeout = 10 * time.Second
+	// maxDeadLetterAttempts is how many times a message is published to the dead-letter topic before
+	// its partition is rewound to it
+	maxDeadLetterAttempts = 5
+	// seekTimeoutMs bounds how long the read loop waits for a partition to be rewound
+	seekTimeoutMs = 5000
+)
+
+// ErrInvalidMessage marks a message no retry can fix, it goes to the dead-letter topic straight away
+var ErrInvalidMessage = errors.New("invalid message")
+
+// client is the part of the confluent consumer the read loop uses
+type client interface {
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error)
+	Seek(partition kafka.TopicPartition, timeoutMs int) error
+	Close() error
+}
+
+// partitionWorker handles the messages of one partition in order, once a message cannot be committed
+// it is blocked and skips everything until the read loop rewinds the partition to that message
+type partitionWorker struct {
+	messages chan *kafka.Message
+	blocked  atomic.Bool
+}
+
+// rewind asks the read loop to read the partition of worker again from partition.Offset
+type rewind struct {
+	worker    *partitionWorker
+	partition kafka.TopicPartition
+}
+
 type consumer struct {
 	sync.Mutex
-	handler  ConsumerHandler
-	consumer *kafka.Consumer
-	logger   log.Log
+	handler    ConsumerHandler
+	deadLetter Producer
+	consumer   client
+	logger     log.Log
+	backoff    time.Duration
+	workers    map[string]*partitionWorker
+	rewinds    []rewind
+	inFlight   sync.WaitGroup
+	done       chan struct{}
+	stopped    chan struct{}
 }
 
 // NewConsumer is a constructor of kafka consumer
 func NewConsumer(config *kafka.ConfigMap, log log.Log) (Consumer, error) {
+	// offsets are committed by the partition workers once a message is handled
+	config.SetKey("enable.auto.commit", false)
 	c, err := kafka.NewConsumer(config)
 	if err != nil {
 		return nil, err
 	}
 
+	return newConsumer(c, log), nil
+}
+
+func newConsumer(c client, log log.Log) *consumer {
 	return &consumer{
 		logger:   log,
 		consumer: c,
-	}, nil
+		backoff:  retryBackoff,
+		workers:  make(map[string]*partitionWorker),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
 }
 
 func (c *consumer) SetHandler(handler ConsumerHandler) {
 	c.handler = handler
 }
 
+// SetDeadLetter sets the producer used to park messages that still fail after the retries
+func (c *consumer) SetDeadLetter(producer Producer) {
+	c.deadLetter = producer
+}
+
+// Subscribe starts reading the topics in the background, messages of a partition are handled
+// in order by a worker dedicated to that partition
 func (c *consumer) Subscribe(topics ...string) {
 	if c.handler == nil {
 		joinTopic := strings.Join(topics, ", ")
 		msg := fmt.Sprintf("Kafka Consumer Error: Topics: [%s] There is no consumer handler to handle message from incoming event", joinTopic)
 		c.logger.Error("", msg, "", "")
+		close(c.stopped)
+		return
+	}
+
+	if err := c.consumer.SubscribeTopics(topics, c.rebalance); err != nil {
+		msg := fmt.Sprintf("Kafka Consumer Error: cannot subscribe to [%s]: %v", strings.Join(topics, ", "), err)
+		c.logger.Error("", msg, "", "")
+		close(c.stopped)
 		return
 	}
-	var wg sync.WaitGroup
-	var mtx sync.Mutex
 
-	c.consumer.SubscribeTopics(topics, nil)
 	go func() {
+		defer close(c.stopped)
 		for {
-			wg.Add(1)
+			select {
+			case <-c.done:
+				return
+			default:
+			}
 
-			msg, err := c.consumer.ReadMessage(-1)
+			c.rewindPartitions()
+			msg, err := c.consumer.ReadMessage(readTimeout)
 			if err != nil {
+				if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrTimedOut {
+					continue
+				}
 				msg := fmt.Sprintf("Kafka Consumer Error: %v (%v)\n", err, msg)
 				c.logger.Error("", msg, "", "")
 				continue
 			}
-			mtx.Lock()
-			c.handler.HandleMessage(msg)
-			mtx.Unlock()
-			wg.Done()
-			c.consumer.CommitMessage(msg)
+			c.dispatch(msg)
 		}
 	}()
-	wg.Wait()
-	return
+}
+
+func partitionKey(partition kafka.TopicPartition) string {
+	return fmt.Sprintf("%s/%d", *partition.Topic, partition.Partition)
+}
+
+func (c *consumer) dispatch(msg *kafka.Message) {
+	key := partitionKey(msg.TopicPartition)
+	worker, ok := c.workers[key]
+	if !ok {
+		worker = &partitionWorker{messages: make(chan *kafka.Message, partitionBuffer)}
+		c.workers[key] = worker
+		c.inFlight.Add(1)
+		go func() {
+			defer c.inFlight.Done()
+			for msg := range worker.messages {
+				// the messages after the one left uncommitted are read again once the partition is rewound
+				if worker.blocked.Load() {
+					continue
+				}
+				if !c.process(msg) {
+					worker.blocked.Store(true)
+					c.Lock()
+					c.rewinds = append(c.rewinds, rewind{worker: worker, partition: msg.TopicPartition})
+					c.Unlock()
+				}
+			}
+		}()
+	}
+	if worker.blocked.Load() {
+		return
+	}
+	worker.messages <- msg
+}
+
+// rewindPartitions seeks every blocked partition back to the message it could not commit and starts
+// a new worker for it, a failed seek is tried again on the next poll
+func (c *consumer) rewindPartitions() {
+	c.Lock()
+	rewinds := c.rewinds
+	c.rewinds = nil
+	c.Unlock()
+
+	for _, r := range rewinds {
+		key := partitionKey(r.partition)
+		// the partition was revoked since, its new owner reads it from the committed offset
+		if c.workers[key] != r.worker {
+			continue
+		}
+		if err := c.consumer.Seek(r.partition, seekTimeoutMs); err != nil {
+			c.logger.Error("kafka-consumer", fmt.Sprintf("Rewind partition failed, retry on next poll: %v", err), *r.partition.Topic, r.partition.String())
+			c.Lock()
+			c.rewinds = append(c.rewinds, r)
+			c.Unlock()
+			continue
+		}
+		close(r.worker.messages)
+		delete(c.workers, key)
+	}
+}
+
+// rebalance drops the workers of the revoked partitions, the messages they still hold are read
+// by the next owner of the partition. The assignment itself is left to the client.
+func (c *consumer) rebalance(_ *kafka.Consumer, ev kafka.Event) error {
+	var partitions []kafka.TopicPartition
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		partitions = e.Partitions
+	case kafka.RevokedPartitions:
+		partitions = e.Partitions
+	default:
+		return nil
+	}
+
+	for _, partition := range partitions {
+		key := partitionKey(partition)
+		if worker, ok := c.workers[key]; ok {
+			worker.blocked.Store(true)
+			close(worker.messages)
+			delete(c.workers, key)
+		}
+	}
+	return nil
+}
+
+// process handles the message and commits its offset, it returns false when the message could not be committed
+func (c *consumer) process(msg *kafka.Message) bool {
+	topic := *msg.TopicPartition.Topic
+	backoff := c.backoff
+	err := c.handler.HandleMessage(msg)
+	for attempt := 1; err != nil && !errors.Is(err, ErrInvalidMessage) && attempt <= maxRetries; attempt++ {
+		c.logger.Error("kafka-consumer", fmt.Sprintf("Handle message failed, retry %d/%d in %v: %v", attempt, maxRetries, backoff, err), topic, string(msg.Value))
+		time.Sleep(backoff)
+		backoff *= 2
+		err = c.handler.HandleMessage(msg)
+	}
+
+	if err != nil {
+		if c.deadLetter == nil {
+			c.logger.Error("kafka-consumer", fmt.Sprintf("Handle message failed, no dead-letter topic, partition rewound: %v", err), topic, string(msg.Value))
+			return false
+		}
+		if !c.publishDeadLetter(msg, err) {
+			return false
+		}
+		c.logger.Error("kafka-consumer", fmt.Sprintf("Handle message failed, moved to %s%s: %v", topic, deadLetterSuffix, err), topic, string(msg.Value))
+	}
+
+	if _, err := c.consumer.CommitMessage(msg); err != nil {
+		c.logger.Error("kafka-consumer", fmt.Sprintf("Commit offset failed: %v", err), topic, msg.TopicPartition.String())
+	}
+	return true
+}
+
+// publishDeadLetter parks the message, it gives up after maxDeadLetterAttempts or when the consumer is closing
+func (c *consumer) publishDeadLetter(msg *kafka.Message, handleErr error) bool {
+	topic := *msg.TopicPartition.Topic
+	headers := map[string]string{
+		"x-original-topic":     topic,
+		"x-original-partition": fmt.Sprintf("%d", msg.TopicPartition.Partition),
+		"x-original-offset":    msg.TopicPartition.Offset.String(),
+		"x-error":              handleErr.Error(),
+	}
+
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+		err := c.deadLetter.PublishSync(ctx, topic+deadLetterSuffix, string(msg.Key), headers, msg.Value)
+		cancel()
+		if err == nil {
+			return true
+		}
+		if attempt == maxDeadLetterAttempts {
+			c.logger.Error("kafka-consumer", fmt.Sprintf("Dead-letter publish failed %d times, partition rewound: %v", attempt, err), topic, string(msg.Value))
+			return false
+		}
+		c.logger.Error("kafka-consumer", fmt.Sprintf("Dead-letter publish failed, retry %d/%d in %v: %v", attempt, maxDeadLetterAttempts-1, backoff, err), topic, string(msg.Value))
+
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Close stops reading new messages and waits for the partition workers to finish the messages
+// already read, until ctx is done. Then it leaves the consumer group.
+func (c *consumer) Close(ctx context.Context) error {
+	c.Lock()
+	select {
+	case <-c.done:
+		c.Unlock()
+		return nil
+	default:
+		close(c.done)
+	}
+	c.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		<-c.stopped
+		for _, worker := range c.workers {
+			close(worker.messages)
+		}
+		c.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		c.logger.Error("kafka-consumer", "Close timeout, messages in progress will be read again", "", "")
+	}
+	return c.consumer.Close()
 }
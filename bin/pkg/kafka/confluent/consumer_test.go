@@ -0,0 +1,295 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"location-service/bin/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// fakeClient serves a fixed partition log, Seek moves the read position back like the broker would
+type fakeClient struct {
+	sync.Mutex
+	log       []*kafka.Message
+	pos       int
+	events    []kafka.Event
+	rebalance kafka.RebalanceCb
+	delivered int
+	committed []string
+	seeks     []string
+}
+
+func (f *fakeClient) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error {
+	f.rebalance = rebalanceCb
+	return nil
+}
+
+func (f *fakeClient) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.events) > 0 {
+		f.rebalance(nil, f.events[0])
+		f.events = f.events[1:]
+		f.delivered++
+	}
+	if f.pos >= len(f.log) {
+		time.Sleep(time.Millisecond)
+		return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+	}
+	msg := f.log[f.pos]
+	f.pos++
+	return msg, nil
+}
+
+func (f *fakeClient) CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.committed = append(f.committed, offsetKey(m.TopicPartition))
+	return nil, nil
+}
+
+func (f *fakeClient) Seek(partition kafka.TopicPartition, timeoutMs int) error {
+	f.Lock()
+	defer f.Unlock()
+	f.seeks = append(f.seeks, offsetKey(partition))
+	for i, msg := range f.log {
+		if offsetKey(msg.TopicPartition) == offsetKey(partition) {
+			f.pos = i
+		}
+	}
+	return nil
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func (f *fakeClient) push(ev kafka.Event) {
+	f.Lock()
+	defer f.Unlock()
+	f.events = append(f.events, ev)
+}
+
+func (f *fakeClient) commits() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.committed...)
+}
+
+func (f *fakeClient) seeked() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.seeks...)
+}
+
+type fakeProducer struct {
+	sync.Mutex
+	failures  int
+	published []string
+	headers   map[string]string
+}
+
+func (p *fakeProducer) Publish(topic string, message []byte) {}
+
+func (p *fakeProducer) PublishSync(ctx context.Context, topic string, key string, headers map[string]string, value []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker down")
+	}
+	p.published = append(p.published, topic+":"+string(value))
+	p.headers = headers
+	return nil
+}
+
+func (p *fakeProducer) Flush(timeoutMs int) int { return 0 }
+
+func (p *fakeProducer) Close() {}
+
+func (p *fakeProducer) topics() []string {
+	p.Lock()
+	defer p.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+type handlerFunc func(message *kafka.Message) error
+
+func (h handlerFunc) HandleMessage(message *kafka.Message) error {
+	return h(message)
+}
+
+// recorder keeps the values handled so far
+type recorder struct {
+	sync.Mutex
+	handled []string
+}
+
+func (r *recorder) add(msg *kafka.Message) {
+	r.Lock()
+	defer r.Unlock()
+	r.handled = append(r.handled, string(msg.Value))
+}
+
+func (r *recorder) values() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.handled...)
+}
+
+func offsetKey(partition kafka.TopicPartition) string {
+	return fmt.Sprintf("%s/%d@%d", *partition.Topic, partition.Partition, partition.Offset)
+}
+
+func message(topic string, partition int32, offset int64, value string) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: kafka.Offset(offset)},
+		Value:          []byte(value),
+	}
+}
+
+func startConsumer(client *fakeClient, handler ConsumerHandler, producer Producer) *consumer {
+	c := newConsumer(client, log.GetLogger())
+	c.backoff = time.Millisecond
+	c.SetHandler(handler)
+	if producer != nil {
+		c.SetDeadLetter(producer)
+	}
+	c.Subscribe("orders")
+	return c
+}
+
+func TestConsumer_RetryThenCommit(t *testing.T) {
+	client := &fakeClient{log: []*kafka.Message{message("orders", 0, 0, "a")}}
+	rec := &recorder{}
+	c := startConsumer(client, handlerFunc(func(msg *kafka.Message) error {
+		rec.add(msg)
+		if len(rec.values()) < 3 {
+			return errors.New("database down")
+		}
+		return nil
+	}), &fakeProducer{})
+
+	assert.Eventually(t, func() bool { return len(client.commits()) == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, []string{"a", "a", "a"}, rec.values())
+	assert.Equal(t, []string{"orders/0@0"}, client.commits())
+	assert.Empty(t, client.seeked())
+}
+
+func TestConsumer_InvalidMessageDeadLettered(t *testing.T) {
+	client := &fakeClient{log: []*kafka.Message{message("orders", 0, 0, "a"), message("orders", 0, 1, "b")}}
+	producer := &fakeProducer{}
+	rec := &recorder{}
+	c := startConsumer(client, handlerFunc(func(msg *kafka.Message) error {
+		rec.add(msg)
+		if string(msg.Value) == "a" {
+			return fmt.Errorf("%w: missing id", ErrInvalidMessage)
+		}
+		return nil
+	}), producer)
+
+	assert.Eventually(t, func() bool { return len(client.commits()) == 2 }, time.Second, time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, []string{"a", "b"}, rec.values())
+	assert.Equal(t, []string{"orders.dlq:a"}, producer.topics())
+	assert.Equal(t, "0", producer.headers["x-original-offset"])
+	assert.Equal(t, "invalid message: missing id", producer.headers["x-error"])
+	assert.Equal(t, []string{"orders/0@0", "orders/0@1"}, client.commits())
+}
+
+func TestConsumer_DeadLetterDownRewindsPartition(t *testing.T) {
+	client := &fakeClient{log: []*kafka.Message{message("orders", 0, 0, "a"), message("orders", 0, 1, "b")}}
+	producer := &fakeProducer{failures: maxDeadLetterAttempts}
+	rec := &recorder{}
+	c := startConsumer(client, handlerFunc(func(msg *kafka.Message) error {
+		rec.add(msg)
+		if string(msg.Value) == "a" {
+			return ErrInvalidMessage
+		}
+		return nil
+	}), producer)
+
+	assert.Eventually(t, func() bool { return len(client.commits()) == 2 }, time.Second, time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+	// b waits for a instead of being dropped while the dead-letter topic is down
+	assert.Equal(t, []string{"a", "a", "b"}, rec.values())
+	assert.Equal(t, []string{"orders/0@0"}, client.seeked())
+	assert.Equal(t, []string{"orders.dlq:a"}, producer.topics())
+	assert.Equal(t, []string{"orders/0@0", "orders/0@1"}, client.commits())
+}
+
+func TestConsumer_KeepsPartitionOrder(t *testing.T) {
+	client := &fakeClient{log: []*kafka.Message{
+		message("orders", 0, 0, "p0-0"),
+		message("orders", 1, 0, "p1-0"),
+		message("orders", 0, 1, "p0-1"),
+		message("orders", 1, 1, "p1-1"),
+		message("orders", 0, 2, "p0-2"),
+	}}
+	rec := &recorder{}
+	failed := false
+	c := startConsumer(client, handlerFunc(func(msg *kafka.Message) error {
+		if string(msg.Value) == "p0-0" && !failed {
+			failed = true
+			return errors.New("database down")
+		}
+		rec.add(msg)
+		return nil
+	}), &fakeProducer{})
+
+	assert.Eventually(t, func() bool { return len(client.commits()) == 5 }, time.Second, time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+
+	var p0, p1 []string
+	for _, value := range rec.values() {
+		if value[:2] == "p0" {
+			p0 = append(p0, value)
+		} else {
+			p1 = append(p1, value)
+		}
+	}
+	assert.Equal(t, []string{"p0-0", "p0-1", "p0-2"}, p0)
+	assert.Equal(t, []string{"p1-0", "p1-1"}, p1)
+}
+
+func TestConsumer_RevokeDropsQueuedMessages(t *testing.T) {
+	client := &fakeClient{log: []*kafka.Message{message("orders", 0, 0, "a"), message("orders", 0, 1, "b")}}
+	rec := &recorder{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := startConsumer(client, handlerFunc(func(msg *kafka.Message) error {
+		rec.add(msg)
+		if string(msg.Value) == "a" {
+			close(started)
+			<-release
+		}
+		return nil
+	}), &fakeProducer{})
+
+	<-started
+	assert.Eventually(t, func() bool {
+		client.Lock()
+		defer client.Unlock()
+		return client.pos == 2
+	}, time.Second, time.Millisecond)
+	topic := "orders"
+	client.push(kafka.RevokedPartitions{Partitions: []kafka.TopicPartition{{Topic: &topic, Partition: 0}}})
+	assert.Eventually(t, func() bool {
+		client.Lock()
+		defer client.Unlock()
+		return client.delivered == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	assert.NoError(t, c.Close(context.Background()))
+	// b is left to the next owner of the partition
+	assert.Equal(t, []string{"a"}, rec.values())
+}
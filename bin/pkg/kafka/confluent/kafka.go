@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"context"
 	"location-service/bin/config"
 
 	k "gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
@@ -8,15 +9,22 @@ import (
 
 type Producer interface {
 	Publish(topic string, message []byte)
+	// PublishSync waits for the acknowledgement, an error wrapping ErrUndeliverable will not pass on retry
+	PublishSync(ctx context.Context, topic string, key string, headers map[string]string, value []byte) error
+	Flush(timeoutMs int) int
+	Close()
 }
 
 type Consumer interface {
 	SetHandler(handler ConsumerHandler)
+	SetDeadLetter(producer Producer)
 	Subscribe(topics ...string)
+	Close(ctx context.Context) error
 }
 
 type ConsumerHandler interface {
-	HandleMessage(message *k.Message)
+	// HandleMessage returns an error to have the message retried, wrap ErrInvalidMessage to skip the retries
+	HandleMessage(message *k.Message) error
 }
 
 type KafkaConfig struct {
@@ -1,12 +1,40 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"location-service/bin/pkg/log"
 
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
 )
 
+// flushTimeoutMs bounds how long Close waits for the queued messages to be delivered
+const flushTimeoutMs = 5000
+
+// ErrUndeliverable marks a message Kafka rejects for what it is, publishing it again cannot succeed
+var ErrUndeliverable = errors.New("undeliverable message")
+
+// undeliverableCodes are the errors about the message itself, every other error may pass once the brokers are back
+var undeliverableCodes = map[kafka.ErrorCode]bool{
+	kafka.ErrInvalidArg:         true,
+	kafka.ErrInvalidMsg:         true,
+	kafka.ErrInvalidMsgSize:     true,
+	kafka.ErrMsgSizeTooLarge:    true,
+	kafka.ErrRecordListTooLarge: true,
+	kafka.ErrInvalidRecord:      true,
+	kafka.ErrTopicException:     true,
+}
+
+// classify wraps err with ErrUndeliverable when retrying the message is pointless
+func classify(err error) error {
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) && undeliverableCodes[kafkaErr.Code()] {
+		return fmt.Errorf("%w: %w", ErrUndeliverable, err)
+	}
+	return err
+}
+
 // Producer struct
 type producer struct {
 	producer *kafka.Producer
@@ -52,3 +80,52 @@ func (p *producer) Publish(topic string, message []byte) {
 		Value: message,
 	}
 }
+
+// PublishSync produces the message and waits for the broker acknowledgement or ctx to be done
+func (p *producer) PublishSync(ctx context.Context, topic string, key string, headers map[string]string, value []byte) error {
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: kafka.PartitionAny,
+		},
+		Value: value,
+	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+
+	deliveryCh := make(chan kafka.Event, 1)
+	if err := p.producer.Produce(msg, deliveryCh); err != nil {
+		return classify(fmt.Errorf("produce to %s: %w", topic, err))
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("delivery to %s not acknowledged: %w", topic, ctx.Err())
+	case e := <-deliveryCh:
+		delivered, ok := e.(*kafka.Message)
+		if !ok {
+			return fmt.Errorf("delivery to %s: unexpected event %v", topic, e)
+		}
+		if delivered.TopicPartition.Error != nil {
+			return classify(fmt.Errorf("delivery to %s failed: %w", topic, delivered.TopicPartition.Error))
+		}
+		return nil
+	}
+}
+
+// Flush waits for the queued messages to be delivered and returns how many are still queued
+func (p *producer) Flush(timeoutMs int) int {
+	return p.producer.Flush(timeoutMs)
+}
+
+// Close flushes the queued messages then releases the producer
+func (p *producer) Close() {
+	if remaining := p.producer.Flush(flushTimeoutMs); remaining > 0 {
+		p.logger.Error("kafka-producer", fmt.Sprintf("%d messages not delivered on close", remaining), "", "")
+	}
+	p.producer.Close()
+}
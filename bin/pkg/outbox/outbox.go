@@ -0,0 +1,197 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"location-service/bin/pkg/databases/mongodb"
+	kafkaPkgConfluent "location-service/bin/pkg/kafka/confluent"
+	"location-service/bin/pkg/log"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionName = "outbox"
+
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	// StatusParked is an event Kafka can never accept, it is left for an operator so the events behind it go out
+	StatusParked = "parked"
+
+	// SentRetention is how long a sent event is kept before its TTL index deletes it
+	SentRetention = 7 * 24 * time.Hour
+
+	// relayLockKey makes a single replica relay at a time, so events keep their order
+	relayLockKey   = "OUTBOX:RELAY:LOCK"
+	relayLockTTL   = 30 * time.Second
+	relayInterval  = time.Second
+	relayBatch     = 100
+	publishTimeout = 10 * time.Second
+	// maxRelayBackoff caps the wait before publishing again an event Kafka could not take
+	maxRelayBackoff = time.Minute
+)
+
+// Event is a kafka message persisted by a usecase, the relay publishes it once Kafka acknowledges
+type Event struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Topic     string             `bson:"topic" json:"topic"`
+	Key       string             `bson:"key" json:"key"`
+	Headers   map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+	Value     string             `bson:"value" json:"value"`
+	Status    string             `bson:"status" json:"status"`
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	LastError string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	SentAt    *time.Time         `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+}
+
+// NewEvent builds a pending event, the id is generated here so events sort in creation order
+func NewEvent(topic string, key string, value []byte) Event {
+	return Event{
+		ID:        primitive.NewObjectID(),
+		Topic:     topic,
+		Key:       key,
+		Value:     string(value),
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+}
+
+// store is the part of the mongodb connection the relay uses
+type store interface {
+	FindAllData(payload mongodb.FindAllData, ctx context.Context) error
+	UpdateOne(payload mongodb.UpdateOne, ctx context.Context) error
+}
+
+type Relay struct {
+	mongoDb     store
+	producer    kafkaPkgConfluent.Producer
+	redisClient redis.UniversalClient
+	logger      log.Log
+	owner       string
+	// backoff grows while Kafka keeps failing the head event, nothing is published before retryAt
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// NewRelay is a constructor of the outbox relay, mongoDb must be the master connection
+func NewRelay(mongoDb mongodb.MongoDBLogger, producer kafkaPkgConfluent.Producer, rc redis.UniversalClient, logger log.Log) *Relay {
+	return &Relay{
+		mongoDb:     mongoDb,
+		producer:    producer,
+		redisClient: rc,
+		logger:      logger,
+		owner:       primitive.NewObjectID().Hex(),
+	}
+}
+
+// Run publishes the pending events in creation order until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.release()
+			return
+		case <-ticker.C:
+			if time.Now().Before(r.retryAt) || !r.acquire(ctx) {
+				continue
+			}
+			r.relay(ctx)
+		}
+	}
+}
+
+func (r *Relay) acquire(ctx context.Context) bool {
+	if r.renew(ctx) {
+		return true
+	}
+	acquired, err := r.redisClient.SetNX(ctx, relayLockKey, r.owner, relayLockTTL).Result()
+	return err == nil && acquired
+}
+
+// renew extends the lock of this replica, false once it expired or another replica took it over
+func (r *Relay) renew(ctx context.Context) bool {
+	owner, err := r.redisClient.Get(ctx, relayLockKey).Result()
+	if err != nil || owner != r.owner {
+		return false
+	}
+	return r.redisClient.Expire(ctx, relayLockKey, relayLockTTL).Err() == nil
+}
+
+func (r *Relay) release() {
+	ctx := context.Background()
+	if owner, err := r.redisClient.Get(ctx, relayLockKey).Result(); err == nil && owner == r.owner {
+		r.redisClient.Del(ctx, relayLockKey)
+	}
+}
+
+func (r *Relay) relay(ctx context.Context) {
+	var events []Event
+	err := r.mongoDb.FindAllData(mongodb.FindAllData{
+		Result:         &events,
+		CollectionName: CollectionName,
+		Filter:         bson.M{"status": StatusPending},
+		Sort:           &mongodb.Sort{FieldName: "_id", By: mongodb.SortAscending},
+		Page:           1,
+		Size:           relayBatch,
+	}, ctx)
+	if err != nil {
+		r.logger.Error("outbox", fmt.Sprintf("Failed get pending events: %v", err), "relay", "")
+		return
+	}
+
+	for _, event := range events {
+		// a batch can outlive the lock, another replica relaying the same events would break their order
+		if !r.renew(ctx) {
+			r.logger.Info("outbox", "Relay lock lost, stopping the batch", "relay", "")
+			return
+		}
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := r.producer.PublishSync(publishCtx, event.Topic, event.Key, event.Headers, []byte(event.Value))
+		cancel()
+		if err != nil {
+			attempts := event.Attempts + 1
+			document := bson.M{"attempts": attempts, "lastError": err.Error()}
+			undeliverable := errors.Is(err, kafkaPkgConfluent.ErrUndeliverable)
+			if undeliverable {
+				document["status"] = StatusParked
+			}
+			r.logger.Error("outbox", fmt.Sprintf("Failed publish event %s, attempt %d: %v", event.ID.Hex(), attempts, err), "relay", event.Topic)
+			errUpdate := r.mongoDb.UpdateOne(mongodb.UpdateOne{
+				CollectionName: CollectionName,
+				Filter:         bson.M{"_id": event.ID},
+				Document:       document,
+			}, ctx)
+			if undeliverable && errUpdate == nil {
+				// the event is out of the way, the events behind it no longer wait for it
+				r.logger.Error("outbox", fmt.Sprintf("Parked undeliverable event %s", event.ID.Hex()), "relay", event.Topic)
+				continue
+			}
+			// Kafka may be down, stop at the failure and start again from this event once the backoff is over so
+			// the events go out in order
+			r.backoff = min(max(r.backoff*2, relayInterval), maxRelayBackoff)
+			r.retryAt = time.Now().Add(r.backoff)
+			return
+		}
+		r.backoff = 0
+
+		sentAt := time.Now()
+		err = r.mongoDb.UpdateOne(mongodb.UpdateOne{
+			CollectionName: CollectionName,
+			Filter:         bson.M{"_id": event.ID},
+			Document:       bson.M{"status": StatusSent, "attempts": event.Attempts + 1, "sentAt": sentAt},
+		}, ctx)
+		if err != nil {
+			// published but still pending, it is sent again on the next tick, consumers must be idempotent
+			r.logger.Error("outbox", fmt.Sprintf("Failed mark event %s sent: %v", event.ID.Hex(), err), "relay", event.Topic)
+			return
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"location-service/bin/pkg/databases/mongodb"
+	kafkaPkgConfluent "location-service/bin/pkg/kafka/confluent"
+	"location-service/bin/pkg/log"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeStore keeps the outbox collection in creation order
+type fakeStore struct {
+	events []Event
+}
+
+func (s *fakeStore) FindAllData(payload mongodb.FindAllData, ctx context.Context) error {
+	result := payload.Result.(*[]Event)
+	for _, event := range s.events {
+		if event.Status == payload.Filter.(bson.M)["status"] {
+			*result = append(*result, event)
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) UpdateOne(payload mongodb.UpdateOne, ctx context.Context) error {
+	id := payload.Filter.(bson.M)["_id"].(primitive.ObjectID)
+	document := payload.Document.(bson.M)
+	for i := range s.events {
+		if s.events[i].ID != id {
+			continue
+		}
+		if status, ok := document["status"].(string); ok {
+			s.events[i].Status = status
+		}
+		s.events[i].Attempts = document["attempts"].(int)
+		if lastError, ok := document["lastError"].(string); ok {
+			s.events[i].LastError = lastError
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) status(id primitive.ObjectID) Event {
+	for _, event := range s.events {
+		if event.ID == id {
+			return event
+		}
+	}
+	return Event{}
+}
+
+// fakeProducer fails the values listed in errs and records the others
+type fakeProducer struct {
+	errs      map[string]error
+	published []string
+}
+
+func (p *fakeProducer) Publish(topic string, message []byte) {}
+
+func (p *fakeProducer) PublishSync(ctx context.Context, topic string, key string, headers map[string]string, value []byte) error {
+	if err := p.errs[string(value)]; err != nil {
+		return err
+	}
+	p.published = append(p.published, string(value))
+	return nil
+}
+
+func (p *fakeProducer) Flush(timeoutMs int) int { return 0 }
+
+func (p *fakeProducer) Close() {}
+
+// fakeRedis holds the relay lock, lose takes it over for another replica on the given renewal
+type fakeRedis struct {
+	redis.UniversalClient
+	values map[string]string
+	gets   int
+	lose   int
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	f.gets++
+	if f.lose > 0 && f.gets >= f.lose {
+		f.values[key] = "other-replica"
+	}
+	value, ok := f.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if _, ok := f.values[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	f.values[key] = value.(string)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (f *fakeRedis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(true, nil)
+}
+
+func (f *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(f.values, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func newTestRelay(values ...string) (*Relay, *fakeStore, *fakeProducer, *fakeRedis) {
+	store := &fakeStore{}
+	for _, value := range values {
+		store.events = append(store.events, NewEvent("rides", "ride1", []byte(value)))
+	}
+	producer := &fakeProducer{errs: map[string]error{}}
+	rc := &fakeRedis{values: map[string]string{}}
+	r := &Relay{
+		mongoDb:     store,
+		producer:    producer,
+		redisClient: rc,
+		logger:      log.GetLogger(),
+		owner:       "replica1",
+	}
+	return r, store, producer, rc
+}
+
+func TestRelay_PublishesInOrderAndMarksSent(t *testing.T) {
+	r, store, producer, _ := newTestRelay("a", "b", "c")
+
+	assert.True(t, r.acquire(context.Background()))
+	r.relay(context.Background())
+
+	assert.Equal(t, []string{"a", "b", "c"}, producer.published)
+	for _, event := range store.events {
+		assert.Equal(t, StatusSent, event.Status)
+		assert.Equal(t, 1, event.Attempts)
+	}
+}
+
+func TestRelay_BrokerDownKeepsHeadPending(t *testing.T) {
+	r, store, producer, _ := newTestRelay("a", "b")
+	store.events[0].Attempts = 20
+	producer.errs["a"] = errors.New("broker transport failure")
+
+	assert.True(t, r.acquire(context.Background()))
+	before := time.Now()
+	r.relay(context.Background())
+
+	// b waits behind a however long the broker is down
+	assert.Empty(t, producer.published)
+	head := store.status(store.events[0].ID)
+	assert.Equal(t, StatusPending, head.Status)
+	assert.Equal(t, 21, head.Attempts)
+	assert.Equal(t, "broker transport failure", head.LastError)
+	assert.Equal(t, StatusPending, store.events[1].Status)
+	assert.Equal(t, relayInterval, r.backoff)
+	assert.False(t, r.retryAt.Before(before.Add(relayInterval)))
+
+	r.relay(context.Background())
+	assert.Equal(t, 2*relayInterval, r.backoff)
+
+	delete(producer.errs, "a")
+	r.relay(context.Background())
+	assert.Equal(t, []string{"a", "b"}, producer.published)
+	assert.Equal(t, time.Duration(0), r.backoff)
+}
+
+func TestRelay_ParksUndeliverableEvent(t *testing.T) {
+	r, store, producer, _ := newTestRelay("a", "b")
+	producer.errs["a"] = fmt.Errorf("%w: message too large", kafkaPkgConfluent.ErrUndeliverable)
+
+	assert.True(t, r.acquire(context.Background()))
+	r.relay(context.Background())
+
+	assert.Equal(t, []string{"b"}, producer.published)
+	assert.Equal(t, StatusParked, store.events[0].Status)
+	assert.Equal(t, StatusSent, store.events[1].Status)
+	assert.Equal(t, time.Duration(0), r.backoff)
+}
+
+func TestRelay_LockHeldByOtherReplica(t *testing.T) {
+	r, store, producer, rc := newTestRelay("a")
+	rc.values[relayLockKey] = "other-replica"
+
+	assert.False(t, r.acquire(context.Background()))
+
+	// a replica that lost the lock stops before publishing
+	r.relay(context.Background())
+	assert.Empty(t, producer.published)
+	assert.Equal(t, StatusPending, store.events[0].Status)
+}
+
+func TestRelay_LockLostMidBatch(t *testing.T) {
+	r, store, producer, rc := newTestRelay("a", "b")
+
+	assert.True(t, r.acquire(context.Background()))
+	// the renewal before b finds the lock taken over
+	rc.lose = rc.gets + 2
+	r.relay(context.Background())
+
+	assert.Equal(t, []string{"a"}, producer.published)
+	assert.Equal(t, StatusSent, store.events[0].Status)
+	assert.Equal(t, StatusPending, store.events[1].Status)
+}
+
+func TestRelay_ReleaseOnlyOwnLock(t *testing.T) {
+	r, _, _, rc := newTestRelay()
+
+	assert.True(t, r.acquire(context.Background()))
+	assert.Equal(t, "replica1", rc.values[relayLockKey])
+	r.release()
+	assert.NotContains(t, rc.values, relayLockKey)
+
+	rc.values[relayLockKey] = "other-replica"
+	r.release()
+	assert.Equal(t, "other-replica", rc.values[relayLockKey])
+}
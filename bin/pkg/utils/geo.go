@@ -0,0 +1,125 @@
+package utils
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+// HaversineKm returns the great-circle distance in kilometers between two coordinates
+func HaversineKm(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	dLat := (latitude2 - latitude1) * math.Pi / 180
+	dLng := (longitude2 - longitude1) * math.Pi / 180
+	lat1 := latitude1 * math.Pi / 180
+	lat2 := latitude2 * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// EncodeGeohash returns the geohash of the coordinate with the given number of characters
+func EncodeGeohash(latitude, longitude float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch, even := 0, 0, true
+
+	for len(hash) < precision {
+		if even {
+			mid := (lngRange[0] + lngRange[1]) / 2
+			if longitude >= mid {
+				ch |= 1 << (4 - bit)
+				lngRange[0] = mid
+			} else {
+				lngRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if latitude >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+			continue
+		}
+		hash = append(hash, geohashBase32[ch])
+		bit, ch = 0, 0
+	}
+
+	return string(hash)
+}
+
+// DecodeGeohash returns the center of the geohash cell, ok is false on an invalid geohash
+func DecodeGeohash(hash string) (latitude, longitude float64, ok bool) {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	even := true
+
+	for i := 0; i < len(hash); i++ {
+		idx := -1
+		for j := 0; j < len(geohashBase32); j++ {
+			if geohashBase32[j] == hash[i] {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return 0, 0, false
+		}
+		for bit := 4; bit >= 0; bit-- {
+			target := &latRange
+			if even {
+				target = &lngRange
+			}
+			mid := (target[0] + target[1]) / 2
+			if idx&(1<<bit) != 0 {
+				target[0] = mid
+			} else {
+				target[1] = mid
+			}
+			even = !even
+		}
+	}
+
+	return (latRange[0] + latRange[1]) / 2, (lngRange[0] + lngRange[1]) / 2, len(hash) > 0
+}
+
+// ProjectOnPolyline returns how far the coordinate is from the polyline and how far along the polyline its closest
+// point lies, both in kilometers. line holds longitude, latitude pairs like GeoJSON. The projection is flat around
+// the coordinate, fine for city scale distances.
+func ProjectOnPolyline(latitude, longitude float64, line [][]float64) (distanceKm float64, alongKm float64) {
+	toXY := func(point []float64) (float64, float64) {
+		x := (point[0] - longitude) * math.Pi / 180 * math.Cos(latitude*math.Pi/180) * earthRadiusKm
+		y := (point[1] - latitude) * math.Pi / 180 * earthRadiusKm
+		return x, y
+	}
+
+	distanceKm = math.Inf(1)
+	travelled := 0.0
+	for i := 0; i < len(line); i++ {
+		ax, ay := toXY(line[i])
+		if i == len(line)-1 {
+			if len(line) == 1 {
+				distanceKm, alongKm = math.Hypot(ax, ay), 0
+			}
+			break
+		}
+		bx, by := toXY(line[i+1])
+		dx, dy := bx-ax, by-ay
+		segmentKm := math.Hypot(dx, dy)
+		t := 0.0
+		if segmentKm > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/(segmentKm*segmentKm)))
+		}
+		if d := math.Hypot(ax+t*dx, ay+t*dy); d < distanceKm {
+			distanceKm, alongKm = d, travelled+t*segmentKm
+		}
+		travelled += segmentKm
+	}
+	return distanceKm, alongKm
+}
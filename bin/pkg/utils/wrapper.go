@@ -66,7 +66,7 @@ func Response(data interface{}, message string, code int, c echo.Context) error
 
 // ResponseError function
 func ResponseError(err interface{}, c echo.Context) error {
-	errObj := getErrorStatusCode(err)
+	errObj := ErrorStatusCode(err)
 	result := BaseWrapperModel{
 		Success: false,
 		Data:    errObj.Data,
@@ -77,7 +77,7 @@ func ResponseError(err interface{}, c echo.Context) error {
 		Date:          time.Now(),
 		Url:           c.Path(),
 		Method:        c.Request().Method,
-		Code:          fmt.Sprintf("%v", getErrorStatusCode(err)),
+		Code:          fmt.Sprintf("%v", ErrorStatusCode(err)),
 		Ip:            c.RealIP(),
 		ContentLength: c.Request().ContentLength,
 	}
@@ -88,7 +88,8 @@ func ResponseError(err interface{}, c echo.Context) error {
 	return c.JSON(errObj.ResponseCode, result)
 }
 
-func getErrorStatusCode(err interface{}) httpError.CommonErrorData {
+// ErrorStatusCode maps the error of a usecase to the status it is answered with, ResponseCode is the http status
+func ErrorStatusCode(err interface{}) httpError.CommonErrorData {
 	errData := httpError.CommonErrorData{}
 
 	switch obj := err.(type) {
@@ -122,6 +123,11 @@ func getErrorStatusCode(err interface{}) httpError.CommonErrorData {
 		errData.Data = obj.Data
 		errData.Message = obj.Message
 		return errData
+	case *httpError.ErrorString:
+		errData.ResponseCode = obj.Code()
+		errData.Code = obj.Code()
+		errData.Message = obj.Error()
+		return errData
 	default:
 		errData.Code = http.StatusConflict
 		return errData